@@ -0,0 +1,63 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	. "takeHomeAssignment/entities"
+)
+
+// changeAccountStatus freezes, unfreezes or closes an account, the reason is kept in the status history
+func changeAccountStatus(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(mux.Vars(r)["account_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("account_id", "must be an integer"))
+		return
+	}
+	var change AccountStatusChange
+	err = DecodeRequest(r.Body, &change)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	account := Account{}
+	err = store.ChangeAccountStatus(accountID, &change, &account)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(account)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getAccountStatusChanges(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(mux.Vars(r)["account_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("account_id", "must be an integer"))
+		return
+	}
+
+	account := Account{}
+	err = store.QueryAccountByAccountId(accountID, &account)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var changes []AccountStatusChange
+	err = store.QueryAccountStatusChanges(accountID, &changes)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(changes)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
@@ -3,21 +3,38 @@ package main
 import (
 	"context"
 	"database/sql"
+	"encoding/json"
 	"errors"
 	"fmt"
-	"github.com/lib/pq"
 	"github.com/stretchr/testify/assert"
 	"github.com/testcontainers/testcontainers-go"
 	"github.com/testcontainers/testcontainers-go/wait"
-	"os"
-	"path/filepath"
+	"net/http"
 	"sync"
 	. "takeHomeAssignment/db"
 	. "takeHomeAssignment/entities"
 	"testing"
+	"time"
 )
 
 func CreatePostgresContainer(ctx context.Context) (*sql.DB, error) {
+	database, err := createEmptyPostgresContainer(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	// Create the tables in the database
+	_, err = MigrateUp(ctx, database)
+	if err != nil {
+		database.Close()
+		return nil, err
+	}
+
+	return database, nil
+}
+
+// createEmptyPostgresContainer starts a database without any tables
+func createEmptyPostgresContainer(ctx context.Context) (*sql.DB, error) {
 	req := testcontainers.ContainerRequest{
 		Image:        "postgres:12",
 		ExposedPorts: []string{"5432/tcp"},
@@ -36,13 +53,6 @@ func CreatePostgresContainer(ctx context.Context) (*sql.DB, error) {
 	if err != nil {
 		return nil, err
 	}
-	// Create the tables in the database
-	initSQLPath := filepath.Join(".", "db", "init.sql")
-	initSQL, err := os.ReadFile(initSQLPath)
-	if err != nil {
-		return nil, err
-	}
-
 	// Get the mapped port for the container
 	mappedPort, err := container.MappedPort(ctx, "5432/tcp")
 	if err != nil {
@@ -50,57 +60,56 @@ func CreatePostgresContainer(ctx context.Context) (*sql.DB, error) {
 	}
 
 	// Create a database connection
-	database, err := sql.Open("postgres", fmt.Sprintf("host=localhost port=%d user=postgres password=postgres dbname=postgres sslmode=disable", mappedPort.Int()))
-	if err != nil {
-		return nil, err
-	}
+	return sql.Open("postgres", fmt.Sprintf("host=localhost port=%d user=postgres password=postgres dbname=postgres sslmode=disable", mappedPort.Int()))
+}
 
-	// Execute the SQL script to create the tables
-	_, err = database.Exec(string(initSQL))
+// money parses a decimal literal used in test fixtures
+func money(value string) Money {
+	amount, err := ParseMoney(value)
 	if err != nil {
-		return nil, err
+		panic(err)
 	}
+	return amount
+}
 
-	return database, nil
-
+// postgresDatabase returns the database of the Postgres store, and skips the test with the other backends, which do
+// not have the features it covers
+func postgresDatabase(t *testing.T) *sql.DB {
+	postgresStore, ok := store.(*PostgresStore)
+	if !ok {
+		t.Skip("only the postgres backend has this feature")
+	}
+	return postgresStore.DB
 }
 
 func TestGetAccount(t *testing.T) {
 	tests := []struct {
 		name                 string
 		accountID            int
-		balance              float64
+		balance              Money
 		accountAlreadyExists bool
 	}{
-		{"Successfully retrieves account when account exists", 1, 100.0, true},
-		{"Fails to retrieve account when account does not exists", 1, 100.0, false},
+		{"Successfully retrieves account when account exists", 1, money("100"), true},
+		{"Fails to retrieve account when account does not exists", 1, money("100"), false},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db, err := CreatePostgresContainer(context.Background())
-			defer db.Close()
-
-			assert.NoError(t, err)
-
-			account := Account{AccountID: tt.accountID, Balance: tt.balance}
-			defer db.Close()
-			if tt.accountAlreadyExists {
-				// Create the account in DB first
-				err = CreateAccount(db, &account)
-				assert.NoError(t, err)
-				retrievedAccount := Account{}
-				// Ensure that retrieval of account does not throw error
-				err = QueryAccountByAccountId(db, account.AccountID, &retrievedAccount)
-				assert.NoError(t, err)
-			} else {
-				account := Account{AccountID: 1, Balance: 100.0}
+			forEachStore(t, func(t *testing.T) {
+				account := Account{AccountID: tt.accountID, Balance: tt.balance}
 				retrievedAccount := Account{}
-				// Ensure that retrieval of account does not throw error
-				err = QueryAccountByAccountId(db, account.AccountID, &retrievedAccount)
-				assert.Error(t, err)
-			}
-
+				if tt.accountAlreadyExists {
+					// Create the account first
+					err := store.CreateAccount(&account, nil)
+					assert.NoError(t, err)
+					err = store.QueryAccountByAccountId(account.AccountID, &retrievedAccount)
+					assert.NoError(t, err)
+					assert.Equal(t, tt.balance, retrievedAccount.Balance)
+				} else {
+					err := store.QueryAccountByAccountId(account.AccountID, &retrievedAccount)
+					assert.ErrorIs(t, err, ErrAccountNotFound)
+				}
+			})
 		})
 	}
 }
@@ -109,52 +118,48 @@ func TestCreateAccount(t *testing.T) {
 	tests := []struct {
 		name                 string
 		accountID            int
-		balance              float64
+		balance              Money
 		accountAlreadyExists bool
 	}{
-		{"Successfully creates account when account does not exist", 1, 100.0, false},
-		{"Fails to create account when account already exists", 1, 100.0, true},
+		{"Successfully creates account when account does not exist", 1, money("100"), false},
+		{"Fails to create account when account already exists", 1, money("100"), true},
 	}
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			db, err := CreatePostgresContainer(context.Background())
-			defer db.Close()
-
-			assert.NoError(t, err)
-
-			account := Account{AccountID: tt.accountID, Balance: tt.balance}
-			defer db.Close()
-			if tt.accountAlreadyExists {
-				// Create the account in DB first
-				err = CreateAccount(db, &account)
-				assert.NoError(t, err)
-				// Ensure that second time creation of same account throws error
-				err = CreateAccount(db, &account)
-				assert.NotNil(t, err)
-				assert.Equal(t, "account ID already exists", err.Error())
-			} else {
-				account := Account{AccountID: 1, Balance: 100.0}
-				err = CreateAccount(db, &account)
-				assert.Nil(t, err)
-			}
-
+			forEachStore(t, func(t *testing.T) {
+				account := Account{AccountID: tt.accountID, Balance: tt.balance}
+				if tt.accountAlreadyExists {
+					// Create the account first
+					err := store.CreateAccount(&account, nil)
+					assert.NoError(t, err)
+					// Ensure that second time creation of same account throws error
+					err = store.CreateAccount(&account, nil)
+					assert.ErrorIs(t, err, ErrAccountExists)
+					assert.Equal(t, "account ID already exists", err.Error())
+				} else {
+					err := store.CreateAccount(&account, nil)
+					assert.NoError(t, err)
+				}
+			})
 		})
 	}
 }
 
 func TestQueryAccountByAccountId(t *testing.T) {
-	database, err := CreatePostgresContainer(context.Background())
-	defer database.Close()
-
-	assert.NoError(t, err)
-	account := Account{AccountID: 123, Balance: 123.0}
-	err = CreateAccount(database, &account)
-	assert.NoError(t, err)
-	val := Account{}
-	err = database.QueryRow("SELECT account_id, balance FROM account_balance WHERE account_id = $1", 123).Scan(&val.AccountID, &val.Balance)
-	assert.NoError(t, err)
-	assert.Equal(t, float64(123), account.Balance)
+	forEachStore(t, func(t *testing.T) {
+		account := Account{AccountID: 123, Balance: money("123"), Currency: "EUR"}
+		err := store.CreateAccount(&account, nil)
+		assert.NoError(t, err)
+		val := Account{}
+		err = store.QueryAccountByAccountId(123, &val)
+		assert.NoError(t, err)
+		assert.Equal(t, 123, val.AccountID)
+		assert.Equal(t, money("123"), val.Balance)
+		assert.Equal(t, money("123"), val.AvailableBalance)
+		assert.Equal(t, Currency("EUR"), val.Currency)
+		assert.Equal(t, AccountStatusActive, val.Status)
+	})
 }
 
 func TestProcessTransaction(t *testing.T) {
@@ -167,108 +172,116 @@ func TestProcessTransaction(t *testing.T) {
 	}{
 		{
 			name:          "Valid transaction",
-			sourceAccount: Account{AccountID: 3, Balance: 1000.0},
-			destAccount:   Account{AccountID: 2, Balance: 1000.0},
+			sourceAccount: Account{AccountID: 3, Balance: money("1000")},
+			destAccount:   Account{AccountID: 2, Balance: money("1000")},
 			transaction: Transaction{
 				SourceAccountID:      3,
 				DestinationAccountID: 2,
-				Amount:               1000.0,
+				Amount:               money("1000"),
 			},
 			expectedError: nil,
 		},
 		{
 			name:          "Source account not found throws error",
 			sourceAccount: Account{},
-			destAccount:   Account{AccountID: 2, Balance: 1000.0},
+			destAccount:   Account{AccountID: 2, Balance: money("1000")},
 			transaction: Transaction{
 				SourceAccountID:      3,
 				DestinationAccountID: 2,
-				Amount:               100.0,
+				Amount:               money("100"),
 			},
-			expectedError: sql.ErrNoRows,
+			expectedError: ErrAccountNotFound,
 		},
 		{
 			name:          "Destination account not found throws error",
-			sourceAccount: Account{AccountID: 2, Balance: 1000.0},
+			sourceAccount: Account{AccountID: 1, Balance: money("1000")},
 			destAccount:   Account{},
 			transaction: Transaction{
 				SourceAccountID:      1,
 				DestinationAccountID: 4,
-				Amount:               100.0,
+				Amount:               money("100"),
 			},
-			expectedError: sql.ErrNoRows,
+			expectedError: ErrAccountNotFound,
 		},
 		{
 			name:          "Source account has insufficient balance throws error",
-			sourceAccount: Account{AccountID: 1, Balance: 1000.0},
-			destAccount:   Account{AccountID: 2, Balance: 0.0},
+			sourceAccount: Account{AccountID: 1, Balance: money("1000")},
+			destAccount:   Account{AccountID: 2, Balance: money("0")},
 			transaction: Transaction{
 				SourceAccountID:      2,
 				DestinationAccountID: 1,
-				Amount:               100.0,
+				Amount:               money("100"),
+			},
+			expectedError: ErrInsufficientBalance,
+		},
+		{
+			name:          "Accounts with different currencies throws error",
+			sourceAccount: Account{AccountID: 1, Balance: money("1000"), Currency: "EUR"},
+			destAccount:   Account{AccountID: 2, Balance: money("1000"), Currency: "JPY"},
+			transaction: Transaction{
+				SourceAccountID:      1,
+				DestinationAccountID: 2,
+				Amount:               money("100"),
 			},
-			expectedError: &pq.Error{},
+			expectedError: ErrCurrencyMismatch,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			database, err := CreatePostgresContainer(context.Background())
-			defer database.Close()
-
-			assert.NoError(t, err)
-
-			if tt.name != "Source account not found throws error" {
-				err = CreateAccount(database, &tt.sourceAccount)
-				assert.NoError(t, err)
-			}
-			if tt.name != "Destination account not found throws error" {
-				err = CreateAccount(database, &tt.destAccount)
-				assert.NoError(t, err)
-			}
-
-			// When transferring from one account to the other
-			err = ProcessTransaction(database, &tt.transaction)
-			// Expect error or no error
-			if tt.expectedError != nil {
-				if errors.Is(tt.expectedError, sql.ErrNoRows) {
-					assert.Error(t, err)
-					assert.Equal(t, tt.expectedError, err)
+			forEachStore(t, func(t *testing.T) {
+				if tt.name != "Source account not found throws error" {
+					sourceAccount := tt.sourceAccount
+					err := store.CreateAccount(&sourceAccount, nil)
+					assert.NoError(t, err)
 				}
-				if errors.Is(tt.expectedError, &pq.Error{}) {
-					var pqErr *pq.Error
-					assert.True(t, errors.As(err, &pqErr))
-					assert.Equal(t, "23514", pqErr.Code)
+				if tt.name != "Destination account not found throws error" {
+					destAccount := tt.destAccount
+					err := store.CreateAccount(&destAccount, nil)
+					assert.NoError(t, err)
 				}
 
-			} else {
-				assert.NoError(t, err)
-			}
-
+				// When transferring from one account to the other
+				transaction := tt.transaction
+				err := store.ProcessTransaction(&transaction, nil, &TransactionRecord{})
+				// Expect error or no error
+				if tt.expectedError != nil {
+					assert.ErrorIs(t, err, tt.expectedError)
+				} else {
+					assert.NoError(t, err)
+				}
+			})
 		})
 	}
 }
 
 func TestConcurrentTransactions(t *testing.T) {
-	// Create a new PostgreSQL container
-	database, err := CreatePostgresContainer(context.Background())
-	assert.NoError(t, err)
-	defer database.Close()
+	forEachStore(t, testConcurrentTransactions)
+}
 
+func testConcurrentTransactions(t *testing.T) {
 	// Create 3 accounts with initial balances
-	account1 := Account{AccountID: 1, Balance: 1000.0}
-	account2 := Account{AccountID: 2, Balance: 1000.0}
-	account3 := Account{AccountID: 3, Balance: 1000.0}
-
-	err = CreateAccount(database, &account1)
-	assert.NoError(t, err)
-	err = CreateAccount(database, &account2)
-	assert.NoError(t, err)
-	err = CreateAccount(database, &account3)
-	assert.NoError(t, err)
+	for _, account := range []Account{
+		{AccountID: 1, Balance: money("1000")},
+		{AccountID: 2, Balance: money("1000")},
+		{AccountID: 3, Balance: money("1000")},
+	} {
+		err := store.CreateAccount(&account, nil)
+		assert.NoError(t, err)
+	}
 
-	// Define a function to process a transaction
+	// The transfers that went through, to check the balances against
+	var mu sync.Mutex
+	var records []TransactionRecord
 	processTransaction := func(transaction *Transaction) {
-		err = ProcessTransaction(database, transaction)
+		record := TransactionRecord{}
+		err := store.ProcessTransaction(transaction, nil, &record)
+		if err != nil {
+			assert.ErrorIs(t, err, ErrInsufficientBalance)
+			return
+		}
+		mu.Lock()
+		records = append(records, record)
+		mu.Unlock()
 	}
 
 	// Create a wait group to wait for all transactions to complete
@@ -281,7 +294,7 @@ func TestConcurrentTransactions(t *testing.T) {
 			transaction := Transaction{
 				SourceAccountID:      1,
 				DestinationAccountID: 2,
-				Amount:               1.0,
+				Amount:               money("1"),
 			}
 			processTransaction(&transaction)
 			wg.Done()
@@ -295,7 +308,7 @@ func TestConcurrentTransactions(t *testing.T) {
 			transaction := Transaction{
 				SourceAccountID:      3,
 				DestinationAccountID: 2,
-				Amount:               1.0,
+				Amount:               money("1"),
 			}
 			processTransaction(&transaction)
 			wg.Done()
@@ -305,46 +318,1173 @@ func TestConcurrentTransactions(t *testing.T) {
 	// Wait for all transactions to complete
 	wg.Wait()
 
-	// Check the final balances
-	var balance1 float64
-	var balance2 float64
-	var balance3 float64
-	err = database.QueryRow("SELECT balance FROM account_balance WHERE account_id = $1", 1).Scan(&balance1)
+	// Check the final balances against the transfers that went through, none may be lost
+	expected := map[int]Money{1: money("1000"), 2: money("1000"), 3: money("1000")}
+	for _, record := range records {
+		expected[record.SourceAccountID] -= record.Amount
+		expected[record.DestinationAccountID] += record.DestinationAmount
+	}
+	var total Money
+	for accountID, balance := range expected {
+		account := Account{}
+		err := store.QueryAccountByAccountId(accountID, &account)
+		assert.NoError(t, err)
+		assert.Equal(t, balance, account.Balance)
+		total += account.Balance
+	}
+
+	// Check that the balances sum up to 3000, some might fail but the total value should be kept constant
+	assert.Equal(t, money("3000"), total)
+}
+
+func TestCrossCurrencyTransaction(t *testing.T) {
+	forEachStore(t, testCrossCurrencyTransaction)
+}
+
+func testCrossCurrencyTransaction(t *testing.T) {
+	euroAccount := Account{AccountID: 1, Balance: money("1000"), Currency: "EUR"}
+	yenAccount := Account{AccountID: 2, Balance: money("0"), Currency: "JPY"}
+	err := store.CreateAccount(&euroAccount, nil)
+	assert.NoError(t, err)
+	err = store.CreateAccount(&yenAccount, nil)
+	assert.NoError(t, err)
+
+	transaction := Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("12.34"), ConvertCurrency: true}
+
+	// No rate has been uploaded yet
+	err = store.ProcessTransaction(&transaction, nil, &TransactionRecord{})
+	assert.ErrorIs(t, err, ErrNoExchangeRate)
+
+	// Only the Postgres backend has exchange rates, the others never convert
+	rate, err := ParseRate("161.2345678901")
 	assert.NoError(t, err)
-	err = database.QueryRow("SELECT balance FROM account_balance WHERE account_id = $1", 2).Scan(&balance2)
+	err = store.UpsertExchangeRates([]ExchangeRate{{BaseCurrency: "EUR", QuoteCurrency: "JPY", Rate: rate}})
+	if _, ok := store.(*PostgresStore); !ok {
+		assert.ErrorIs(t, err, ErrNotSupported)
+		err = store.ProcessTransaction(&transaction, nil, &TransactionRecord{})
+		assert.ErrorIs(t, err, ErrNoExchangeRate)
+		return
+	}
 	assert.NoError(t, err)
-	err = database.QueryRow("SELECT balance FROM account_balance WHERE account_id = $1", 3).Scan(&balance3)
+
+	record := TransactionRecord{}
+	err = store.ProcessTransaction(&transaction, nil, &record)
 	assert.NoError(t, err)
 
-	// Check that the balances sum up to 3000, some might fail but the total value should be kept constant
-	assert.Equal(t, 3000.0, balance1+balance2+balance3)
+	err = store.QueryAccountByAccountId(1, &euroAccount)
+	assert.NoError(t, err)
+	assert.Equal(t, money("987.66"), euroAccount.Balance)
+	err = store.QueryAccountByAccountId(2, &yenAccount)
+	assert.NoError(t, err)
+	assert.Equal(t, money("1989"), yenAccount.Balance)
+
+	// The rate and what was rounded off are recorded with the transfer
+	stored := TransactionRecord{}
+	err = store.QueryTransactionById(record.TransactionID, &stored)
+	assert.NoError(t, err)
+	assert.Equal(t, money("1989"), stored.DestinationAmount)
+	if assert.NotNil(t, stored.ExchangeRate) && assert.NotNil(t, stored.RoundingRemainder) {
+		assert.Equal(t, rate, *stored.ExchangeRate)
+		assert.Equal(t, "0.6345677638340", *stored.RoundingRemainder)
+	}
+}
+
+func TestProcessTransactionWithIdempotencyKey(t *testing.T) {
+	forEachStore(t, testProcessTransactionWithIdempotencyKey)
+}
+
+func testProcessTransactionWithIdempotencyKey(t *testing.T) {
+	err := store.CreateAccount(&Account{AccountID: 1, Balance: money("1000")}, nil)
+	assert.NoError(t, err)
+	err = store.CreateAccount(&Account{AccountID: 2, Balance: money("1000")}, nil)
+	assert.NoError(t, err)
+
+	transaction := Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("100")}
+	fingerprint, err := RequestFingerprint(transaction)
+	assert.NoError(t, err)
+	idempotencyKey := IdempotencyKey{
+		Key:            "retry-me",
+		Scope:          "POST /transactions",
+		Fingerprint:    fingerprint,
+		ResponseStatus: 201,
+	}
+
+	record := TransactionRecord{}
+	err = store.ProcessTransaction(&transaction, &idempotencyKey, &record)
+	assert.NoError(t, err)
+	expectedResponse, err := json.Marshal(record)
+	assert.NoError(t, err)
+
+	// Replaying the key must not move money a second time
+	err = store.ProcessTransaction(&transaction, &idempotencyKey, &TransactionRecord{})
+	assert.ErrorIs(t, err, ErrIdempotencyKeyInUse)
+
+	account := Account{}
+	err = store.QueryAccountByAccountId(1, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("900"), account.Balance)
+
+	stored := IdempotencyKey{}
+	err = store.QueryIdempotencyKey("POST /transactions", "retry-me", &stored)
+	assert.NoError(t, err)
+	assert.Equal(t, fingerprint, stored.Fingerprint)
+	assert.Equal(t, 201, stored.ResponseStatus)
+	assert.Equal(t, expectedResponse, stored.ResponseBody)
+	assert.Equal(t, record.Location(), stored.ResponseLocation)
+}
+
+func TestQueryTransactionById(t *testing.T) {
+	forEachStore(t, testQueryTransactionById)
+}
+
+func testQueryTransactionById(t *testing.T) {
+	err := store.CreateAccount(&Account{AccountID: 1, Balance: money("1000")}, nil)
+	assert.NoError(t, err)
+	err = store.CreateAccount(&Account{AccountID: 2, Balance: money("500")}, nil)
+	assert.NoError(t, err)
+
+	created := TransactionRecord{}
+	transaction := Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("250.5")}
+	err = store.ProcessTransaction(&transaction, nil, &created)
+	assert.NoError(t, err)
+	assert.NotZero(t, created.TransactionID)
+	assert.Equal(t, money("749.5"), created.SourceBalanceAfter)
+	assert.Equal(t, money("750.5"), created.DestinationBalanceAfter)
+
+	retrieved := TransactionRecord{}
+	err = store.QueryTransactionById(created.TransactionID, &retrieved)
+	assert.NoError(t, err)
+	assert.Equal(t, created.SourceAccountID, retrieved.SourceAccountID)
+	assert.Equal(t, created.Amount, retrieved.Amount)
+	assert.Equal(t, created.DestinationBalanceAfter, retrieved.DestinationBalanceAfter)
+	assert.Nil(t, retrieved.ExchangeRate)
+
+	err = store.QueryTransactionById(created.TransactionID+1, &retrieved)
+	assert.ErrorIs(t, err, ErrTransactionNotFound)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+}
+
+func TestQueryAccountTransactions(t *testing.T) {
+	forEachStore(t, testQueryAccountTransactions)
+}
+
+func testQueryAccountTransactions(t *testing.T) {
+	database := postgresDatabase(t)
+	for _, account := range []Account{
+		{AccountID: 1, Balance: money("1000")},
+		{AccountID: 2, Balance: money("1000")},
+		{AccountID: 3, Balance: money("1000")},
+	} {
+		err := CreateAccount(database, &account)
+		assert.NoError(t, err)
+	}
+	for _, transaction := range []Transaction{
+		{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("10")},
+		{SourceAccountID: 3, DestinationAccountID: 1, Amount: money("20")},
+		{SourceAccountID: 1, DestinationAccountID: 3, Amount: money("30")},
+	} {
+		err := ProcessTransaction(database, &transaction)
+		assert.NoError(t, err)
+	}
+
+	// First page holds the two newest transfers of account 1
+	page := TransactionHistoryPage{}
+	err := QueryAccountTransactions(database, 1, TransactionHistoryFilter{Limit: 2}, &page)
+	assert.NoError(t, err)
+	assert.Len(t, page.Transactions, 2)
+	assert.Equal(t, DirectionOutgoing, page.Transactions[0].Direction)
+	assert.Equal(t, 3, page.Transactions[0].CounterpartyAccountID)
+	assert.Equal(t, money("980"), page.Transactions[0].BalanceAfter)
+	assert.Equal(t, DirectionIncoming, page.Transactions[1].Direction)
+	assert.Equal(t, money("1010"), page.Transactions[1].BalanceAfter)
+	assert.NotEmpty(t, page.NextCursor)
+
+	// The cursor continues with the oldest transfer
+	cursor, err := DecodeTransactionHistoryCursor(page.NextCursor)
+	assert.NoError(t, err)
+	err = QueryAccountTransactions(database, 1, TransactionHistoryFilter{Limit: 2, After: &cursor}, &page)
+	assert.NoError(t, err)
+	assert.Len(t, page.Transactions, 1)
+	assert.Equal(t, money("990"), page.Transactions[0].BalanceAfter)
+	assert.Empty(t, page.NextCursor)
+
+	// Filters on direction and amount
+	minAmount := money("15")
+	err = QueryAccountTransactions(database, 1, TransactionHistoryFilter{Limit: 10, Direction: DirectionOutgoing, MinAmount: &minAmount}, &page)
+	assert.NoError(t, err)
+	assert.Len(t, page.Transactions, 1)
+	assert.Equal(t, money("30"), page.Transactions[0].Amount)
+}
+
+func TestQueryAccountTransactionsWithFees(t *testing.T) {
+	forEachStore(t, testQueryAccountTransactionsWithFees)
+}
+
+func testQueryAccountTransactionsWithFees(t *testing.T) {
+	database := postgresDatabase(t)
+	for _, account := range []Account{
+		{AccountID: 1, Balance: money("100")},
+		{AccountID: 2, Balance: money("100")},
+		{AccountID: 99, Balance: money("0")},
+	} {
+		err := CreateAccount(database, &account)
+		assert.NoError(t, err)
+	}
+	err := UpsertFeeSchedule(database, &FeeSchedule{
+		Currency:         "USD",
+		RevenueAccountID: 99,
+		Tiers:            FeeTiers{{Flat: money("0.5")}},
+	})
+	assert.NoError(t, err)
+	for _, transaction := range []Transaction{
+		{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("10")},
+		{SourceAccountID: 2, DestinationAccountID: 1, Amount: money("20")},
+		{SourceAccountID: 1, DestinationAccountID: 99, Amount: money("5")},
+		{SourceAccountID: 99, DestinationAccountID: 2, Amount: money("1")},
+	} {
+		err = ProcessTransaction(database, &transaction)
+		assert.NoError(t, err)
+	}
+
+	// Replaying the history from the opening balance ends at the balance of the account, fees included
+	for accountID, opening := range map[int]Money{1: money("100"), 2: money("100"), 99: money("0")} {
+		page := TransactionHistoryPage{}
+		err = QueryAccountTransactions(database, accountID, TransactionHistoryFilter{Limit: 10}, &page)
+		assert.NoError(t, err)
+		balance := opening
+		for i := len(page.Transactions) - 1; i >= 0; i-- {
+			entry := page.Transactions[i]
+			moved := entry.Amount
+			if entry.Fee != nil {
+				moved += *entry.Fee
+			}
+			if entry.Direction == DirectionOutgoing {
+				moved = -moved
+			}
+			balance += moved
+			assert.Equal(t, balance, entry.BalanceAfter, "account %d, transaction %d", accountID, entry.TransactionID)
+		}
+		account := Account{}
+		err = QueryAccountByAccountId(database, accountID, &account)
+		assert.NoError(t, err)
+		assert.Equal(t, account.Balance, balance, "account %d", accountID)
+	}
+
+	// The revenue account sees the fees of the transfers between other accounts as rows of their own, and the fee of
+	// a transfer into it on the incoming row
+	page := TransactionHistoryPage{}
+	err = QueryAccountTransactions(database, 99, TransactionHistoryFilter{Limit: 10, Direction: DirectionFee}, &page)
+	assert.NoError(t, err)
+	assert.Len(t, page.Transactions, 2)
+	for _, entry := range page.Transactions {
+		assert.Equal(t, money("0.5"), entry.Amount)
+		assert.Nil(t, entry.Fee)
+	}
+	err = QueryAccountTransactions(database, 99, TransactionHistoryFilter{Limit: 10, Direction: DirectionIncoming}, &page)
+	assert.NoError(t, err)
+	assert.Len(t, page.Transactions, 1)
+	assert.Equal(t, money("5"), page.Transactions[0].Amount)
+	assert.Equal(t, money("0.5"), *page.Transactions[0].Fee)
+}
+
+func TestLedgerPostings(t *testing.T) {
+	forEachStore(t, testLedgerPostings)
+}
+
+func testLedgerPostings(t *testing.T) {
+	err := store.CreateAccount(&Account{AccountID: 1, Balance: money("1000"), Currency: "EUR"}, nil)
+	assert.NoError(t, err)
+	err = store.CreateAccount(&Account{AccountID: 2, Balance: money("0"), Currency: "JPY"}, nil)
+	assert.NoError(t, err)
+	rate, err := ParseRate("160")
+	assert.NoError(t, err)
+	err = store.UpsertExchangeRates([]ExchangeRate{{BaseCurrency: "EUR", QuoteCurrency: "JPY", Rate: rate}})
 
-	// Check that the total transactions sum up
-	query := `SELECT 
-               (COALESCE(SUM(CASE WHEN account_transfer_in = $1 THEN amount ELSE 0 END), 0) - 
-                COALESCE(SUM(CASE WHEN account_transfer_out = $1 THEN amount ELSE 0 END), 0)) AS balance
-               FROM 
-               account_transactions
-               WHERE 
-               account_transfer_out = $1 OR account_transfer_in = $1`
+	record := TransactionRecord{}
+	transaction := Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("10"), ConvertCurrency: true}
+	postgresStore, ok := store.(*PostgresStore)
+	if !ok {
+		// Without exchange rates the other backends refuse the transfer and leave the balances as they were
+		assert.ErrorIs(t, err, ErrNotSupported)
+		err = store.ProcessTransaction(&transaction, nil, &record)
+		assert.ErrorIs(t, err, ErrNoExchangeRate)
+		account := Account{}
+		err = store.QueryAccountByAccountId(1, &account)
+		assert.NoError(t, err)
+		assert.Equal(t, money("1000"), account.Balance)
+		return
+	}
+	assert.NoError(t, err)
+	err = store.ProcessTransaction(&transaction, nil, &record)
+	assert.NoError(t, err)
+	database := postgresStore.DB
+
+	// The transfer is one journal entry that balances in both currencies through the FX positions
+	var entries []JournalEntry
+	err = QueryJournalEntriesByTransactionId(database, record.TransactionID, &entries)
+	assert.NoError(t, err)
+	assert.Len(t, entries, 1)
+	assert.Len(t, entries[0].Postings, 4)
+	assert.NoError(t, entries[0].Validate())
+
+	// Cached balances match the ledger
+	for accountID, expected := range map[int]Money{1: money("990"), 2: money("1600")} {
+		balance, err := QueryLedgerBalance(database, accountID)
+		assert.NoError(t, err)
+		assert.Equal(t, expected, balance)
+	}
+	corrected, err := RebuildAccountBalances(database)
+	assert.NoError(t, err)
+	assert.Empty(t, corrected)
 
-	// Check that the account balance for account 1 sum up to transaction table
-	row := database.QueryRow(query, 1)
+	// The database refuses a journal entry that does not balance
+	dbtx, err := database.Begin()
+	assert.NoError(t, err)
+	var journalEntryID int
+	err = dbtx.QueryRow("INSERT INTO journal_entries (description) VALUES ('unbalanced') RETURNING id").Scan(&journalEntryID)
+	assert.NoError(t, err)
+	_, err = dbtx.Exec("INSERT INTO postings (journal_entry_id, account_id, amount, currency) VALUES ($1, 1, 5, 'EUR')", journalEntryID)
+	assert.NoError(t, err)
+	err = dbtx.Commit()
+	assert.Error(t, err)
+}
+
+func TestProcessTransactionBatch(t *testing.T) {
+	forEachStore(t, testProcessTransactionBatch)
+}
+
+func testProcessTransactionBatch(t *testing.T) {
+	database := postgresDatabase(t)
+
+	for _, account := range []Account{
+		{AccountID: 1, Balance: money("300")},
+		{AccountID: 2, Balance: money("0")},
+		{AccountID: 3, Balance: money("0")},
+		{AccountID: 4, Balance: money("0")},
+	} {
+		err := CreateAccount(database, &account)
+		assert.NoError(t, err)
+	}
+
+	// Payroll from account 1 to the others, committed together
+	batch := TransactionBatch{Transactions: []Transaction{
+		{SourceAccountID: 1, DestinationAccountID: 4, Amount: money("100")},
+		{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("100")},
+		{SourceAccountID: 1, DestinationAccountID: 3, Amount: money("100")},
+	}}
+	record := TransactionBatchRecord{}
+	err := ProcessTransactionBatch(database, &batch, &record)
+	assert.NoError(t, err)
+	assert.Len(t, record.Transactions, 3)
+	for _, transaction := range record.Transactions {
+		assert.Equal(t, record.BatchID, *transaction.BatchID)
+	}
+	assert.Equal(t, money("0"), record.Transactions[2].SourceBalanceAfter)
+
+	retrieved := TransactionBatchRecord{}
+	err = QueryTransactionBatchById(database, record.BatchID, &retrieved)
+	assert.NoError(t, err)
+	assert.Len(t, retrieved.Transactions, 3)
+
+	// A single leg that cannot be funded rolls back the whole batch
+	batch = TransactionBatch{Transactions: []Transaction{
+		{SourceAccountID: 2, DestinationAccountID: 3, Amount: money("50")},
+		{SourceAccountID: 4, DestinationAccountID: 3, Amount: money("150")},
+	}}
+	err = ProcessTransactionBatch(database, &batch, &TransactionBatchRecord{})
+	assert.ErrorIs(t, err, ErrInsufficientBalance)
+
+	account := Account{}
+	err = QueryAccountByAccountId(database, 2, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("100"), account.Balance)
+
+	// A leg may spend money an earlier leg of the same batch brought in
+	batch = TransactionBatch{Transactions: []Transaction{
+		{SourceAccountID: 3, DestinationAccountID: 2, Amount: money("100")},
+		{SourceAccountID: 2, DestinationAccountID: 4, Amount: money("150")},
+	}}
+	err = ProcessTransactionBatch(database, &batch, &TransactionBatchRecord{})
+	assert.NoError(t, err)
+	err = QueryAccountByAccountId(database, 2, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("50"), account.Balance)
+}
+
+func TestHolds(t *testing.T) {
+	forEachStore(t, testHolds)
+}
+
+func testHolds(t *testing.T) {
+	database := postgresDatabase(t)
+
+	err := CreateAccount(database, &Account{AccountID: 1, Balance: money("100")})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 2, Balance: money("0")})
+	assert.NoError(t, err)
+
+	hold := Hold{}
+	err = CreateHold(database, &HoldRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("60")}, &hold)
+	assert.NoError(t, err)
+	assert.Equal(t, HoldStatusActive, hold.Status)
+
+	// The hold lowers the available balance only, so a transfer of the remaining ledger balance fails
+	account := Account{}
+	err = QueryAccountByAccountId(database, 1, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("100"), account.Balance)
+	assert.Equal(t, money("40"), account.AvailableBalance)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("50")})
+	assert.ErrorIs(t, err, ErrInsufficientBalance)
+	err = CreateHold(database, &HoldRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("50")}, &Hold{})
+	assert.ErrorIs(t, err, ErrInsufficientBalance)
+
+	// A partial capture transfers part of the hold and releases the rest
+	captureAmount := money("45")
+	record := TransactionRecord{}
+	err = CaptureHold(database, hold.HoldID, &captureAmount, &hold, &record)
+	assert.NoError(t, err)
+	assert.Equal(t, HoldStatusCaptured, hold.Status)
+	assert.Equal(t, record.TransactionID, *hold.TransactionID)
+	err = QueryAccountByAccountId(database, 1, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("55"), account.Balance)
+	assert.Equal(t, money("55"), account.AvailableBalance)
+	err = CaptureHold(database, hold.HoldID, nil, &hold, &record)
+	assert.ErrorIs(t, err, ErrHoldNotActive)
+
+	// Voiding releases the funds without a transfer
+	err = CreateHold(database, &HoldRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("10")}, &hold)
+	assert.NoError(t, err)
+	err = VoidHold(database, hold.HoldID, &hold)
+	assert.NoError(t, err)
+	assert.Equal(t, HoldStatusVoided, hold.Status)
+
+	// Expired holds are released by ExpireHolds
+	err = CreateHold(database, &HoldRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("20")}, &hold)
+	assert.NoError(t, err)
+	_, err = database.Exec("UPDATE holds SET expires_at = CURRENT_TIMESTAMP - INTERVAL '1 minute' WHERE id = $1", hold.HoldID)
+	assert.NoError(t, err)
+	expired, err := ExpireHolds(database, 100)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	err = QueryAccountByAccountId(database, 1, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("55"), account.AvailableBalance)
+}
+
+func TestReverseTransaction(t *testing.T) {
+	forEachStore(t, testReverseTransaction)
+}
+
+func testReverseTransaction(t *testing.T) {
+	database := postgresDatabase(t)
+
+	err := CreateAccount(database, &Account{AccountID: 1, Balance: money("100")})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 2, Balance: money("0")})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 3, Balance: money("0")})
+	assert.NoError(t, err)
+
+	original := TransactionRecord{}
+	err = ProcessTransactionWithIdempotencyKey(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("60")}, nil, &original)
+	assert.NoError(t, err)
+
+	// A partial reversal is linked to the original transfer
+	partial := money("25")
+	reversal := TransactionRecord{}
+	err = ReverseTransaction(database, original.TransactionID, &partial, &reversal)
+	assert.NoError(t, err)
+	assert.Equal(t, original.TransactionID, *reversal.ReversalOf)
+	assert.Equal(t, 2, reversal.SourceAccountID)
+	assert.Equal(t, 1, reversal.DestinationAccountID)
+	assert.Equal(t, money("65"), reversal.DestinationBalanceAfter)
+
+	// Reversals cannot add up to more than the original, nor be reversed themselves
+	tooMuch := money("35.01")
+	err = ReverseTransaction(database, original.TransactionID, &tooMuch, &TransactionRecord{})
+	assert.ErrorIs(t, err, ErrReversalExceedsTransfer)
+	err = ReverseTransaction(database, reversal.TransactionID, nil, &TransactionRecord{})
+	assert.ErrorIs(t, err, ErrReversalOfReversal)
+
+	// The destination has spent the money, so the rest cannot be reversed
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 2, DestinationAccountID: 3, Amount: money("30")})
+	assert.NoError(t, err)
+	err = ReverseTransaction(database, original.TransactionID, nil, &TransactionRecord{})
+	assert.ErrorIs(t, err, ErrReversalInsufficientBalance)
+
+	// Once the money is back, the rest of the original is reversed in full
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 3, DestinationAccountID: 2, Amount: money("30")})
+	assert.NoError(t, err)
+	err = ReverseTransaction(database, original.TransactionID, nil, &reversal)
+	assert.NoError(t, err)
+	assert.Equal(t, money("35"), reversal.Amount)
+	account := Account{}
+	err = QueryAccountByAccountId(database, 1, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("100"), account.Balance)
+	err = ReverseTransaction(database, original.TransactionID, nil, &TransactionRecord{})
+	assert.ErrorIs(t, err, ErrReversalExceedsTransfer)
 
-	var transactionNetBalance float64
-	err = row.Scan(&transactionNetBalance)
+	// The fee of the original is not refunded and the reversal is not charged one
+	err = CreateAccount(database, &Account{AccountID: 99, Balance: money("0")})
+	assert.NoError(t, err)
+	err = UpsertFeeSchedule(database, &FeeSchedule{Currency: "USD", RevenueAccountID: 99, Tiers: FeeTiers{{Flat: money("2")}}})
+	assert.NoError(t, err)
+	err = ProcessTransactionWithIdempotencyKey(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("50")}, nil, &original)
+	assert.NoError(t, err)
+	reversal = TransactionRecord{}
+	err = ReverseTransaction(database, original.TransactionID, nil, &reversal)
+	assert.NoError(t, err)
+	assert.Nil(t, reversal.Fee)
+	err = QueryAccountByAccountId(database, 1, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("98"), account.Balance)
+	err = QueryAccountByAccountId(database, 99, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("2"), account.Balance)
+}
+
+func TestAccountStatus(t *testing.T) {
+	forEachStore(t, testAccountStatus)
+}
+
+func testAccountStatus(t *testing.T) {
+	database := postgresDatabase(t)
+
+	err := CreateAccount(database, &Account{AccountID: 1, Balance: money("100")})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 2, Balance: money("0")})
+	assert.NoError(t, err)
+
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("10")})
+	assert.NoError(t, err)
+
+	// A frozen account cannot send money but can still receive it
+	account := Account{}
+	err = ChangeAccountStatus(database, 1, &AccountStatusChange{Status: AccountStatusFrozen, Reason: "compliance review"}, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, AccountStatusFrozen, account.Status)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("10")})
+	assert.ErrorIs(t, err, ErrAccountFrozen)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 2, DestinationAccountID: 1, Amount: money("5")})
+	assert.NoError(t, err)
+	err = ChangeAccountStatus(database, 1, &AccountStatusChange{Status: AccountStatusClosed, Reason: "closing"}, &account)
+	assert.ErrorIs(t, err, ErrInvalidStatusTransition)
+
+	err = ChangeAccountStatus(database, 1, &AccountStatusChange{Status: AccountStatusActive, Reason: "review cleared"}, &account)
+	assert.NoError(t, err)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("10")})
+	assert.NoError(t, err)
+
+	// Only an empty account can be closed, and a closed account can neither send nor receive
+	err = ChangeAccountStatus(database, 2, &AccountStatusChange{Status: AccountStatusClosed, Reason: "customer request"}, &account)
+	assert.ErrorIs(t, err, ErrAccountNotEmpty)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 2, DestinationAccountID: 1, Amount: money("15")})
+	assert.NoError(t, err)
+	err = ChangeAccountStatus(database, 2, &AccountStatusChange{Status: AccountStatusClosed, Reason: "customer request"}, &account)
+	assert.NoError(t, err)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("10")})
+	assert.ErrorIs(t, err, ErrAccountClosed)
+	err = ChangeAccountStatus(database, 2, &AccountStatusChange{Status: AccountStatusActive, Reason: "reopen"}, &account)
+	assert.ErrorIs(t, err, ErrInvalidStatusTransition)
+
+	var changes []AccountStatusChange
+	err = QueryAccountStatusChanges(database, 1, &changes)
+	assert.NoError(t, err)
+	assert.Len(t, changes, 2)
+	assert.Equal(t, "compliance review", changes[0].Reason)
+	assert.Equal(t, AccountStatusActive, changes[0].FromStatus)
+}
+
+func TestOverdraft(t *testing.T) {
+	forEachStore(t, testOverdraft)
+}
+
+func testOverdraft(t *testing.T) {
+	database := postgresDatabase(t)
+
+	err := CreateAccount(database, &Account{AccountID: 1, Balance: money("100")})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 2, Balance: money("0")})
+	assert.NoError(t, err)
+
+	// The account may spend up to its overdraft limit beyond its balance
+	account := Account{}
+	err = SetOverdraft(database, 1, &OverdraftSettings{OverdraftLimit: money("50")}, &account)
+	assert.NoError(t, err)
+	assert.True(t, account.CanSpend(money("150")))
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("150.01")})
+	assert.ErrorIs(t, err, ErrInsufficientBalance)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("130")})
+	assert.NoError(t, err)
+	err = QueryAccountByAccountId(database, 1, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("-30"), account.Balance)
+	assert.Equal(t, money("50"), account.OverdraftLimit)
+
+	// The limit cannot be lowered below what is already overdrawn
+	err = SetOverdraft(database, 1, &OverdraftSettings{OverdraftLimit: money("20")}, &account)
+	assert.ErrorIs(t, err, ErrOverdraftBelowBalance)
+
+	// Settlement accounts can go negative without limit
+	err = SetOverdraft(database, 2, &OverdraftSettings{Unlimited: true}, &account)
+	assert.NoError(t, err)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 2, DestinationAccountID: 1, Amount: money("1000")})
+	assert.NoError(t, err)
+	err = QueryAccountByAccountId(database, 2, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("-870"), account.Balance)
+}
+
+func TestTransferLimits(t *testing.T) {
+	forEachStore(t, testTransferLimits)
+}
+
+func testTransferLimits(t *testing.T) {
+	database := postgresDatabase(t)
+
+	err := CreateAccount(database, &Account{AccountID: 1, Balance: money("1000"), AccountType: "retail"})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 2, Balance: money("0")})
+	assert.NoError(t, err)
+
+	accountType := "retail"
+	maxPerTransaction := money("100")
+	maxPerDay := money("150")
+	err = UpsertTransferLimitPolicy(database, &TransferLimitPolicy{AccountType: &accountType, Currency: "USD", MaxPerTransaction: &maxPerTransaction, MaxPerDay: &maxPerDay})
+	assert.NoError(t, err)
+	accountID := 1
+	maxTransfersPerHour := 2
+	err = UpsertTransferLimitPolicy(database, &TransferLimitPolicy{AccountID: &accountID, MaxTransfersPerHour: &maxTransfersPerHour})
+	assert.NoError(t, err)
+
+	// Both the account type policy and the account policy apply
+	var limitErr *LimitExceededError
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("100.01")})
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, LimitMaxPerTransaction, limitErr.Limit)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("100")})
+	assert.NoError(t, err)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("60")})
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, LimitMaxPerDay, limitErr.Limit)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("50")})
+	assert.NoError(t, err)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("0.01")})
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, LimitMaxTransfersPerHour, limitErr.Limit)
+	assert.True(t, limitErr.IsVelocityLimit())
+
+	// Accounts of other types are not limited
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 2, DestinationAccountID: 1, Amount: money("150")})
+	assert.NoError(t, err)
+
+	policy := TransferLimitPolicy{AccountType: &accountType, Currency: "USD"}
+	err = QueryTransferLimitPolicy(database, &policy)
+	assert.NoError(t, err)
+	assert.Equal(t, money("150"), *policy.MaxPerDay)
+	assert.Nil(t, policy.MaxPer30Days)
+
+	// The policy of an account type only applies to its accounts in the currency of the policy
+	err = CreateAccount(database, &Account{AccountID: 3, Balance: money("100000"), Currency: "JPY", AccountType: "retail"})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 4, Balance: money("0"), Currency: "JPY"})
+	assert.NoError(t, err)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 3, DestinationAccountID: 4, Amount: money("5000")})
+	assert.NoError(t, err)
+	maxPerTransaction = money("10000")
+	err = UpsertTransferLimitPolicy(database, &TransferLimitPolicy{AccountType: &accountType, Currency: "JPY", MaxPerTransaction: &maxPerTransaction})
+	assert.NoError(t, err)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 3, DestinationAccountID: 4, Amount: money("10001")})
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, "10000", limitErr.Max)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 3, DestinationAccountID: 4, Amount: money("10000")})
+	assert.NoError(t, err)
+	err = QueryTransferLimitPolicy(database, &policy)
+	assert.NoError(t, err)
+	assert.Equal(t, money("100"), *policy.MaxPerTransaction)
+
+	// The policy of an account is in the currency of the account
+	accountID = 3
+	err = UpsertTransferLimitPolicy(database, &TransferLimitPolicy{AccountID: &accountID, Currency: "USD", MaxPerDay: &maxPerDay})
+	assert.ErrorIs(t, err, ErrCurrencyMismatch)
+	err = UpsertTransferLimitPolicy(database, &TransferLimitPolicy{AccountID: &accountID, MaxPerDay: &maxPerDay})
+	assert.NoError(t, err)
+}
+
+func TestTransferFees(t *testing.T) {
+	forEachStore(t, testTransferFees)
+}
+
+func testTransferFees(t *testing.T) {
+	database := postgresDatabase(t)
+
+	err := CreateAccount(database, &Account{AccountID: 1, Balance: money("100")})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 2, Balance: money("0")})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 99, Balance: money("0")})
+	assert.NoError(t, err)
+
+	minFee := money("1")
+	schedule := FeeSchedule{
+		Currency:         "USD",
+		RevenueAccountID: 99,
+		Tiers:            FeeTiers{{Flat: money("0.5"), Percentage: Rate(100000000)}},
+		MinFee:           &minFee,
+	}
+	err = UpsertFeeSchedule(database, &schedule)
+	assert.NoError(t, err)
+
+	// 0.50 flat plus 1% of 50.00
+	record := TransactionRecord{}
+	err = ProcessTransactionWithIdempotencyKey(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("50")}, nil, &record)
+	assert.NoError(t, err)
+	assert.NotNil(t, record.Fee)
+	assert.Equal(t, money("1"), record.Fee.Amount)
+	assert.Equal(t, money("0.5"), record.Fee.PercentageAmount)
+	assert.Equal(t, money("49"), record.SourceBalanceAfter)
+
+	// The fee is stored with the transfer and paid to the revenue account in the same journal entry
+	stored := TransactionRecord{}
+	err = QueryTransactionById(database, record.TransactionID, &stored)
+	assert.NoError(t, err)
+	assert.Equal(t, record.Fee.Amount, stored.Fee.Amount)
+	account := Account{}
+	err = QueryAccountByAccountId(database, 99, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("1"), account.Balance)
+	var entries []JournalEntry
+	err = QueryJournalEntriesByTransactionId(database, record.TransactionID, &entries)
+	assert.NoError(t, err)
+	assert.Len(t, entries[0].Postings, 4)
+
+	// The source has to be able to pay the fee on top of the amount
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("48.50")})
+	assert.ErrorIs(t, err, ErrInsufficientBalance)
+
+	// Transfers out of the revenue account are not charged
+	err = ProcessTransactionWithIdempotencyKey(database, &Transaction{SourceAccountID: 99, DestinationAccountID: 2, Amount: money("1")}, nil, &record)
+	assert.NoError(t, err)
+	assert.Nil(t, record.Fee)
+
+	// Every leg of a batch is charged like a single transfer
+	batch := TransactionBatch{Transactions: []Transaction{
+		{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("10")},
+		{SourceAccountID: 2, DestinationAccountID: 1, Amount: money("20")},
+	}}
+	batchRecord := TransactionBatchRecord{}
+	err = ProcessTransactionBatch(database, &batch, &batchRecord)
+	assert.NoError(t, err)
+	for _, leg := range batchRecord.Transactions {
+		assert.NotNil(t, leg.Fee)
+		assert.Equal(t, money("1"), leg.Fee.Amount)
+	}
+	err = QueryAccountByAccountId(database, 99, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("2"), account.Balance)
+
+	// A leg has to be able to pay its fee on top of the amount, 57.00 plus 1.07 is more than the 58.00 left
+	batch = TransactionBatch{Transactions: []Transaction{{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("57")}}}
+	err = ProcessTransactionBatch(database, &batch, &TransactionBatchRecord{})
+	assert.ErrorIs(t, err, ErrInsufficientBalance)
+
+	// The fee counts towards the transfer limits, 9.50 plus 1.00 is more than 10.00
+	accountID := 1
+	maxPerTransaction := money("10")
+	err = UpsertTransferLimitPolicy(database, &TransferLimitPolicy{AccountID: &accountID, MaxPerTransaction: &maxPerTransaction})
+	assert.NoError(t, err)
+	var limitErr *LimitExceededError
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("9.5")})
+	assert.True(t, errors.As(err, &limitErr))
+	assert.Equal(t, LimitMaxPerTransaction, limitErr.Limit)
+
+	// A closed revenue account is not reported as the destination of the transfer
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 99, DestinationAccountID: 2, Amount: money("2")})
+	assert.NoError(t, err)
+	err = ChangeAccountStatus(database, 99, &AccountStatusChange{Status: AccountStatusClosed, Reason: "retired"}, &account)
+	assert.NoError(t, err)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 2, DestinationAccountID: 1, Amount: money("5")})
+	assert.ErrorIs(t, err, ErrRevenueAccountClosed)
+	assert.NotErrorIs(t, err, ErrAccountClosed)
+}
+
+func TestInterest(t *testing.T) {
+	forEachStore(t, testInterest)
+}
+
+func testInterest(t *testing.T) {
+	database := postgresDatabase(t)
+
+	err := CreateAccount(database, &Account{AccountID: 1, Balance: money("1000")})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 99, Balance: money("0")})
+	assert.NoError(t, err)
+	err = SetOverdraft(database, 99, &OverdraftSettings{Unlimited: true}, &Account{})
+	assert.NoError(t, err)
+
+	rate, err := ParseRate("0.0365")
+	assert.NoError(t, err)
+	err = SetInterestRate(database, &InterestRate{AccountID: 1, AnnualRate: rate, ExpenseAccountID: 99})
+	assert.NoError(t, err)
+
+	// Accruing the same day twice records a single accrual
+	today := time.Now()
+	accrued, err := AccrueInterest(database, today)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, accrued)
+	accrued, err = AccrueInterest(database, today)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, accrued)
+	var accruals []InterestAccrual
+	err = QueryInterestAccruals(database, 1, &accruals)
+	assert.NoError(t, err)
+	assert.Len(t, accruals, 1)
+	assert.Equal(t, "0.1000000000000", accruals[0].Amount)
+
+	// Posting pays the accrued interest from the expense account once
+	tomorrow := today.AddDate(0, 0, 1)
+	record := TransactionRecord{}
+	err = PostInterest(database, 1, tomorrow, &record)
+	assert.NoError(t, err)
+	assert.Equal(t, 99, record.SourceAccountID)
+	assert.Equal(t, money("0.1"), record.Amount)
+	assert.Equal(t, money("1000.1"), record.DestinationBalanceAfter)
+	err = PostInterest(database, 1, tomorrow, &record)
+	assert.ErrorIs(t, err, ErrNoInterestToPost)
+	err = QueryInterestAccruals(database, 1, &accruals)
+	assert.NoError(t, err)
+	assert.Equal(t, record.TransactionID, *accruals[0].TransactionID)
+
+	// The days that were missed are caught up, each once
+	accrued, err = AccrueMissingInterest(database, today.AddDate(0, 0, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, accrued)
+	accrued, err = AccrueMissingInterest(database, today.AddDate(0, 0, 3))
+	assert.NoError(t, err)
+	assert.Equal(t, 0, accrued)
+
+	// 3 days of 0.10001 are paid as 0.30, and what was rounded off is added to the next posting
+	err = PostInterest(database, 1, today.AddDate(0, 0, 4), &record)
+	assert.NoError(t, err)
+	assert.Equal(t, money("0.3"), record.Amount)
+	assert.Equal(t, "0.0000300000000", *record.RoundingRemainder)
+	accrued, err = AccrueMissingInterest(database, today.AddDate(0, 0, 6))
+	assert.NoError(t, err)
+	assert.Equal(t, 3, accrued)
+	err = PostInterest(database, 1, today.AddDate(0, 0, 7), &record)
+	assert.NoError(t, err)
+	assert.Equal(t, money("0.3"), record.Amount)
+	assert.Equal(t, "0.0001500000000", *record.RoundingRemainder)
+}
+
+func TestScheduledTransfers(t *testing.T) {
+	forEachStore(t, testScheduledTransfers)
+}
+
+func testScheduledTransfers(t *testing.T) {
+	database := postgresDatabase(t)
+
+	err := CreateAccount(database, &Account{AccountID: 1, Balance: money("100")})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 2, Balance: money("0")})
+	assert.NoError(t, err)
+
+	// Nothing is executed before it is due
+	later := ScheduledTransfer{}
+	err = CreateScheduledTransfer(database, &ScheduledTransferRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("10"), ExecuteAt: time.Now().Add(time.Hour)}, &later)
+	assert.NoError(t, err)
+	err = ExecuteDueScheduledTransfer(database, &ScheduledTransfer{})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	due := ScheduledTransfer{}
+	err = CreateScheduledTransfer(database, &ScheduledTransferRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("60"), ExecuteAt: time.Now().Add(-time.Second)}, &due)
+	assert.NoError(t, err)
+	tooLarge := ScheduledTransfer{}
+	err = CreateScheduledTransfer(database, &ScheduledTransferRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("60"), ExecuteAt: time.Now().Add(-time.Second)}, &tooLarge)
+	assert.NoError(t, err)
+
+	// The first one succeeds, the second one fails for lack of funds and is retried later
+	executed := ScheduledTransfer{}
+	err = ExecuteDueScheduledTransfer(database, &executed)
+	assert.NoError(t, err)
+	assert.Equal(t, due.ScheduledTransferID, executed.ScheduledTransferID)
+	assert.Equal(t, ScheduledTransferStatusSucceeded, executed.Status)
+	assert.NotNil(t, executed.TransactionID)
+	err = ExecuteDueScheduledTransfer(database, &executed)
+	assert.NoError(t, err)
+	assert.Equal(t, tooLarge.ScheduledTransferID, executed.ScheduledTransferID)
+	assert.Equal(t, ScheduledTransferStatusPending, executed.Status)
+	assert.Equal(t, 1, executed.Attempts)
+	assert.NotNil(t, executed.LastError)
+	err = ExecuteDueScheduledTransfer(database, &ScheduledTransfer{})
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	account := Account{}
+	err = QueryAccountByAccountId(database, 1, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("40"), account.Balance)
+
+	// Only pending transfers can be cancelled
+	err = CancelScheduledTransfer(database, tooLarge.ScheduledTransferID, &executed)
+	assert.NoError(t, err)
+	assert.Equal(t, ScheduledTransferStatusCancelled, executed.Status)
+	err = CancelScheduledTransfer(database, due.ScheduledTransferID, &executed)
+	assert.ErrorIs(t, err, ErrScheduledTransferNotPending)
+
+	accountID := 1
+	var transfers []ScheduledTransfer
+	err = QueryScheduledTransfers(database, ScheduledTransferFilter{AccountID: &accountID, Status: ScheduledTransferStatusPending, Limit: 10}, &transfers)
+	assert.NoError(t, err)
+	assert.Len(t, transfers, 1)
+	assert.Equal(t, later.ScheduledTransferID, transfers[0].ScheduledTransferID)
+}
+
+func TestStandingOrders(t *testing.T) {
+	forEachStore(t, testStandingOrders)
+}
+
+func testStandingOrders(t *testing.T) {
+	database := postgresDatabase(t)
+
+	err := CreateAccount(database, &Account{AccountID: 1, Balance: money("15")})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 2, Balance: money("0")})
+	assert.NoError(t, err)
+
+	// Three weekly occurrences, the first two of which are already due
+	maxOccurrences := 3
+	order := StandingOrder{}
+	err = CreateStandingOrder(database, &StandingOrderRequest{
+		SourceAccountID:       1,
+		DestinationAccountID:  2,
+		Amount:                money("10"),
+		Frequency:             FrequencyWeekly,
+		StartAt:               time.Now().AddDate(0, 0, -8),
+		MaxOccurrences:        &maxOccurrences,
+		BusinessDayAdjustment: BusinessDayNone,
+	}, &order)
+	assert.NoError(t, err)
+	assert.Equal(t, StandingOrderStatusActive, order.Status)
+
+	// The second occurrence fails for lack of funds and is not retried
+	execution := StandingOrderExecution{}
+	err = ExecuteDueStandingOrder(database, &execution)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, execution.Occurrence)
+	assert.Equal(t, StandingOrderExecutionSucceeded, execution.Status)
+	err = ExecuteDueStandingOrder(database, &execution)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, execution.Occurrence)
+	assert.Equal(t, StandingOrderExecutionFailed, execution.Status)
+	err = ExecuteDueStandingOrder(database, &execution)
+	assert.ErrorIs(t, err, sql.ErrNoRows)
+
+	err = QueryStandingOrderById(database, order.StandingOrderID, &order)
+	assert.NoError(t, err)
+	assert.Equal(t, 2, order.Occurrences)
+	assert.True(t, order.NextExecuteAt.After(time.Now()))
+	var executions []StandingOrderExecution
+	err = QueryStandingOrderExecutions(database, order.StandingOrderID, &executions)
+	assert.NoError(t, err)
+	assert.Len(t, executions, 2)
+	account := Account{}
+	err = QueryAccountByAccountId(database, 1, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("5"), account.Balance)
+
+	err = CancelStandingOrder(database, order.StandingOrderID, &order)
+	assert.NoError(t, err)
+	assert.Equal(t, StandingOrderStatusCancelled, order.Status)
+	err = CancelStandingOrder(database, order.StandingOrderID, &order)
+	assert.ErrorIs(t, err, ErrStandingOrderNotActive)
+}
+
+func TestTransferApprovals(t *testing.T) {
+	forEachStore(t, testTransferApprovals)
+}
+
+func testTransferApprovals(t *testing.T) {
+	database := postgresDatabase(t)
+
+	err := CreateAccount(database, &Account{AccountID: 1, Balance: money("1000"), Currency: "EUR"})
+	assert.NoError(t, err)
+	err = CreateAccount(database, &Account{AccountID: 2, Balance: money("0"), Currency: "EUR"})
+	assert.NoError(t, err)
+
+	policy := ApprovalPolicy{Currency: "EUR", Threshold: money("100"), TTLSeconds: 3600}
+	err = UpsertApprovalPolicy(database, &policy)
+	assert.NoError(t, err)
+	assert.True(t, policy.RequiresApproval(money("100.01")))
+	assert.False(t, policy.RequiresApproval(money("100")))
+
+	transaction := Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("500")}
+	approval := TransferApproval{}
+	err = CreateTransferApproval(database, &transaction, "alice", &policy, nil, &approval)
+	assert.NoError(t, err)
+	assert.Equal(t, TransferApprovalStatusPending, approval.Status)
+	assert.Equal(t, Currency("EUR"), approval.Currency)
+
+	// The requester cannot approve their own transfer
+	record := TransactionRecord{}
+	err = ApproveTransfer(database, approval.TransferApprovalID, "alice", &ApprovalDecision{}, &approval, &record)
+	assert.ErrorIs(t, err, ErrSelfApproval)
+
+	err = ApproveTransfer(database, approval.TransferApprovalID, "bob", &ApprovalDecision{Reason: "checked"}, &approval, &record)
+	assert.NoError(t, err)
+	assert.Equal(t, TransferApprovalStatusApproved, approval.Status)
+	assert.Equal(t, record.TransactionID, *approval.TransactionID)
+	account := Account{}
+	err = QueryAccountByAccountId(database, 2, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("500"), account.Balance)
+
+	err = ApproveTransfer(database, approval.TransferApprovalID, "bob", &ApprovalDecision{}, &approval, &record)
+	assert.ErrorIs(t, err, ErrTransferApprovalNotPending)
+
+	// A rejected transfer moves no money
+	err = CreateTransferApproval(database, &transaction, "alice", &policy, nil, &approval)
+	assert.NoError(t, err)
+	err = RejectTransfer(database, approval.TransferApprovalID, "bob", &ApprovalDecision{}, &approval)
+	assert.NoError(t, err)
+	assert.Equal(t, TransferApprovalStatusRejected, approval.Status)
+	err = QueryAccountByAccountId(database, 2, &account)
+	assert.NoError(t, err)
+	assert.Equal(t, money("500"), account.Balance)
+
+	// No other way of moving money gets around the approval
+	err = ProcessTransaction(database, &transaction)
+	assert.ErrorIs(t, err, ErrApprovalRequired)
+	batch := TransactionBatch{Transactions: []Transaction{transaction}}
+	err = ProcessTransactionBatch(database, &batch, &TransactionBatchRecord{})
+	assert.ErrorIs(t, err, ErrApprovalRequired)
+	err = CreateHold(database, &HoldRequest{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("500")}, &Hold{})
+	assert.ErrorIs(t, err, ErrApprovalRequired)
+	err = CreateScheduledTransfer(database, &ScheduledTransferRequest{SourceAccountID: 1, DestinationAccountID: 2,
+		Amount: money("500"), ExecuteAt: time.Now().Add(time.Hour)}, &ScheduledTransfer{})
+	assert.ErrorIs(t, err, ErrApprovalRequired)
+	err = ProcessTransaction(database, &Transaction{SourceAccountID: 1, DestinationAccountID: 2, Amount: money("100")})
+	assert.NoError(t, err)
+
+	// A transfer left waiting past its TTL expires
+	policy.TTLSeconds = 1
+	err = CreateTransferApproval(database, &transaction, "alice", &policy, nil, &approval)
+	assert.NoError(t, err)
+	time.Sleep(1100 * time.Millisecond)
+	err = ApproveTransfer(database, approval.TransferApprovalID, "bob", &ApprovalDecision{}, &approval, &record)
+	assert.ErrorIs(t, err, ErrTransferApprovalNotPending)
+	expired, err := ExpireTransferApprovals(database)
+	assert.NoError(t, err)
+	assert.Equal(t, 1, expired)
+	var approvals []TransferApproval
+	err = QueryTransferApprovals(database, TransferApprovalStatusExpired, 10, &approvals)
+	assert.NoError(t, err)
+	assert.Len(t, approvals, 1)
+}
+
+func TestMigrations(t *testing.T) {
+	ctx := context.Background()
+	database, err := CreatePostgresContainer(ctx)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer database.Close()
+
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+	latest := migrations[len(migrations)-1].Version
+	version, err := MigrationVersion(ctx, database)
+	assert.NoError(t, err)
+	assert.Equal(t, latest, version)
+
+	// Instances starting at once apply nothing twice
+	var wg sync.WaitGroup
+	for i := 0; i < 3; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			applied, err := MigrateUp(ctx, database)
+			assert.NoError(t, err)
+			assert.Empty(t, applied)
+		}()
+	}
+	wg.Wait()
+
+	// Every migration can be reverted and applied again
+	reverted, err := MigrateDown(ctx, database, len(migrations))
+	assert.NoError(t, err)
+	assert.Len(t, reverted, len(migrations))
+	version, err = MigrationVersion(ctx, database)
+	assert.NoError(t, err)
+	assert.Equal(t, 0, version)
+	applied, err := MigrateUp(ctx, database)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(migrations))
+	err = CreateAccount(database, &Account{AccountID: 1, Balance: money("1")})
+	assert.NoError(t, err)
+}
+
+func TestMigrationsFromInitSQL(t *testing.T) {
+	ctx := context.Background()
+	database, err := createEmptyPostgresContainer(ctx)
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer database.Close()
+
+	// A database created by the former db/init.sql, which is the first migration, with accounts and transfers in it
+	migrations, err := Migrations()
+	assert.NoError(t, err)
+	_, err = database.Exec(migrations[0].Up)
+	assert.NoError(t, err)
+	_, err = database.Exec(`
+    INSERT INTO account_balance (account_id, balance) VALUES (1, 70.50), (2, 29.50);
+    INSERT INTO account_transactions (account_transfer_out, account_transfer_in, amount) VALUES (1, 2, 20.00), (2, 1, 0.50);
+`)
+	assert.NoError(t, err)
+
+	// It is recognized as being at version 1 and every later migration is applied to it
+	applied, err := MigrateUp(ctx, database)
+	assert.NoError(t, err)
+	assert.Len(t, applied, len(migrations)-1)
+	assert.Equal(t, migrations[1].Version, applied[0])
+
+	// The existing transfers got the balances they left, and the balances were carried into the ledger
+	var record TransactionRecord
+	err = QueryTransactionById(database, 1, &record)
+	assert.NoError(t, err)
+	assert.Equal(t, money("70"), record.SourceBalanceAfter)
+	assert.Equal(t, money("30"), record.DestinationBalanceAfter)
+	assert.Equal(t, money("20"), record.DestinationAmount)
+	assert.Equal(t, Currency("USD"), record.DestinationCurrency)
+	for accountID, balance := range map[int]Money{1: money("70.5"), 2: money("29.5")} {
+		ledgerBalance, err := QueryLedgerBalance(database, accountID)
+		assert.NoError(t, err)
+		assert.Equal(t, balance, ledgerBalance)
+	}
+	corrected, err := RebuildAccountBalances(database)
 	assert.NoError(t, err)
-	assert.Equal(t, balance1, 1000+transactionNetBalance)
+	assert.Empty(t, corrected)
 
-	// Check that the account balance for account 2 sum up to transaction table
-	row = database.QueryRow(query, 2)
-	err = row.Scan(&transactionNetBalance)
+	// The server works with it as with a database it created
+	store = NewPostgresStore(database)
+	response := serve("POST", "/transactions", `{"source_account_id": 1, "destination_account_id": 2, "amount": "70.5"}`, nil)
+	assert.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	response = serve("POST", "/transactions", `{"source_account_id": 1, "destination_account_id": 2, "amount": "0.01"}`, nil)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "insufficient_funds", problemCode(t, response))
+	response = serve("POST", "/accounts", `{"account_id": 3, "balance": "1.5", "currency": "EUR"}`, nil)
+	assert.Equal(t, http.StatusCreated, response.Code, response.Body.String())
+	account := Account{}
+	err = store.QueryAccountByAccountId(2, &account)
 	assert.NoError(t, err)
-	assert.Equal(t, balance2, 1000+transactionNetBalance)
+	assert.Equal(t, money("100"), account.Balance)
+	assert.Equal(t, AccountStatusActive, account.Status)
 
-	// Check that the account balance for account 3 sum up to transaction table
-	row = database.QueryRow(query, 3)
-	err = row.Scan(&transactionNetBalance)
+	// And every migration can be reverted back to the former schema
+	reverted, err := MigrateDown(ctx, database, len(migrations)-1)
 	assert.NoError(t, err)
-	assert.Equal(t, balance3, 1000+transactionNetBalance)
+	assert.Len(t, reverted, len(migrations)-1)
 }
@@ -0,0 +1,333 @@
+package config
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Redacted replaces secrets when the configuration is printed
+const Redacted = "REDACTED"
+
+// Config is everything the server can be configured with. It is built from the defaults, then the config file if
+// there is one, then the environment variables, each overriding the one before.
+type Config struct {
+	Storage      Storage      `json:"storage" yaml:"storage"`
+	Database     Database     `json:"database" yaml:"database"`
+	Server       Server       `json:"server" yaml:"server"`
+	Transactions Transactions `json:"transactions" yaml:"transactions"`
+}
+
+const (
+	BackendPostgres = "postgres"
+	// BackendMemory keeps the accounts and transfers in memory only, the other features are not available
+	BackendMemory = "memory"
+	// BackendSQLite keeps the accounts and transfers in the SQLite file at SQLitePath, the other features are not
+	// available
+	BackendSQLite = "sqlite"
+)
+
+// Storage selects where the accounts and transfers are stored
+type Storage struct {
+	Backend    string `json:"backend" yaml:"backend"`
+	SQLitePath string `json:"sqlite_path" yaml:"sqlite_path"`
+}
+
+// Database is how to connect to Postgres. DSN, if set, is used instead of the separate connection fields.
+// AutoMigrate applies the pending schema migrations on startup, without it they are applied with the migrate command.
+type Database struct {
+	Host            string   `json:"host" yaml:"host"`
+	Port            int      `json:"port" yaml:"port"`
+	User            string   `json:"user" yaml:"user"`
+	Password        string   `json:"password" yaml:"password"`
+	Name            string   `json:"name" yaml:"name"`
+	SSLMode         string   `json:"sslmode" yaml:"sslmode"`
+	DSN             string   `json:"dsn" yaml:"dsn"`
+	MaxOpenConns    int      `json:"max_open_conns" yaml:"max_open_conns"`
+	MaxIdleConns    int      `json:"max_idle_conns" yaml:"max_idle_conns"`
+	ConnMaxLifetime Duration `json:"conn_max_lifetime" yaml:"conn_max_lifetime"`
+	AutoMigrate     bool     `json:"auto_migrate" yaml:"auto_migrate"`
+}
+
+// Server is how the HTTP server listens. It serves HTTPS if both TLS files are set. On SIGTERM it has
+// ShutdownTimeout to finish the requests in flight and the background workers before it closes the database.
+type Server struct {
+	ListenAddress     string   `json:"listen_address" yaml:"listen_address"`
+	ReadTimeout       Duration `json:"read_timeout" yaml:"read_timeout"`
+	ReadHeaderTimeout Duration `json:"read_header_timeout" yaml:"read_header_timeout"`
+	WriteTimeout      Duration `json:"write_timeout" yaml:"write_timeout"`
+	IdleTimeout       Duration `json:"idle_timeout" yaml:"idle_timeout"`
+	ShutdownTimeout   Duration `json:"shutdown_timeout" yaml:"shutdown_timeout"`
+	TLSCertFile       string   `json:"tls_cert_file" yaml:"tls_cert_file"`
+	TLSKeyFile        string   `json:"tls_key_file" yaml:"tls_key_file"`
+}
+
+// Transactions is how transfers that fail on a concurrency error are retried
+type Transactions struct {
+	MaxAttempts int `json:"max_attempts" yaml:"max_attempts"`
+}
+
+// Duration is a time.Duration written like "30s" or "1m30s" in the config file and the environment
+type Duration time.Duration
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	duration, err := time.ParseDuration(string(text))
+	if err != nil {
+		return err
+	}
+	*d = Duration(duration)
+	return nil
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(time.Duration(d).String()), nil
+}
+
+// Default is the configuration matching docker-compose.yml
+func Default() Config {
+	return Config{
+		Storage: Storage{
+			Backend:    BackendPostgres,
+			SQLitePath: "bank.db",
+		},
+		Database: Database{
+			Host:            "0.0.0.0",
+			Port:            5432,
+			User:            "myuser",
+			Password:        "mypassword",
+			Name:            "mydb",
+			SSLMode:         "disable",
+			MaxOpenConns:    25,
+			MaxIdleConns:    25,
+			ConnMaxLifetime: Duration(5 * time.Minute),
+			AutoMigrate:     true,
+		},
+		Server: Server{
+			ListenAddress:     ":8080",
+			ReadTimeout:       Duration(15 * time.Second),
+			ReadHeaderTimeout: Duration(5 * time.Second),
+			WriteTimeout:      Duration(30 * time.Second),
+			IdleTimeout:       Duration(2 * time.Minute),
+			ShutdownTimeout:   Duration(30 * time.Second),
+		},
+		Transactions: Transactions{
+			MaxAttempts: 3,
+		},
+	}
+}
+
+// env maps every environment variable to the field it sets
+func (c *Config) env() map[string]interface{} {
+	return map[string]interface{}{
+		"STORAGE_BACKEND":          &c.Storage.Backend,
+		"SQLITE_PATH":              &c.Storage.SQLitePath,
+		"DB_HOST":                  &c.Database.Host,
+		"DB_PORT":                  &c.Database.Port,
+		"DB_USER":                  &c.Database.User,
+		"DB_PASSWORD":              &c.Database.Password,
+		"DB_NAME":                  &c.Database.Name,
+		"DB_SSLMODE":               &c.Database.SSLMode,
+		"DB_DSN":                   &c.Database.DSN,
+		"DB_MAX_OPEN_CONNS":        &c.Database.MaxOpenConns,
+		"DB_MAX_IDLE_CONNS":        &c.Database.MaxIdleConns,
+		"DB_CONN_MAX_LIFETIME":     &c.Database.ConnMaxLifetime,
+		"DB_AUTO_MIGRATE":          &c.Database.AutoMigrate,
+		"LISTEN_ADDRESS":           &c.Server.ListenAddress,
+		"HTTP_READ_TIMEOUT":        &c.Server.ReadTimeout,
+		"HTTP_READ_HEADER_TIMEOUT": &c.Server.ReadHeaderTimeout,
+		"HTTP_WRITE_TIMEOUT":       &c.Server.WriteTimeout,
+		"HTTP_IDLE_TIMEOUT":        &c.Server.IdleTimeout,
+		"HTTP_SHUTDOWN_TIMEOUT":    &c.Server.ShutdownTimeout,
+		"TLS_CERT_FILE":            &c.Server.TLSCertFile,
+		"TLS_KEY_FILE":             &c.Server.TLSKeyFile,
+		"TRANSACTION_MAX_ATTEMPTS": &c.Transactions.MaxAttempts,
+	}
+}
+
+// Load builds the configuration from the defaults, the file at path unless path is empty, and the environment
+// looked up with lookupEnv, then validates it
+func Load(path string, lookupEnv func(string) (string, bool)) (Config, error) {
+	config := Default()
+	if path != "" {
+		err := config.readFile(path)
+		if err != nil {
+			return config, err
+		}
+	}
+	err := config.readEnv(lookupEnv)
+	if err != nil {
+		return config, err
+	}
+	return config, config.Validate()
+}
+
+// readFile reads a YAML or JSON file, chosen by its extension. Unknown keys are an error so that typos do not go unnoticed.
+func (c *Config) readFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("reading config file: %w", err)
+	}
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(c)
+		// An empty file leaves the defaults
+		if errors.Is(err, io.EOF) {
+			err = nil
+		}
+	case ".json":
+		decoder := json.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(c)
+	default:
+		return fmt.Errorf("config file %s must end in .yaml, .yml or .json", path)
+	}
+	if err != nil {
+		return fmt.Errorf("parsing config file %s: %w", path, err)
+	}
+	return nil
+}
+
+// readEnv overrides the fields whose environment variable is set, reporting every malformed variable at once
+func (c *Config) readEnv(lookupEnv func(string) (string, bool)) error {
+	var errs []error
+	for name, field := range c.env() {
+		value, ok := lookupEnv(name)
+		if !ok {
+			continue
+		}
+		var err error
+		switch field := field.(type) {
+		case *string:
+			*field = value
+		case *int:
+			var number int
+			number, err = strconv.Atoi(value)
+			if err == nil {
+				*field = number
+			}
+		case *bool:
+			var flag bool
+			flag, err = strconv.ParseBool(value)
+			if err == nil {
+				*field = flag
+			}
+		case *Duration:
+			err = field.UnmarshalText([]byte(value))
+		}
+		if err != nil {
+			errs = append(errs, fmt.Errorf("environment variable %s: %w", name, err))
+		}
+	}
+	return errors.Join(sortErrors(errs)...)
+}
+
+// Validate reports every invalid field at once
+func (c Config) Validate() error {
+	var errs []error
+	check := func(ok bool, format string, args ...interface{}) {
+		if !ok {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+
+	check(c.Storage.Backend == BackendPostgres || c.Storage.Backend == BackendMemory || c.Storage.Backend == BackendSQLite,
+		"storage.backend must be postgres, memory or sqlite, got %q", c.Storage.Backend)
+	check(c.Storage.Backend != BackendSQLite || c.Storage.SQLitePath != "", "storage.sqlite_path is required with the sqlite backend")
+	if c.Database.DSN == "" {
+		check(c.Database.Host != "", "database.host is required unless database.dsn is set")
+		check(c.Database.Port >= 1 && c.Database.Port <= 65535, "database.port must be between 1 and 65535, got %d", c.Database.Port)
+		check(c.Database.User != "", "database.user is required unless database.dsn is set")
+		check(c.Database.Name != "", "database.name is required unless database.dsn is set")
+		check(sslModes[c.Database.SSLMode], "database.sslmode must be one of disable, allow, prefer, require, verify-ca or verify-full, got %q", c.Database.SSLMode)
+	}
+	check(c.Database.MaxOpenConns >= 1, "database.max_open_conns must be at least 1, got %d", c.Database.MaxOpenConns)
+	check(c.Database.MaxIdleConns >= 0 && c.Database.MaxIdleConns <= c.Database.MaxOpenConns,
+		"database.max_idle_conns must be between 0 and database.max_open_conns, got %d", c.Database.MaxIdleConns)
+	check(c.Database.ConnMaxLifetime >= 0, "database.conn_max_lifetime cannot be negative")
+
+	_, _, err := net.SplitHostPort(c.Server.ListenAddress)
+	check(err == nil, "server.listen_address must be host:port or :port, got %q", c.Server.ListenAddress)
+	check(c.Server.ReadTimeout > 0, "server.read_timeout must be positive")
+	check(c.Server.ReadHeaderTimeout > 0, "server.read_header_timeout must be positive")
+	check(c.Server.WriteTimeout > 0, "server.write_timeout must be positive")
+	check(c.Server.IdleTimeout > 0, "server.idle_timeout must be positive")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdown_timeout must be positive")
+	check((c.Server.TLSCertFile == "") == (c.Server.TLSKeyFile == ""), "server.tls_cert_file and server.tls_key_file must be set together")
+	for name, path := range map[string]string{"server.tls_cert_file": c.Server.TLSCertFile, "server.tls_key_file": c.Server.TLSKeyFile} {
+		if path != "" {
+			_, err = os.Stat(path)
+			check(err == nil, "%s: %v", name, err)
+		}
+	}
+
+	check(c.Transactions.MaxAttempts >= 1 && c.Transactions.MaxAttempts <= 10,
+		"transactions.max_attempts must be between 1 and 10, got %d", c.Transactions.MaxAttempts)
+	return errors.Join(sortErrors(errs)...)
+}
+
+var sslModes = map[string]bool{"disable": true, "allow": true, "prefer": true, "require": true, "verify-ca": true, "verify-full": true}
+
+// sortErrors orders errors by message, so that errors collected from a map are reported the same way every time
+func sortErrors(errs []error) []error {
+	sort.Slice(errs, func(i, j int) bool {
+		return errs[i].Error() < errs[j].Error()
+	})
+	return errs
+}
+
+// DataSourceName is the connection string to open the database with
+func (d Database) DataSourceName() string {
+	if d.DSN != "" {
+		return d.DSN
+	}
+	return fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
+		quoteDSNValue(d.Host), d.Port, quoteDSNValue(d.User), quoteDSNValue(d.Password), quoteDSNValue(d.Name), d.SSLMode)
+}
+
+// quoteDSNValue quotes a key=value connection string value that is empty or has spaces, quotes or backslashes
+func quoteDSNValue(value string) string {
+	if value != "" && !strings.ContainsAny(value, ` '\`) {
+		return value
+	}
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(value) + "'"
+}
+
+var dsnPassword = regexp.MustCompile(`password\s*=\s*('(\\.|[^'])*'|[^\s&]+)`)
+
+// Redact returns a copy of the configuration with the secrets replaced, to be printed or logged
+func (c Config) Redact() Config {
+	if c.Database.Password != "" {
+		c.Database.Password = Redacted
+	}
+	if c.Database.DSN != "" {
+		dsn, err := url.Parse(c.Database.DSN)
+		if err == nil && dsn.User != nil {
+			if _, ok := dsn.User.Password(); ok {
+				dsn.User = url.UserPassword(dsn.User.Username(), Redacted)
+				c.Database.DSN = dsn.String()
+			}
+		}
+		// Key=value connection strings, and URLs with the password as a query parameter
+		c.Database.DSN = dsnPassword.ReplaceAllString(c.Database.DSN, "password="+Redacted)
+	}
+	return c
+}
+
+// YAML formats the configuration the way the config file is written
+func (c Config) YAML() ([]byte, error) {
+	return yaml.Marshal(c)
+}
@@ -0,0 +1,116 @@
+package config
+
+import (
+	"github.com/stretchr/testify/assert"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func env(values map[string]string) func(string) (string, bool) {
+	return func(name string) (string, bool) {
+		value, ok := values[name]
+		return value, ok
+	}
+}
+
+func TestLoad(t *testing.T) {
+	dir := t.TempDir()
+	yamlPath := filepath.Join(dir, "config.yaml")
+	err := os.WriteFile(yamlPath, []byte("database:\n  host: db.internal\n  port: 6543\nserver:\n  write_timeout: 1m\n"), 0o600)
+	assert.NoError(t, err)
+	jsonPath := filepath.Join(dir, "config.json")
+	err = os.WriteFile(jsonPath, []byte(`{"transactions": {"max_attempts": 5}, "server": {"idle_timeout": "10s"}}`), 0o600)
+	assert.NoError(t, err)
+	unknownPath := filepath.Join(dir, "unknown.yaml")
+	err = os.WriteFile(unknownPath, []byte("database:\n  hots: db.internal\n"), 0o600)
+	assert.NoError(t, err)
+
+	t.Run("Defaults", func(t *testing.T) {
+		config, err := Load("", env(nil))
+		assert.NoError(t, err)
+		assert.Equal(t, Default(), config)
+	})
+
+	t.Run("YAML file", func(t *testing.T) {
+		config, err := Load(yamlPath, env(nil))
+		assert.NoError(t, err)
+		assert.Equal(t, "db.internal", config.Database.Host)
+		assert.Equal(t, 6543, config.Database.Port)
+		assert.Equal(t, Duration(time.Minute), config.Server.WriteTimeout)
+		assert.Equal(t, "myuser", config.Database.User)
+	})
+
+	t.Run("JSON file", func(t *testing.T) {
+		config, err := Load(jsonPath, env(nil))
+		assert.NoError(t, err)
+		assert.Equal(t, 5, config.Transactions.MaxAttempts)
+		assert.Equal(t, Duration(10*time.Second), config.Server.IdleTimeout)
+	})
+
+	t.Run("Environment overrides the file", func(t *testing.T) {
+		config, err := Load(yamlPath, env(map[string]string{"DB_PORT": "7000", "HTTP_WRITE_TIMEOUT": "45s", "DB_AUTO_MIGRATE": "false"}))
+		assert.NoError(t, err)
+		assert.Equal(t, "db.internal", config.Database.Host)
+		assert.Equal(t, 7000, config.Database.Port)
+		assert.False(t, config.Database.AutoMigrate)
+		assert.Equal(t, Duration(45*time.Second), config.Server.WriteTimeout)
+	})
+
+	t.Run("Unknown key in the file", func(t *testing.T) {
+		_, err := Load(unknownPath, env(nil))
+		assert.ErrorContains(t, err, "hots")
+	})
+
+	t.Run("Malformed environment variables are all reported", func(t *testing.T) {
+		_, err := Load("", env(map[string]string{"DB_PORT": "x", "HTTP_READ_TIMEOUT": "5", "DB_AUTO_MIGRATE": "maybe"}))
+		assert.ErrorContains(t, err, "DB_PORT")
+		assert.ErrorContains(t, err, "DB_AUTO_MIGRATE")
+		assert.ErrorContains(t, err, "HTTP_READ_TIMEOUT")
+	})
+
+	t.Run("Invalid values are all reported", func(t *testing.T) {
+		_, err := Load("", env(map[string]string{"STORAGE_BACKEND": "mongo", "DB_PORT": "0", "LISTEN_ADDRESS": "8080", "HTTP_SHUTDOWN_TIMEOUT": "0s", "TLS_CERT_FILE": "cert.pem", "TRANSACTION_MAX_ATTEMPTS": "0"}))
+		assert.ErrorContains(t, err, `storage.backend must be postgres, memory or sqlite, got "mongo"`)
+		assert.ErrorContains(t, err, "database.port must be between 1 and 65535, got 0")
+		assert.ErrorContains(t, err, "server.listen_address")
+		assert.ErrorContains(t, err, "server.shutdown_timeout must be positive")
+		assert.ErrorContains(t, err, "server.tls_cert_file and server.tls_key_file must be set together")
+		assert.ErrorContains(t, err, "transactions.max_attempts")
+	})
+}
+
+func TestRedact(t *testing.T) {
+	tests := []struct {
+		name     string
+		dsn      string
+		expected string
+	}{
+		{"URL", "postgres://myuser:secret@db:5432/mydb?sslmode=disable", "postgres://myuser:REDACTED@db:5432/mydb?sslmode=disable"},
+		{"URL with password parameter", "postgres://db/mydb?password=secret&sslmode=disable", "postgres://db/mydb?password=REDACTED&sslmode=disable"},
+		{"Key value", "host=db password=secret dbname=mydb", "host=db password=REDACTED dbname=mydb"},
+		{"Quoted key value", `host=db password='se cr\'et' dbname=mydb`, "host=db password=REDACTED dbname=mydb"},
+		{"No password", "host=db dbname=mydb", "host=db dbname=mydb"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			config := Default()
+			config.Database.DSN = tt.dsn
+			redacted := config.Redact()
+			assert.Equal(t, tt.expected, redacted.Database.DSN)
+			assert.Equal(t, Redacted, redacted.Database.Password)
+			assert.Equal(t, tt.dsn, config.Database.DSN)
+		})
+	}
+}
+
+func TestDataSourceName(t *testing.T) {
+	database := Default().Database
+	database.Password = "it's secret"
+	assert.Equal(t, `host=0.0.0.0 port=5432 user=myuser password='it\'s secret' dbname=mydb sslmode=disable`, database.DataSourceName())
+
+	database.DSN = "postgres://db/mydb"
+	assert.Equal(t, "postgres://db/mydb", database.DataSourceName())
+}
@@ -0,0 +1,76 @@
+package db
+
+import (
+	"database/sql"
+	. "takeHomeAssignment/entities"
+)
+
+var ErrInvalidStatusTransition = newError(KindConflict, "invalid_status_transition", "account cannot change to the requested status")
+var ErrAccountNotEmpty = newError(KindConflict, "account_not_empty", "account can only be closed with a zero balance and no active holds")
+
+// ChangeAccountStatus moves the account to change.Status, records the change with its reason, and fills
+// change and account. The account row is locked, so a transfer in flight either completes before the change
+// or sees the new status.
+func ChangeAccountStatus(DB *sql.DB, accountID int, change *AccountStatusChange, account *Account) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	accounts, err := lockAccounts(dbtx, []int{accountID})
+	if err != nil {
+		return err
+	}
+	locked := accounts[accountID]
+	if !CanChangeAccountStatus(locked.Status, change.Status) {
+		return ErrInvalidStatusTransition
+	}
+	if change.Status == AccountStatusClosed && (locked.Balance != 0 || locked.Held != 0) {
+		return ErrAccountNotEmpty
+	}
+
+	_, err = dbtx.Exec("UPDATE account_balance SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE account_id = $2", change.Status, accountID)
+	if err != nil {
+		return err
+	}
+	change.AccountID = accountID
+	change.FromStatus = locked.Status
+	err = dbtx.QueryRow(`
+    INSERT INTO account_status_changes (account_id, from_status, to_status, reason)
+    VALUES ($1, $2, $3, $4)
+    RETURNING id, created_at
+`, change.AccountID, change.FromStatus, change.Status, change.Reason).Scan(&change.ID, &change.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	locked.Status = change.Status
+	locked.toAccount(account)
+	return dbtx.Commit()
+}
+
+// QueryAccountStatusChanges returns the status changes of the account, oldest first
+func QueryAccountStatusChanges(DB *sql.DB, accountID int, changes *[]AccountStatusChange) error {
+	rows, err := DB.Query(`
+    SELECT id, account_id, from_status, to_status, reason, created_at
+    FROM account_status_changes
+    WHERE account_id = $1
+    ORDER BY id
+`, accountID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	*changes = []AccountStatusChange{}
+	for rows.Next() {
+		change := AccountStatusChange{}
+		err = rows.Scan(&change.ID, &change.AccountID, &change.FromStatus, &change.Status, &change.Reason, &change.CreatedAt)
+		if err != nil {
+			return err
+		}
+		*changes = append(*changes, change)
+	}
+	return rows.Err()
+}
@@ -2,120 +2,460 @@ package db
 
 import (
 	"database/sql"
+	"encoding/json"
 	"errors"
+	"fmt"
+	"github.com/lib/pq"
 	"log"
+	"sort"
 	. "takeHomeAssignment/entities"
 	"time"
 )
 
+var ErrCurrencyMismatch = newError(KindInvalid, "currency_mismatch", "source and destination accounts have different currencies")
+var ErrAmountTooSmallToConvert = newError(KindUnprocessable, "amount_too_small_to_convert", "amount is too small to convert into the destination currency")
+var ErrInsufficientBalance = newError(KindInvalid, "insufficient_funds", "insufficient balance for transaction to happen")
+var ErrAccountFrozen = newError(KindForbidden, "account_frozen", "account is frozen")
+var ErrAccountClosed = newError(KindConflict, "account_closed", "account is closed")
+
 func QueryAccountByAccountId(DB *sql.DB, accountID int, account *Account) error {
-	err := DB.QueryRow("SELECT account_id, balance FROM account_balance WHERE account_id = $1", accountID).Scan(&account.AccountID, &account.Balance)
+	err := DB.QueryRow(`
+    SELECT account_id, balance, balance - held, currency, account_type, status, overdraft_limit, unlimited_overdraft
+    FROM account_balance
+    WHERE account_id = $1
+`, accountID).Scan(&account.AccountID, &account.Balance, &account.AvailableBalance, &account.Currency, &account.AccountType,
+		&account.Status, &account.OverdraftLimit, &account.UnlimitedOverdraft)
 	if err != nil {
-		return err
+		return notFound(err, ErrAccountNotFound)
 	}
 	return nil
 }
 
 func CreateAccount(DB *sql.DB, account *Account) error {
+	return CreateAccountWithIdempotencyKey(DB, account, nil)
+}
+
+// CreateAccountWithIdempotencyKey creates the account and, if idempotencyKey is not nil, stores the key atomically with it
+func CreateAccountWithIdempotencyKey(DB *sql.DB, account *Account, idempotencyKey *IdempotencyKey) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	// Claim the key first so that a concurrent retry waits for us instead of failing on the duplicate account
+	if idempotencyKey != nil {
+		err = insertIdempotencyKey(dbtx, idempotencyKey)
+		if err != nil {
+			return err
+		}
+	}
+
 	var exists bool
 	// Check if account_id exists first before inserting
-	err := DB.QueryRow("SELECT EXISTS (SELECT 1 FROM account_balance WHERE account_id = $1)", account.AccountID).Scan(&exists)
+	err = dbtx.QueryRow("SELECT EXISTS (SELECT 1 FROM account_balance WHERE account_id = $1)", account.AccountID).Scan(&exists)
 	if err != nil {
 		return err
 	}
 	if exists {
-		return errors.New("account ID already exists")
+		return ErrAccountExists
 	}
-	_, err = DB.Exec("INSERT INTO account_balance (account_id, balance) VALUES ($1, $2) RETURNING *", account.AccountID, account.Balance)
+	if account.Currency == "" {
+		account.Currency = DefaultCurrency
+	}
+	if account.AccountType == "" {
+		account.AccountType = DefaultAccountType
+	}
+	err = account.Currency.ValidateAmount(account.Balance)
 	if err != nil {
 		return err
 	}
-	return nil
+	_, err = dbtx.Exec("INSERT INTO account_balance (account_id, balance, currency, account_type) VALUES ($1, $2, $3, $4) RETURNING *", account.AccountID, account.Balance, account.Currency, account.AccountType)
+	if err != nil {
+		return err
+	}
+	account.AvailableBalance = account.Balance
+	account.Status = AccountStatusActive
+
+	// The initial balance is funded from the opening balance system account, so that the balance
+	// in account_balance always equals the sum of the postings to the account
+	if account.Balance != 0 {
+		err = insertJournalEntry(dbtx, &JournalEntry{
+			Description: "opening balance",
+			Postings: []Posting{
+				SystemPosting(SystemAccountOpeningBalance, -account.Balance, account.Currency),
+				AccountPosting(account.AccountID, account.Balance, account.Currency),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return dbtx.Commit()
+}
+
+const transactionColumns = `id, account_transfer_out, account_transfer_in, amount, currency, destination_amount,
+           destination_currency, exchange_rate, rounding_remainder, source_balance_after, destination_balance_after,
+           batch_id, reversal_of, fee_breakdown, created_at`
+
+func scanTransaction(row rowScanner, record *TransactionRecord) error {
+	return row.Scan(&record.TransactionID, &record.SourceAccountID, &record.DestinationAccountID, &record.Amount,
+		&record.Currency, &record.DestinationAmount, &record.DestinationCurrency, &record.ExchangeRate,
+		&record.RoundingRemainder, &record.SourceBalanceAfter, &record.DestinationBalanceAfter, &record.BatchID,
+		&record.ReversalOf, &record.Fee, &record.CreatedAt)
+}
+
+func QueryTransactionById(DB *sql.DB, transactionID int, record *TransactionRecord) error {
+	err := scanTransaction(DB.QueryRow("SELECT "+transactionColumns+" FROM account_transactions WHERE id = $1", transactionID), record)
+	return notFound(err, ErrTransactionNotFound)
 }
 
 func ProcessTransaction(DB *sql.DB, transaction *Transaction) error {
+	return ProcessTransactionWithIdempotencyKey(DB, transaction, nil, &TransactionRecord{})
+}
+
+// ProcessTransactionWithIdempotencyKey performs the transfer, charging the fee of the fee schedule that applies
+// to the source account if any, and fills record with the row written to account_transactions.
+// A transfer over the approval threshold of its currency fails with ErrApprovalRequired, see CreateTransferApproval.
+// If idempotencyKey is not nil, the record becomes its stored response and the key is inserted in the same
+// database transaction as the transfer.
+func ProcessTransactionWithIdempotencyKey(DB *sql.DB, transaction *Transaction, idempotencyKey *IdempotencyKey, record *TransactionRecord) error {
 	// Start a new transaction
 	dbtx, err := DB.Begin()
 	if err != nil {
 		return err
 	}
-	defer func(tx *sql.Tx) {
-		if err := tx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
-			log.Println("Failed to roll back:", err)
+	defer rollback(dbtx)
+
+	err = processTransaction(dbtx, transaction, false, record)
+	if err != nil {
+		return err
+	}
+
+	// A concurrent retry with the same key has been waiting on the account locks above,
+	// it fails here once we commit and its transfer is rolled back
+	if idempotencyKey != nil {
+		idempotencyKey.ResponseBody, err = json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		idempotencyKey.ResponseLocation = record.Location()
+		err = insertIdempotencyKey(dbtx, idempotencyKey)
+		if err != nil {
+			return err
 		}
-	}(dbtx)
-
-	// Get the current balance and updated_at time for the source account
-	var sourceBalance float64
-	var sourceUpdatedAt time.Time
-
-	// Get the current balance and updated_at time for the destination account
-	var destBalance float64
-	var destUpdatedAt time.Time
-
-	var sourceID int
-	var destID int
-	var transactionAmount float64
-
-	// Because we are locking the smaller account ID first
-	// The source and destination will be flipped if original sourceAccountId of transaction is greater
-	// In this case we have to negate the transaction amount
-	if transaction.SourceAccountID > transaction.DestinationAccountID {
-		sourceID = transaction.DestinationAccountID
-		destID = transaction.SourceAccountID
-		transactionAmount = -1 * transaction.Amount // subtract from source
-	} else {
-		sourceID = transaction.SourceAccountID
-		destID = transaction.DestinationAccountID
-		transactionAmount = transaction.Amount
 	}
 
-	// Lock row of smaller ID(sourceID) then destID
-	err = dbtx.QueryRow(`
-    WITH source AS (
-        SELECT balance, updated_at
-        FROM account_balance
-        WHERE account_id = $1::integer
-        FOR UPDATE
-    ), dest AS (
-        SELECT balance, updated_at
-        FROM account_balance
-        WHERE account_id = $2::integer
-        FOR UPDATE
-    )
-    SELECT source.balance, source.updated_at, dest.balance, dest.updated_at
-    FROM source, dest
-`, sourceID, destID).Scan(&sourceBalance, &sourceUpdatedAt, &destBalance, &destUpdatedAt)
+	// Commit the transaction
+	err = dbtx.Commit()
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
 
+// processTransaction performs the transfer inside dbtx, see ProcessTransactionWithIdempotencyKey.
+// approved is only true for a transfer a second principal has approved, which may be over the approval threshold.
+func processTransaction(dbtx *sql.Tx, transaction *Transaction, approved bool, record *TransactionRecord) error {
+	accountIDs := []int{transaction.SourceAccountID, transaction.DestinationAccountID}
+	fee, err := transferFee(dbtx, transaction)
 	if err != nil {
 		return err
 	}
+	if fee != nil {
+		accountIDs = append(accountIDs, fee.RevenueAccountID)
+	}
 
-	// Calculate the new balances
-	newSourceBalance := sourceBalance - transactionAmount
-	newDestBalance := destBalance + transactionAmount
+	// Lock all rows, smaller account ID first
+	accounts, err := lockAccounts(dbtx, accountIDs)
+	if err != nil {
+		return err
+	}
+
+	// The check constraint on account_balance would also catch this, but only as a generic constraint violation
+	spent := transaction.Amount
+	if fee != nil {
+		spent += fee.Amount
+	}
+	if !accounts[transaction.SourceAccountID].canSpend(spent) {
+		return ErrInsufficientBalance
+	}
+	if !approved {
+		err = checkApprovalPolicy(dbtx, accounts[transaction.SourceAccountID].Currency, transaction.Amount)
+		if err != nil {
+			return err
+		}
+	}
+	record.Fee = fee
+	err = applyTransfer(dbtx, accounts, transaction, nil, record)
+	if err != nil {
+		return err
+	}
+
+	return writeBalances(dbtx, accounts)
+}
+
+// lockedAccount is an account_balance row locked FOR UPDATE. Balance and Held are updated in memory as
+// transfers and holds are applied and written back by writeBalances.
+type lockedAccount struct {
+	AccountID          int
+	Balance            Money
+	Held               Money
+	Currency           Currency
+	AccountType        string
+	Status             string
+	OverdraftLimit     Money
+	UnlimitedOverdraft bool
+	UpdatedAt          time.Time
+}
+
+// available is the part of the balance that is not reserved by holds
+func (a *lockedAccount) available() Money {
+	return a.Balance - a.Held
+}
 
-	// Update the account balances
-	_, err = dbtx.Exec("UPDATE account_balance SET balance = $1, updated_at = $2 WHERE account_id = $3 AND updated_at = $4", newSourceBalance, time.Now(), sourceID, sourceUpdatedAt)
+// toAccount fills account from the locked row, including any changes made to it in memory
+func (a *lockedAccount) toAccount(account *Account) {
+	account.AccountID = a.AccountID
+	account.Balance = a.Balance
+	account.AvailableBalance = a.available()
+	account.Currency = a.Currency
+	account.AccountType = a.AccountType
+	account.Status = a.Status
+	account.OverdraftLimit = a.OverdraftLimit
+	account.UnlimitedOverdraft = a.UnlimitedOverdraft
+}
+
+// canSpend reports whether amount can leave the available balance without going over the overdraft limit
+func (a *lockedAccount) canSpend(amount Money) bool {
+	return a.UnlimitedOverdraft || a.available()+a.OverdraftLimit >= amount
+}
+
+// checkDebit fails if the account status does not allow money to leave the account
+func (a *lockedAccount) checkDebit() error {
+	switch a.Status {
+	case AccountStatusFrozen:
+		return fmt.Errorf("source account %d: %w", a.AccountID, ErrAccountFrozen)
+	case AccountStatusClosed:
+		return fmt.Errorf("source account %d: %w", a.AccountID, ErrAccountClosed)
+	}
+	return nil
+}
+
+// checkCredit fails if the account status does not allow money to enter the account, frozen accounts may still receive
+func (a *lockedAccount) checkCredit() error {
+	if a.Status == AccountStatusClosed {
+		return fmt.Errorf("destination account %d: %w", a.AccountID, ErrAccountClosed)
+	}
+	return nil
+}
+
+// lockAccounts locks the rows of the accounts in ascending account ID order, so that transactions locking
+// overlapping sets of accounts always take the locks in the same order and cannot deadlock.
+// It returns ErrAccountNotFound if any of the accounts does not exist.
+func lockAccounts(dbtx *sql.Tx, accountIDs []int) (map[int]*lockedAccount, error) {
+	rows, err := dbtx.Query(`
+    SELECT account_id, balance, held, currency, account_type, status, overdraft_limit, unlimited_overdraft, updated_at
+    FROM account_balance
+    WHERE account_id = ANY($1)
+    ORDER BY account_id
+    FOR UPDATE
+`, pq.Array(accountIDs))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	accounts := map[int]*lockedAccount{}
+	for rows.Next() {
+		account := lockedAccount{}
+		err = rows.Scan(&account.AccountID, &account.Balance, &account.Held, &account.Currency, &account.AccountType, &account.Status,
+			&account.OverdraftLimit, &account.UnlimitedOverdraft, &account.UpdatedAt)
+		if err != nil {
+			return nil, err
+		}
+		accounts[account.AccountID] = &account
+	}
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+
+	for _, accountID := range accountIDs {
+		if _, ok := accounts[accountID]; !ok {
+			return nil, ErrAccountNotFound
+		}
+	}
+	return accounts, nil
+}
+
+// applyTransfer converts the transfer if needed and records it with recordTransfer
+func applyTransfer(dbtx *sql.Tx, accounts map[int]*lockedAccount, transaction *Transaction, batchID *int, record *TransactionRecord) error {
+	source := accounts[transaction.SourceAccountID]
+	dest := accounts[transaction.DestinationAccountID]
+
+	err := source.Currency.ValidateAmount(transaction.Amount)
 	if err != nil {
 		return err
 	}
-	_, err = dbtx.Exec("UPDATE account_balance SET balance = $1, updated_at = $2 WHERE account_id = $3 AND updated_at = $4", newDestBalance, time.Now(), destID, destUpdatedAt)
+	// The fee leaves the account with the transfer, so it counts towards the limits as well
+	spent := transaction.Amount
+	if record.Fee != nil {
+		spent += record.Fee.Amount
+	}
+	err = checkTransferLimits(dbtx, source, spent)
 	if err != nil {
 		return err
 	}
 
-	// Insert the transaction
-	_, err = dbtx.Exec("INSERT INTO account_transactions (account_transfer_out, account_transfer_in, amount) VALUES ($1, $2, $3)", transaction.SourceAccountID, transaction.DestinationAccountID, transaction.Amount)
+	// Both rows are locked, so the currencies cannot change until we commit
+	destinationAmount := transaction.Amount
+	var rateUsed *Rate
+	var roundingRemainder *string
+	if source.Currency != dest.Currency {
+		if !transaction.ConvertCurrency {
+			return ErrCurrencyMismatch
+		}
+		// The rate is read inside this transaction, so the conversion and the transfer see the same rate
+		rate, err := lockCurrentExchangeRate(dbtx, source.Currency, dest.Currency)
+		if err != nil {
+			return err
+		}
+		converted, remainder, err := rate.Convert(transaction.Amount, dest.Currency)
+		if err != nil {
+			return err
+		}
+		if converted <= 0 {
+			return ErrAmountTooSmallToConvert
+		}
+		destinationAmount = converted
+		rateUsed = &rate
+		roundingRemainder = &remainder
+	}
+
+	record.SourceAccountID = transaction.SourceAccountID
+	record.DestinationAccountID = transaction.DestinationAccountID
+	record.Amount = transaction.Amount
+	record.Currency = source.Currency
+	record.DestinationAmount = destinationAmount
+	record.DestinationCurrency = dest.Currency
+	record.ExchangeRate = rateUsed
+	record.RoundingRemainder = roundingRemainder
+	record.BatchID = batchID
+	return recordTransfer(dbtx, accounts, "transfer", record)
+}
+
+// recordTransfer moves record.Amount out of the source and record.DestinationAmount into the destination
+// in the in-memory balances, and record.Fee if any from the source to the revenue account, which has to be locked too.
+// It then inserts the transfer into account_transactions and the ledger.
+func recordTransfer(dbtx *sql.Tx, accounts map[int]*lockedAccount, description string, record *TransactionRecord) error {
+	source := accounts[record.SourceAccountID]
+	dest := accounts[record.DestinationAccountID]
+
+	// The rows are locked, so the statuses cannot change until we commit
+	err := source.checkDebit()
+	if err != nil {
+		return err
+	}
+	err = dest.checkCredit()
 	if err != nil {
 		return err
 	}
 
-	// Commit the transaction
-	err = dbtx.Commit()
+	// Calculate the new balances
+	source.Balance -= record.Amount
+	dest.Balance += record.DestinationAmount
+	var feeAmount Money
+	var feeAccountID *int
+	var feeAccountBalanceAfter *Money
+	if record.Fee != nil {
+		// The client cannot do anything about the revenue account of the fee schedule, so it is not reported as
+		// the destination of the transfer being closed
+		revenue := accounts[record.Fee.RevenueAccountID]
+		if revenue.Status == AccountStatusClosed {
+			return fmt.Errorf("revenue account %d: %w", revenue.AccountID, ErrRevenueAccountClosed)
+		}
+		source.Balance -= record.Fee.Amount
+		revenue.Balance += record.Fee.Amount
+		feeAmount = record.Fee.Amount
+		feeAccountID = &record.Fee.RevenueAccountID
+		feeAccountBalanceAfter = &revenue.Balance
+	}
+
+	// Insert the transaction
+	record.SourceBalanceAfter = source.Balance
+	record.DestinationBalanceAfter = dest.Balance
+	err = dbtx.QueryRow(`
+    INSERT INTO account_transactions (account_transfer_out, account_transfer_in, amount, currency,
+                                      destination_amount, destination_currency, exchange_rate, rounding_remainder,
+                                      source_balance_after, destination_balance_after, batch_id, reversal_of,
+                                      fee_amount, fee_account_id, fee_breakdown, fee_account_balance_after)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9, $10, $11, $12, $13, $14, $15, $16)
+    RETURNING id, created_at
+`, record.SourceAccountID, record.DestinationAccountID, record.Amount, record.Currency, record.DestinationAmount,
+		record.DestinationCurrency, record.ExchangeRate, record.RoundingRemainder, record.SourceBalanceAfter,
+		record.DestinationBalanceAfter, record.BatchID, record.ReversalOf, feeAmount, feeAccountID,
+		record.Fee, feeAccountBalanceAfter).Scan(&record.TransactionID, &record.CreatedAt)
 	if err != nil {
 		return err
 	}
 
+	// Record the transfer in the ledger
+	entry := JournalEntry{TransactionID: &record.TransactionID, Description: description, Postings: transferPostings(record)}
+	return insertJournalEntry(dbtx, &entry)
+}
+
+// writeBalances writes the balances of the locked accounts back to account_balance, in account ID order.
+// They are a cached projection of the postings inserted by applyTransfer.
+func writeBalances(dbtx *sql.Tx, accounts map[int]*lockedAccount) error {
+	accountIDs := make([]int, 0, len(accounts))
+	for accountID := range accounts {
+		accountIDs = append(accountIDs, accountID)
+	}
+	sort.Ints(accountIDs)
+
+	now := time.Now()
+	for _, accountID := range accountIDs {
+		account := accounts[accountID]
+		_, err := dbtx.Exec("UPDATE account_balance SET balance = $1, held = $2, updated_at = $3 WHERE account_id = $4 AND updated_at = $5", account.Balance, account.Held, now, account.AccountID, account.UpdatedAt)
+		if err != nil {
+			return err
+		}
+	}
 	return nil
 }
+
+// rollback is deferred right after beginning a transaction, it is a no-op once the transaction has been committed
+func rollback(dbtx *sql.Tx) {
+	if err := dbtx.Rollback(); err != nil && !errors.Is(err, sql.ErrTxDone) {
+		log.Println("Failed to roll back:", err)
+	}
+}
+
+// transferPostings debits the source and credits the destination. A cross-currency transfer passes through
+// the FX position accounts of both currencies so that each currency balances on its own.
+func transferPostings(record *TransactionRecord) []Posting {
+	var postings []Posting
+	if record.Currency == record.DestinationCurrency {
+		postings = []Posting{
+			AccountPosting(record.SourceAccountID, -record.Amount, record.Currency),
+			AccountPosting(record.DestinationAccountID, record.DestinationAmount, record.DestinationCurrency),
+		}
+	} else {
+		postings = []Posting{
+			AccountPosting(record.SourceAccountID, -record.Amount, record.Currency),
+			SystemPosting(FXPositionAccount(record.Currency), record.Amount, record.Currency),
+			SystemPosting(FXPositionAccount(record.DestinationCurrency), -record.DestinationAmount, record.DestinationCurrency),
+			AccountPosting(record.DestinationAccountID, record.DestinationAmount, record.DestinationCurrency),
+		}
+	}
+	// The fee is a separate leg of the same entry, in the source currency
+	if record.Fee != nil {
+		postings = append(postings,
+			AccountPosting(record.SourceAccountID, -record.Fee.Amount, record.Fee.Currency),
+			AccountPosting(record.Fee.RevenueAccountID, record.Fee.Amount, record.Fee.Currency),
+		)
+	}
+	return postings
+}
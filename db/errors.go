@@ -0,0 +1,83 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+)
+
+// Kind is the class of an Error, it decides how the error is answered over HTTP
+type Kind int
+
+const (
+	// KindInvalid is a request that can never succeed as it is
+	KindInvalid Kind = iota + 1
+	// KindNotFound is a resource that does not exist, Errors of this kind wrap sql.ErrNoRows
+	KindNotFound
+	// KindForbidden is a request the principal or the account is not allowed to make
+	KindForbidden
+	// KindConflict is a request that the current state of a resource does not allow
+	KindConflict
+	// KindUnprocessable is a well-formed request that cannot be carried out for now, like a transfer without an
+	// exchange rate
+	KindUnprocessable
+	// KindNotSupported is a feature the storage backend does not have
+	KindNotSupported
+)
+
+// Error is an error of this package that clients can act on. Code is a stable machine-readable identifier of what
+// went wrong, Message is the human-readable explanation.
+// The errors are compared with errors.Is against the Err variables of this package.
+type Error struct {
+	Kind    Kind
+	Code    string
+	Message string
+	// Err is the underlying error if there is one
+	Err error
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+func (e *Error) Unwrap() error {
+	return e.Err
+}
+
+func newError(kind Kind, code string, message string) *Error {
+	return &Error{Kind: kind, Code: code, Message: message}
+}
+
+// withMessage returns the error with a message specific to where it happened, it still matches e with errors.Is
+func (e *Error) withMessage(message string) *Error {
+	return &Error{Kind: e.Kind, Code: e.Code, Message: message, Err: e}
+}
+
+// newNotFoundError returns a KindNotFound Error wrapping sql.ErrNoRows, so that callers checking for sql.ErrNoRows
+// still recognize it
+func newNotFoundError(code string, message string) *Error {
+	return &Error{Kind: KindNotFound, Code: code, Message: message, Err: sql.ErrNoRows}
+}
+
+var ErrAccountNotFound = newNotFoundError("account_not_found", "account does not exist")
+var ErrTransactionNotFound = newNotFoundError("transaction_not_found", "transaction does not exist")
+var ErrBatchNotFound = newNotFoundError("batch_not_found", "batch does not exist")
+var ErrHoldNotFound = newNotFoundError("hold_not_found", "hold does not exist")
+var ErrScheduledTransferNotFound = newNotFoundError("scheduled_transfer_not_found", "scheduled transfer does not exist")
+var ErrStandingOrderNotFound = newNotFoundError("standing_order_not_found", "standing order does not exist")
+var ErrTransferApprovalNotFound = newNotFoundError("transfer_approval_not_found", "transfer approval does not exist")
+var ErrInterestRateNotFound = newNotFoundError("interest_rate_not_found", "account does not earn interest")
+var ErrTransferLimitsNotFound = newNotFoundError("transfer_limits_not_found", "no transfer limits are set")
+
+var ErrSameAccount = newError(KindInvalid, "same_account", "transferring to the same account is not allowed")
+
+// ErrConstraintViolation is a write the database refused with a constraint that no more specific Error stands for
+var ErrConstraintViolation = newError(KindConflict, "constraint_violation", "request conflicts with the stored data")
+
+// notFound returns notFoundErr in place of a bare sql.ErrNoRows, and any other err unchanged
+func notFound(err error, notFoundErr *Error) error {
+	var typed *Error
+	if errors.Is(err, sql.ErrNoRows) && !errors.As(err, &typed) {
+		return notFoundErr
+	}
+	return err
+}
@@ -0,0 +1,72 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	. "takeHomeAssignment/entities"
+)
+
+var ErrNoExchangeRate = newError(KindUnprocessable, "no_exchange_rate", "no exchange rate is available for the currency pair")
+
+// UpsertExchangeRates stores all rates atomically. Uploading a rate for a pair and effective_at that already
+// exists replaces it, so the same file can be uploaded again to refresh rates.
+func UpsertExchangeRates(DB *sql.DB, rates []ExchangeRate) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	for i := range rates {
+		// A missing effective_at means the rate applies from now on
+		var effectiveAt sql.NullTime
+		if !rates[i].EffectiveAt.IsZero() {
+			effectiveAt = sql.NullTime{Time: rates[i].EffectiveAt, Valid: true}
+		}
+		err = dbtx.QueryRow(`
+    INSERT INTO exchange_rates (base_currency, quote_currency, rate, effective_at)
+    VALUES ($1, $2, $3, COALESCE($4, CURRENT_TIMESTAMP))
+    ON CONFLICT (base_currency, quote_currency, effective_at) DO UPDATE SET rate = EXCLUDED.rate
+    RETURNING effective_at
+`, rates[i].BaseCurrency, rates[i].QuoteCurrency, rates[i].Rate, effectiveAt).Scan(&rates[i].EffectiveAt)
+		if err != nil {
+			return err
+		}
+	}
+
+	return dbtx.Commit()
+}
+
+// QueryCurrentExchangeRate fills rate with the latest rate from base to quote that is already in effect, it returns
+// ErrNoExchangeRate if there is none
+func QueryCurrentExchangeRate(DB *sql.DB, base Currency, quote Currency, rate *ExchangeRate) error {
+	err := DB.QueryRow(`
+    SELECT base_currency, quote_currency, rate, effective_at
+    FROM exchange_rates
+    WHERE base_currency = $1 AND quote_currency = $2 AND effective_at <= CURRENT_TIMESTAMP
+    ORDER BY effective_at DESC
+    LIMIT 1
+`, base, quote).Scan(&rate.BaseCurrency, &rate.QuoteCurrency, &rate.Rate, &rate.EffectiveAt)
+	if errors.Is(err, sql.ErrNoRows) {
+		return ErrNoExchangeRate
+	}
+	return err
+}
+
+// lockCurrentExchangeRate reads the rate in effect inside dbtx and holds a share lock on it,
+// so a concurrent refresh of the same row waits until the transfer using it has committed
+func lockCurrentExchangeRate(dbtx *sql.Tx, base Currency, quote Currency) (Rate, error) {
+	var rate Rate
+	err := dbtx.QueryRow(`
+    SELECT rate
+    FROM exchange_rates
+    WHERE base_currency = $1 AND quote_currency = $2 AND effective_at <= CURRENT_TIMESTAMP
+    ORDER BY effective_at DESC
+    LIMIT 1
+    FOR SHARE
+`, base, quote).Scan(&rate)
+	if errors.Is(err, sql.ErrNoRows) {
+		return 0, ErrNoExchangeRate
+	}
+	return rate, err
+}
@@ -0,0 +1,111 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	. "takeHomeAssignment/entities"
+)
+
+var ErrRevenueAccountClosed = newError(KindConflict, "revenue_account_closed", "the account fees are paid to is closed")
+
+const feeScheduleColumns = "id, account_type, currency, revenue_account_id, tiers, min_fee, max_fee"
+
+type queryer interface {
+	QueryRow(query string, args ...interface{}) *sql.Row
+}
+
+func scanFeeSchedule(row rowScanner, schedule *FeeSchedule) error {
+	return row.Scan(&schedule.FeeScheduleID, &schedule.AccountType, &schedule.Currency, &schedule.RevenueAccountID,
+		&schedule.Tiers, &schedule.MinFee, &schedule.MaxFee)
+}
+
+// UpsertFeeSchedule stores the schedule, replacing the one for the same account type and currency if there is one.
+// The revenue account has to hold the currency of the schedule.
+func UpsertFeeSchedule(DB *sql.DB, schedule *FeeSchedule) error {
+	revenueAccount := Account{}
+	err := QueryAccountByAccountId(DB, schedule.RevenueAccountID, &revenueAccount)
+	if err != nil {
+		return err
+	}
+	if revenueAccount.Currency != schedule.Currency {
+		return ErrCurrencyMismatch.withMessage("revenue account must hold the currency of the fee schedule")
+	}
+
+	return scanFeeSchedule(DB.QueryRow(`
+    INSERT INTO fee_schedules (account_type, currency, revenue_account_id, tiers, min_fee, max_fee)
+    VALUES ($1, $2, $3, $4, $5, $6)
+    ON CONFLICT (currency, COALESCE(account_type, '')) DO UPDATE SET revenue_account_id = EXCLUDED.revenue_account_id,
+                                                                   tiers = EXCLUDED.tiers,
+                                                                   min_fee = EXCLUDED.min_fee,
+                                                                   max_fee = EXCLUDED.max_fee,
+                                                                   updated_at = CURRENT_TIMESTAMP
+    RETURNING `+feeScheduleColumns,
+		schedule.AccountType, schedule.Currency, schedule.RevenueAccountID, schedule.Tiers, schedule.MinFee,
+		schedule.MaxFee), schedule)
+}
+
+// QueryFeeSchedules fills schedules with every fee schedule, ordered by ID
+func QueryFeeSchedules(DB *sql.DB, schedules *[]FeeSchedule) error {
+	rows, err := DB.Query("SELECT " + feeScheduleColumns + " FROM fee_schedules ORDER BY id")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	*schedules = []FeeSchedule{}
+	for rows.Next() {
+		schedule := FeeSchedule{}
+		err = scanFeeSchedule(rows, &schedule)
+		if err != nil {
+			return err
+		}
+		*schedules = append(*schedules, schedule)
+	}
+	return rows.Err()
+}
+
+// QueryTransferFee fills fee with the fee the transfer would be charged right now, or leaves it zero if none applies
+func QueryTransferFee(DB *sql.DB, transaction *Transaction, fee *Fee) error {
+	schedule := FeeSchedule{}
+	err := lookupFeeSchedule(DB, transaction.SourceAccountID, &schedule)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	*fee = schedule.Compute(transaction.Amount)
+	return nil
+}
+
+// transferFee returns the fee the transfer is charged, or nil if none applies. It is worked out before the accounts
+// are locked, because the revenue account it is paid to has to be locked too.
+func transferFee(q queryer, transaction *Transaction) (*Fee, error) {
+	schedule := FeeSchedule{}
+	err := lookupFeeSchedule(q, transaction.SourceAccountID, &schedule)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	fee := schedule.Compute(transaction.Amount)
+	if fee.Amount <= 0 {
+		return nil, nil
+	}
+	return &fee, nil
+}
+
+// lookupFeeSchedule fills schedule with the schedule for the type and currency of the source account, falling back
+// to the schedule for its currency alone. It returns sql.ErrNoRows if neither exists or the source account is
+// the revenue account itself.
+func lookupFeeSchedule(q queryer, sourceAccountID int, schedule *FeeSchedule) error {
+	return scanFeeSchedule(q.QueryRow(`
+    SELECT f.id, f.account_type, f.currency, f.revenue_account_id, f.tiers, f.min_fee, f.max_fee
+    FROM fee_schedules f
+    JOIN account_balance a ON a.currency = f.currency AND (a.account_type = f.account_type OR f.account_type IS NULL)
+    WHERE a.account_id = $1 AND f.revenue_account_id <> a.account_id
+    ORDER BY f.account_type NULLS LAST
+    LIMIT 1
+`, sourceAccountID), schedule)
+}
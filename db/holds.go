@@ -0,0 +1,247 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	. "takeHomeAssignment/entities"
+)
+
+var ErrHoldNotActive = newError(KindConflict, "hold_not_active", "hold has already been captured, voided or has expired")
+var ErrCaptureExceedsHold = newError(KindInvalid, "capture_exceeds_hold", "capture amount cannot exceed the held amount")
+
+const holdColumns = `id, source_account_id, destination_account_id, amount, captured_amount, currency, status,
+           transaction_id, expires_at, created_at, updated_at`
+
+type rowScanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanHold(row rowScanner, hold *Hold) error {
+	return row.Scan(&hold.HoldID, &hold.SourceAccountID, &hold.DestinationAccountID, &hold.Amount, &hold.CapturedAmount,
+		&hold.Currency, &hold.Status, &hold.TransactionID, &hold.ExpiresAt, &hold.CreatedAt, &hold.UpdatedAt)
+}
+
+func QueryHoldById(DB *sql.DB, holdID int, hold *Hold) error {
+	err := scanHold(DB.QueryRow("SELECT "+holdColumns+" FROM holds WHERE id = $1", holdID), hold)
+	return notFound(err, ErrHoldNotFound)
+}
+
+// CreateHold reserves the amount on the source account, which lowers its available balance
+// but leaves its ledger balance untouched
+func CreateHold(DB *sql.DB, request *HoldRequest, hold *Hold) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	accounts, err := lockAccounts(dbtx, []int{request.SourceAccountID, request.DestinationAccountID})
+	if err != nil {
+		return err
+	}
+	source := accounts[request.SourceAccountID]
+	dest := accounts[request.DestinationAccountID]
+	err = source.checkDebit()
+	if err != nil {
+		return err
+	}
+	err = dest.checkCredit()
+	if err != nil {
+		return err
+	}
+	if source.Currency != dest.Currency {
+		return ErrCurrencyMismatch
+	}
+	err = source.Currency.ValidateAmount(request.Amount)
+	if err != nil {
+		return err
+	}
+	if !source.canSpend(request.Amount) {
+		return ErrInsufficientBalance
+	}
+	// A capture is a transfer of at most the held amount, so a hold within the approval threshold needs no approval
+	err = checkApprovalPolicy(dbtx, source.Currency, request.Amount)
+	if err != nil {
+		return err
+	}
+
+	source.Held += request.Amount
+	err = writeBalances(dbtx, accounts)
+	if err != nil {
+		return err
+	}
+
+	err = scanHold(dbtx.QueryRow(`
+    INSERT INTO holds (source_account_id, destination_account_id, amount, currency, status, expires_at)
+    VALUES ($1, $2, $3, $4, $5, CURRENT_TIMESTAMP + $6::float8 * INTERVAL '1 second')
+    RETURNING `+holdColumns,
+		request.SourceAccountID, request.DestinationAccountID, request.Amount, source.Currency, HoldStatusActive,
+		request.TTL().Seconds()), hold)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
+
+// CaptureHold turns the hold into a transfer of amount, or of the full held amount if amount is nil,
+// and releases the whole reservation. It fills record with the transfer.
+func CaptureHold(DB *sql.DB, holdID int, amount *Money, hold *Hold, record *TransactionRecord) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	err = lockActiveHold(dbtx, holdID, hold)
+	if err != nil {
+		return err
+	}
+	captureAmount := hold.Amount
+	if amount != nil {
+		captureAmount = *amount
+	}
+	if captureAmount > hold.Amount {
+		return ErrCaptureExceedsHold
+	}
+
+	accounts, err := lockAccounts(dbtx, []int{hold.SourceAccountID, hold.DestinationAccountID})
+	if err != nil {
+		return err
+	}
+	accounts[hold.SourceAccountID].Held -= hold.Amount
+
+	// The captured amount moves exactly like any other transfer
+	err = applyTransfer(dbtx, accounts, &Transaction{
+		SourceAccountID:      hold.SourceAccountID,
+		DestinationAccountID: hold.DestinationAccountID,
+		Amount:               captureAmount,
+	}, nil, record)
+	if err != nil {
+		return err
+	}
+	err = writeBalances(dbtx, accounts)
+	if err != nil {
+		return err
+	}
+
+	err = scanHold(dbtx.QueryRow(`
+    UPDATE holds SET status = $1, captured_amount = $2, transaction_id = $3, updated_at = CURRENT_TIMESTAMP
+    WHERE id = $4
+    RETURNING `+holdColumns, HoldStatusCaptured, captureAmount, record.TransactionID, holdID), hold)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
+
+// VoidHold releases the reservation without moving any money
+func VoidHold(DB *sql.DB, holdID int, hold *Hold) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	err = lockActiveHold(dbtx, holdID, hold)
+	if err != nil {
+		return err
+	}
+	accounts, err := lockAccounts(dbtx, []int{hold.SourceAccountID})
+	if err != nil {
+		return err
+	}
+	accounts[hold.SourceAccountID].Held -= hold.Amount
+	err = writeBalances(dbtx, accounts)
+	if err != nil {
+		return err
+	}
+
+	err = scanHold(dbtx.QueryRow(`
+    UPDATE holds SET status = $1, updated_at = CURRENT_TIMESTAMP
+    WHERE id = $2
+    RETURNING `+holdColumns, HoldStatusVoided, holdID), hold)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
+
+// ExpireHolds releases the reservations of active holds past their expiry, at most limit of them,
+// and returns how many were expired. Holds locked by a concurrent capture or void are skipped.
+func ExpireHolds(DB *sql.DB, limit int) (int, error) {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer rollback(dbtx)
+
+	rows, err := dbtx.Query(`
+    SELECT `+holdColumns+`
+    FROM holds
+    WHERE status = $1 AND expires_at <= CURRENT_TIMESTAMP
+    ORDER BY id
+    LIMIT $2
+    FOR UPDATE SKIP LOCKED
+`, HoldStatusActive, limit)
+	if err != nil {
+		return 0, err
+	}
+	var holds []Hold
+	for rows.Next() {
+		var hold Hold
+		err = scanHold(rows, &hold)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		holds = append(holds, hold)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return 0, err
+	}
+	if len(holds) == 0 {
+		return 0, nil
+	}
+
+	var accountIDs []int
+	var holdIDs []int
+	for _, hold := range holds {
+		accountIDs = append(accountIDs, hold.SourceAccountID)
+		holdIDs = append(holdIDs, hold.HoldID)
+	}
+	accounts, err := lockAccounts(dbtx, accountIDs)
+	if err != nil {
+		return 0, err
+	}
+	for _, hold := range holds {
+		accounts[hold.SourceAccountID].Held -= hold.Amount
+	}
+	err = writeBalances(dbtx, accounts)
+	if err != nil {
+		return 0, err
+	}
+
+	_, err = dbtx.Exec("UPDATE holds SET status = $1, updated_at = CURRENT_TIMESTAMP WHERE id = ANY($2)", HoldStatusExpired, pq.Array(holdIDs))
+	if err != nil {
+		return 0, err
+	}
+	return len(holds), dbtx.Commit()
+}
+
+// lockActiveHold locks the hold row and fails with ErrHoldNotActive if it can no longer be captured or voided.
+// A hold past its expiry counts as expired even if ExpireHolds has not got to it yet.
+func lockActiveHold(dbtx *sql.Tx, holdID int, hold *Hold) error {
+	var expired bool
+	err := dbtx.QueryRow("SELECT "+holdColumns+", expires_at <= CURRENT_TIMESTAMP FROM holds WHERE id = $1 FOR UPDATE", holdID).Scan(
+		&hold.HoldID, &hold.SourceAccountID, &hold.DestinationAccountID, &hold.Amount, &hold.CapturedAmount,
+		&hold.Currency, &hold.Status, &hold.TransactionID, &hold.ExpiresAt, &hold.CreatedAt, &hold.UpdatedAt, &expired)
+	if err != nil {
+		return notFound(err, ErrHoldNotFound)
+	}
+	if hold.Status != HoldStatusActive || expired {
+		return ErrHoldNotActive
+	}
+	return nil
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"database/sql"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+// IdempotencyKeyRetention is how long a key is remembered, after which it may be reused for a new request
+const IdempotencyKeyRetention = 24 * time.Hour
+
+var ErrIdempotencyKeyInUse = newError(KindConflict, "idempotency_key_in_use", "idempotency key has already been used")
+
+// QueryIdempotencyKey fills idempotencyKey with the stored request and response for a key that is still retained
+func QueryIdempotencyKey(DB *sql.DB, scope string, key string, idempotencyKey *IdempotencyKey) error {
+	err := DB.QueryRow(`
+    SELECT idempotency_key, scope, request_fingerprint, response_status, response_body, response_location, created_at
+    FROM idempotency_keys
+    WHERE scope = $1 AND idempotency_key = $2 AND created_at >= CURRENT_TIMESTAMP - $3::float8 * INTERVAL '1 second'
+`, scope, key, IdempotencyKeyRetention.Seconds()).Scan(&idempotencyKey.Key, &idempotencyKey.Scope, &idempotencyKey.Fingerprint,
+		&idempotencyKey.ResponseStatus, &idempotencyKey.ResponseBody, &idempotencyKey.ResponseLocation, &idempotencyKey.CreatedAt)
+	if err != nil {
+		return err
+	}
+	return nil
+}
+
+// insertIdempotencyKey stores the key inside dbtx, so the key is only remembered if the work it guards commits.
+// A concurrent request with the same key blocks on the primary key until this transaction finishes,
+// and then gets ErrIdempotencyKeyInUse. Expired keys are overwritten.
+func insertIdempotencyKey(dbtx *sql.Tx, idempotencyKey *IdempotencyKey) error {
+	result, err := dbtx.Exec(`
+    INSERT INTO idempotency_keys (scope, idempotency_key, request_fingerprint, response_status, response_body, response_location)
+    VALUES ($1, $2, $3, $4, $5, $6)
+    ON CONFLICT (scope, idempotency_key) DO UPDATE
+        SET request_fingerprint = EXCLUDED.request_fingerprint,
+            response_status     = EXCLUDED.response_status,
+            response_body       = EXCLUDED.response_body,
+            response_location   = EXCLUDED.response_location,
+            created_at          = CURRENT_TIMESTAMP
+        WHERE idempotency_keys.created_at < CURRENT_TIMESTAMP - $7::float8 * INTERVAL '1 second'
+`, idempotencyKey.Scope, idempotencyKey.Key, idempotencyKey.Fingerprint, idempotencyKey.ResponseStatus,
+		idempotencyKey.ResponseBody, idempotencyKey.ResponseLocation, IdempotencyKeyRetention.Seconds())
+	if err != nil {
+		return err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrIdempotencyKeyInUse
+	}
+	return nil
+}
+
+// DeleteExpiredIdempotencyKeys removes keys that are past the retention window
+func DeleteExpiredIdempotencyKeys(DB *sql.DB) (int64, error) {
+	result, err := DB.Exec("DELETE FROM idempotency_keys WHERE created_at < CURRENT_TIMESTAMP - $1::float8 * INTERVAL '1 second'", IdempotencyKeyRetention.Seconds())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
@@ -0,0 +1,290 @@
+package db
+
+import (
+	"database/sql"
+	"github.com/lib/pq"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+var ErrInterestExpenseAccount = newError(KindInvalid, "invalid_expense_account", "interest cannot be paid from the account that earns it")
+var ErrNoInterestToPost = newError(KindConflict, "no_interest_to_post", "no accrued interest to post")
+
+// dateLayout is how a DATE is passed to the database, so that a date never shifts with the time zone
+const dateLayout = "2006-01-02"
+
+const interestAccrualColumns = "account_id, accrual_date, balance, annual_rate, amount, transaction_id"
+
+func scanInterestAccrual(row rowScanner, accrual *InterestAccrual) error {
+	return row.Scan(&accrual.AccountID, &accrual.AccrualDate, &accrual.Balance, &accrual.AnnualRate, &accrual.Amount,
+		&accrual.TransactionID)
+}
+
+// SetInterestRate makes the account earn interest at rate.AnnualRate, paid from rate.ExpenseAccountID,
+// replacing the rate it had before. The expense account has to hold the currency of the account.
+func SetInterestRate(DB *sql.DB, rate *InterestRate) error {
+	if rate.AccountID == rate.ExpenseAccountID {
+		return ErrInterestExpenseAccount
+	}
+	account := Account{}
+	err := QueryAccountByAccountId(DB, rate.AccountID, &account)
+	if err != nil {
+		return err
+	}
+	expenseAccount := Account{}
+	err = QueryAccountByAccountId(DB, rate.ExpenseAccountID, &expenseAccount)
+	if err != nil {
+		return err
+	}
+	if account.Currency != expenseAccount.Currency {
+		return ErrCurrencyMismatch.withMessage("expense account must hold the currency of the account")
+	}
+
+	_, err = DB.Exec(`
+    INSERT INTO interest_rates (account_id, annual_rate, expense_account_id)
+    VALUES ($1, $2, $3)
+    ON CONFLICT (account_id) DO UPDATE SET annual_rate = EXCLUDED.annual_rate,
+                                           expense_account_id = EXCLUDED.expense_account_id,
+                                           updated_at = CURRENT_TIMESTAMP
+`, rate.AccountID, rate.AnnualRate, rate.ExpenseAccountID)
+	return err
+}
+
+// QueryInterestRate fills rate with the interest rate of rate.AccountID
+func QueryInterestRate(DB *sql.DB, rate *InterestRate) error {
+	err := DB.QueryRow("SELECT annual_rate, expense_account_id FROM interest_rates WHERE account_id = $1", rate.AccountID).Scan(
+		&rate.AnnualRate, &rate.ExpenseAccountID)
+	return notFound(err, ErrInterestRateNotFound)
+}
+
+// QueryInterestAccruals fills accruals with the accruals of the account, newest first
+func QueryInterestAccruals(DB *sql.DB, accountID int, accruals *[]InterestAccrual) error {
+	rows, err := DB.Query("SELECT "+interestAccrualColumns+" FROM interest_accruals WHERE account_id = $1 ORDER BY accrual_date DESC", accountID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	*accruals = []InterestAccrual{}
+	for rows.Next() {
+		accrual := InterestAccrual{}
+		err = scanInterestAccrual(rows, &accrual)
+		if err != nil {
+			return err
+		}
+		*accruals = append(*accruals, accrual)
+	}
+	return rows.Err()
+}
+
+// AccrueInterest records the interest every account with an interest rate earned on date, from its balance at the
+// end of that day in the ledger, and returns how many accruals were recorded. An account that already has an
+// accrual for date is skipped, so running it again for the same day, or from two instances at once, is harmless.
+func AccrueInterest(DB *sql.DB, date time.Time) (int, error) {
+	day := date.Format(dateLayout)
+	rows, err := DB.Query(`
+    SELECT r.account_id, r.annual_rate
+    FROM interest_rates r
+    WHERE r.created_at < $1::date + 1
+      AND NOT EXISTS (SELECT 1 FROM interest_accruals a WHERE a.account_id = r.account_id AND a.accrual_date = $1::date)
+    ORDER BY r.account_id
+`, day)
+	if err != nil {
+		return 0, err
+	}
+	var rates []InterestRate
+	for rows.Next() {
+		rate := InterestRate{}
+		err = rows.Scan(&rate.AccountID, &rate.AnnualRate)
+		if err != nil {
+			rows.Close()
+			return 0, err
+		}
+		rates = append(rates, rate)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return 0, err
+	}
+
+	accrued := 0
+	for _, rate := range rates {
+		// Postings are never changed once written, so the balance at the end of a past day cannot change either
+		var balance Money
+		err = DB.QueryRow(`
+    SELECT COALESCE(SUM(p.amount), 0)
+    FROM postings p
+    JOIN journal_entries e ON e.id = p.journal_entry_id
+    WHERE p.account_id = $1 AND e.created_at < $2::date + 1
+`, rate.AccountID, day).Scan(&balance)
+		if err != nil {
+			return accrued, err
+		}
+		result, err := DB.Exec(`
+    INSERT INTO interest_accruals (account_id, accrual_date, balance, annual_rate, amount)
+    VALUES ($1, $2, $3, $4, $5)
+    ON CONFLICT (account_id, accrual_date) DO NOTHING
+`, rate.AccountID, day, balance, rate.AnnualRate, rate.DailyInterest(balance))
+		if err != nil {
+			return accrued, err
+		}
+		inserted, err := result.RowsAffected()
+		if err != nil {
+			return accrued, err
+		}
+		accrued += int(inserted)
+	}
+	return accrued, nil
+}
+
+// AccrueMissingInterest accrues interest with AccrueInterest for every day up to and including through that an
+// account with an interest rate has no accrual for yet, from the day after its last accrual or else from the day its
+// rate was set. It returns how many accruals were recorded. Days are accrued in order and it stops at the first
+// failure, so that the days the server was down or failed on are caught up the next time it runs.
+func AccrueMissingInterest(DB *sql.DB, through time.Time) (int, error) {
+	var first sql.NullTime
+	err := DB.QueryRow(`
+    SELECT MIN(COALESCE((SELECT MAX(a.accrual_date) + 1 FROM interest_accruals a WHERE a.account_id = r.account_id),
+                        r.created_at::date))
+    FROM interest_rates r
+`).Scan(&first)
+	if err != nil || !first.Valid {
+		return 0, err
+	}
+
+	accrued := 0
+	last := through.Format(dateLayout)
+	for date := first.Time; date.Format(dateLayout) <= last; date = date.AddDate(0, 0, 1) {
+		count, err := AccrueInterest(DB, date)
+		accrued += count
+		if err != nil {
+			return accrued, err
+		}
+	}
+	return accrued, nil
+}
+
+// QueryAccountsWithUnpostedInterest returns the IDs of the accounts with accruals dated before before
+// that have not been posted yet
+func QueryAccountsWithUnpostedInterest(DB *sql.DB, before time.Time) ([]int, error) {
+	rows, err := DB.Query("SELECT DISTINCT account_id FROM interest_accruals WHERE transaction_id IS NULL AND accrual_date < $1::date ORDER BY account_id",
+		before.Format(dateLayout))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var accountIDs []int
+	for rows.Next() {
+		var accountID int
+		err = rows.Scan(&accountID)
+		if err != nil {
+			return nil, err
+		}
+		accountIDs = append(accountIDs, accountID)
+	}
+	return accountIDs, rows.Err()
+}
+
+// PostInterest pays the account the interest it accrued before before, as one transfer from its expense account,
+// and fills record with the transfer. The total is rounded down to the currency of the account and what was rounded
+// off is kept as the rounding remainder of the transfer, which is carried into the total of the next posting, so that
+// no interest is lost to rounding over time.
+// It fails with ErrNoInterestToPost if there is nothing to post, or if the total rounds down to zero, in which case
+// the accruals are left to be posted together with the next ones.
+func PostInterest(DB *sql.DB, accountID int, before time.Time, record *TransactionRecord) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	var expenseAccountID int
+	err = dbtx.QueryRow("SELECT expense_account_id FROM interest_rates WHERE account_id = $1", accountID).Scan(&expenseAccountID)
+	if err != nil {
+		return notFound(err, ErrInterestRateNotFound)
+	}
+
+	// Locking the accruals serialises concurrent postings for the account, the one that waited sees them posted
+	rows, err := dbtx.Query("SELECT id FROM interest_accruals WHERE account_id = $1 AND transaction_id IS NULL AND accrual_date < $2::date ORDER BY id FOR UPDATE",
+		accountID, before.Format(dateLayout))
+	if err != nil {
+		return err
+	}
+	var accrualIDs []int
+	for rows.Next() {
+		var accrualID int
+		err = rows.Scan(&accrualID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		accrualIDs = append(accrualIDs, accrualID)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	if len(accrualIDs) == 0 {
+		return ErrNoInterestToPost
+	}
+	// The remainder of the previous posting already includes the one carried into it, so only the last one is added
+	var total string
+	err = dbtx.QueryRow(`
+    SELECT SUM(a.amount) + COALESCE((
+        SELECT t.rounding_remainder
+        FROM account_transactions t
+        WHERE t.id = (SELECT MAX(transaction_id) FROM interest_accruals WHERE account_id = $1)
+    ), 0)
+    FROM interest_accruals a
+    WHERE a.id = ANY($2)
+`, accountID, pq.Array(accrualIDs)).Scan(&total)
+	if err != nil {
+		return err
+	}
+
+	// The accounts are locked in the same order as by ProcessTransaction
+	accounts, err := lockAccounts(dbtx, []int{expenseAccountID, accountID})
+	if err != nil {
+		return err
+	}
+	expense := accounts[expenseAccountID]
+	account := accounts[accountID]
+	if expense.Currency != account.Currency {
+		return ErrCurrencyMismatch
+	}
+	amount, remainder, err := RoundInterest(total, account.Currency)
+	if err != nil {
+		return err
+	}
+	if amount == 0 {
+		return ErrNoInterestToPost
+	}
+	if !expense.canSpend(amount) {
+		return ErrInsufficientBalance
+	}
+
+	record.SourceAccountID = expenseAccountID
+	record.DestinationAccountID = accountID
+	record.Amount = amount
+	record.Currency = account.Currency
+	record.DestinationAmount = amount
+	record.DestinationCurrency = account.Currency
+	record.RoundingRemainder = &remainder
+	err = recordTransfer(dbtx, accounts, "interest", record)
+	if err != nil {
+		return err
+	}
+	err = writeBalances(dbtx, accounts)
+	if err != nil {
+		return err
+	}
+
+	_, err = dbtx.Exec("UPDATE interest_accruals SET transaction_id = $1 WHERE id = ANY($2)", record.TransactionID, pq.Array(accrualIDs))
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
@@ -0,0 +1,123 @@
+package db
+
+import (
+	"database/sql"
+	. "takeHomeAssignment/entities"
+)
+
+// insertJournalEntry writes the entry and its postings inside dbtx.
+// The database checks again that the postings balance when dbtx commits.
+func insertJournalEntry(dbtx *sql.Tx, entry *JournalEntry) error {
+	err := entry.Validate()
+	if err != nil {
+		return err
+	}
+	err = dbtx.QueryRow("INSERT INTO journal_entries (transaction_id, description) VALUES ($1, $2) RETURNING id, created_at",
+		entry.TransactionID, entry.Description).Scan(&entry.JournalEntryID, &entry.CreatedAt)
+	if err != nil {
+		return err
+	}
+	for _, posting := range entry.Postings {
+		var systemAccount *string
+		if posting.SystemAccount != "" {
+			systemAccount = &posting.SystemAccount
+		}
+		_, err = dbtx.Exec("INSERT INTO postings (journal_entry_id, account_id, system_account, amount, currency) VALUES ($1, $2, $3, $4, $5)",
+			entry.JournalEntryID, posting.AccountID, systemAccount, posting.Amount, posting.Currency)
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// QueryJournalEntriesByTransactionId fills entries with the journal entries recording a transfer
+func QueryJournalEntriesByTransactionId(DB *sql.DB, transactionID int, entries *[]JournalEntry) error {
+	rows, err := DB.Query(`
+    SELECT e.id, e.transaction_id, e.description, e.created_at, p.account_id, p.system_account, p.amount, p.currency
+    FROM journal_entries e
+    JOIN postings p ON p.journal_entry_id = e.id
+    WHERE e.transaction_id = $1
+    ORDER BY e.id, p.id
+`, transactionID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	*entries = []JournalEntry{}
+	for rows.Next() {
+		var entry JournalEntry
+		var posting Posting
+		var systemAccount sql.NullString
+		err = rows.Scan(&entry.JournalEntryID, &entry.TransactionID, &entry.Description, &entry.CreatedAt,
+			&posting.AccountID, &systemAccount, &posting.Amount, &posting.Currency)
+		if err != nil {
+			return err
+		}
+		posting.SystemAccount = systemAccount.String
+		last := len(*entries) - 1
+		if last < 0 || (*entries)[last].JournalEntryID != entry.JournalEntryID {
+			*entries = append(*entries, entry)
+			last++
+		}
+		(*entries)[last].Postings = append((*entries)[last].Postings, posting)
+	}
+	return rows.Err()
+}
+
+// QueryLedgerBalance sums every posting to the account, which is what its cached balance in account_balance must equal
+func QueryLedgerBalance(DB *sql.DB, accountID int) (Money, error) {
+	var balance Money
+	err := DB.QueryRow("SELECT COALESCE(SUM(amount), 0) FROM postings WHERE account_id = $1", accountID).Scan(&balance)
+	return balance, err
+}
+
+// RebuildAccountBalances recomputes every cached balance in account_balance from the postings,
+// and returns the IDs of the accounts whose cached balance was wrong
+func RebuildAccountBalances(DB *sql.DB) ([]int, error) {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return nil, err
+	}
+	defer rollback(dbtx)
+
+	// Transfers update account_balance and insert postings in one transaction, so blocking them
+	// while we rebuild makes sure every balance is computed from a complete set of postings
+	_, err = dbtx.Exec("LOCK TABLE account_balance IN SHARE ROW EXCLUSIVE MODE")
+	if err != nil {
+		return nil, err
+	}
+	rows, err := dbtx.Query(`
+    UPDATE account_balance b
+    SET balance = ledger.balance, updated_at = CURRENT_TIMESTAMP
+    FROM (
+        SELECT a.account_id, COALESCE(SUM(p.amount), 0) AS balance
+        FROM account_balance a
+        LEFT JOIN postings p ON p.account_id = a.account_id
+        GROUP BY a.account_id
+    ) ledger
+    WHERE b.account_id = ledger.account_id AND b.balance <> ledger.balance
+    RETURNING b.account_id
+`)
+	if err != nil {
+		return nil, err
+	}
+
+	corrected := []int{}
+	for rows.Next() {
+		var accountID int
+		err = rows.Scan(&accountID)
+		if err != nil {
+			rows.Close()
+			return nil, err
+		}
+		corrected = append(corrected, accountID)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return nil, err
+	}
+	return corrected, dbtx.Commit()
+}
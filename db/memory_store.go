@@ -0,0 +1,200 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"sync"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+// MemoryStore is a Store that keeps accounts, transfers and idempotency keys in memory, for tests and local runs.
+// Every operation holds one lock, so transfers are atomic and never see a balance another transfer is changing.
+// It has no fee schedules, approval policies, exchange rates or transfer limits, and accounts stay active,
+// so it behaves like a Postgres database where none of those were ever set up. The other features of Store, such as
+// holds, return ErrNotSupported.
+type MemoryStore struct {
+	unsupportedFeatures
+	mu              sync.RWMutex
+	accounts        map[int]*Account
+	transactions    []TransactionRecord
+	idempotencyKeys map[[2]string]IdempotencyKey
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{
+		accounts:        map[int]*Account{},
+		idempotencyKeys: map[[2]string]IdempotencyKey{},
+	}
+}
+
+func (s *MemoryStore) CreateAccount(account *Account, idempotencyKey *IdempotencyKey) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if idempotencyKey != nil && s.idempotencyKeyInUse(idempotencyKey) {
+		return ErrIdempotencyKeyInUse
+	}
+	if _, exists := s.accounts[account.AccountID]; exists {
+		return ErrAccountExists
+	}
+	if account.Currency == "" {
+		account.Currency = DefaultCurrency
+	}
+	if account.AccountType == "" {
+		account.AccountType = DefaultAccountType
+	}
+	err := account.Currency.ValidateAmount(account.Balance)
+	if err != nil {
+		return err
+	}
+	// Like the check constraint on account_balance
+	if account.Balance < 0 {
+		return ErrInsufficientBalance
+	}
+	account.AvailableBalance = account.Balance
+	account.Status = AccountStatusActive
+	account.OverdraftLimit = 0
+	account.UnlimitedOverdraft = false
+
+	stored := *account
+	s.accounts[account.AccountID] = &stored
+	if idempotencyKey != nil {
+		s.insertIdempotencyKey(idempotencyKey)
+	}
+	return nil
+}
+
+func (s *MemoryStore) QueryAccountByAccountId(accountID int, account *Account) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.accounts[accountID]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	*account = *stored
+	return nil
+}
+
+func (s *MemoryStore) ProcessTransaction(transaction *Transaction, idempotencyKey *IdempotencyKey, record *TransactionRecord) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	source, ok := s.accounts[transaction.SourceAccountID]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	dest, ok := s.accounts[transaction.DestinationAccountID]
+	if !ok {
+		return ErrAccountNotFound
+	}
+	if !source.CanSpend(transaction.Amount) {
+		return ErrInsufficientBalance
+	}
+	err := source.Currency.ValidateAmount(transaction.Amount)
+	if err != nil {
+		return err
+	}
+	if source.Currency != dest.Currency {
+		if !transaction.ConvertCurrency {
+			return ErrCurrencyMismatch
+		}
+		return ErrNoExchangeRate
+	}
+	if idempotencyKey != nil && s.idempotencyKeyInUse(idempotencyKey) {
+		return ErrIdempotencyKeyInUse
+	}
+
+	source.Balance -= transaction.Amount
+	source.AvailableBalance -= transaction.Amount
+	dest.Balance += transaction.Amount
+	dest.AvailableBalance += transaction.Amount
+	*record = TransactionRecord{
+		TransactionID:           len(s.transactions) + 1,
+		SourceAccountID:         transaction.SourceAccountID,
+		DestinationAccountID:    transaction.DestinationAccountID,
+		Amount:                  transaction.Amount,
+		Currency:                source.Currency,
+		DestinationAmount:       transaction.Amount,
+		DestinationCurrency:     dest.Currency,
+		SourceBalanceAfter:      source.Balance,
+		DestinationBalanceAfter: dest.Balance,
+		CreatedAt:               time.Now().UTC(),
+	}
+	s.transactions = append(s.transactions, *record)
+
+	if idempotencyKey != nil {
+		idempotencyKey.ResponseBody, err = json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		idempotencyKey.ResponseLocation = record.Location()
+		s.insertIdempotencyKey(idempotencyKey)
+	}
+	return nil
+}
+
+func (s *MemoryStore) QueryTransactionById(transactionID int, record *TransactionRecord) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	if transactionID < 1 || transactionID > len(s.transactions) {
+		return ErrTransactionNotFound
+	}
+	*record = s.transactions[transactionID-1]
+	return nil
+}
+
+// QueryTransferFee leaves fee untouched, there are no fee schedules
+func (s *MemoryStore) QueryTransferFee(transaction *Transaction, fee *Fee) error {
+	return nil
+}
+
+// QueryApprovalPolicy returns sql.ErrNoRows, there are no approval policies
+func (s *MemoryStore) QueryApprovalPolicy(policy *ApprovalPolicy) error {
+	return sql.ErrNoRows
+}
+
+// CreateTransferApproval returns ErrNotSupported, transfers never need approval without approval policies
+func (s *MemoryStore) CreateTransferApproval(transaction *Transaction, requestedBy string, policy *ApprovalPolicy, idempotencyKey *IdempotencyKey, approval *TransferApproval) error {
+	return ErrNotSupported
+}
+
+func (s *MemoryStore) QueryIdempotencyKey(scope string, key string, idempotencyKey *IdempotencyKey) error {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	stored, ok := s.idempotencyKeys[[2]string{scope, key}]
+	if !ok || time.Since(stored.CreatedAt) > IdempotencyKeyRetention {
+		return sql.ErrNoRows
+	}
+	*idempotencyKey = stored
+	return nil
+}
+
+func (s *MemoryStore) DeleteExpiredIdempotencyKeys() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var deleted int64
+	for id, stored := range s.idempotencyKeys {
+		if time.Since(stored.CreatedAt) > IdempotencyKeyRetention {
+			delete(s.idempotencyKeys, id)
+			deleted++
+		}
+	}
+	return deleted, nil
+}
+
+// idempotencyKeyInUse reports whether the key is still retained, the caller holds the write lock
+func (s *MemoryStore) idempotencyKeyInUse(idempotencyKey *IdempotencyKey) bool {
+	stored, ok := s.idempotencyKeys[[2]string{idempotencyKey.Scope, idempotencyKey.Key}]
+	return ok && time.Since(stored.CreatedAt) <= IdempotencyKeyRetention
+}
+
+// insertIdempotencyKey stores the key, overwriting an expired one, the caller holds the write lock
+func (s *MemoryStore) insertIdempotencyKey(idempotencyKey *IdempotencyKey) {
+	idempotencyKey.CreatedAt = time.Now()
+	s.idempotencyKeys[[2]string{idempotencyKey.Scope, idempotencyKey.Key}] = *idempotencyKey
+}
@@ -0,0 +1,219 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"embed"
+	"fmt"
+	"io/fs"
+	"regexp"
+	"sort"
+	"strconv"
+)
+
+//go:embed migrations/*.sql
+var migrationFiles embed.FS
+
+// migrationLockID is the key of the advisory lock held while migrating, so that of several instances starting at
+// once only one migrates and the others wait and then find nothing left to do
+const migrationLockID = 7_283_901_164
+
+// Migration is a numbered change of the Postgres schema, with the SQL to apply and to revert it
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// migrationFileName is like 0002_add_column.up.sql
+var migrationFileName = regexp.MustCompile(`^(\d+)_(\w+)\.(up|down)\.sql$`)
+
+// Migrations returns the migrations in db/migrations, oldest first
+func Migrations() ([]Migration, error) {
+	files, err := fs.ReadDir(migrationFiles, "migrations")
+	if err != nil {
+		return nil, err
+	}
+	byVersion := map[int]*Migration{}
+	for _, file := range files {
+		match := migrationFileName.FindStringSubmatch(file.Name())
+		if match == nil {
+			return nil, fmt.Errorf("migration %s is not named like 0001_name.up.sql", file.Name())
+		}
+		version, _ := strconv.Atoi(match[1])
+		migration, ok := byVersion[version]
+		if !ok {
+			migration = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = migration
+		}
+		if migration.Name != match[2] {
+			return nil, fmt.Errorf("migration %d is named both %s and %s", version, migration.Name, match[2])
+		}
+		content, err := migrationFiles.ReadFile("migrations/" + file.Name())
+		if err != nil {
+			return nil, err
+		}
+		if match[3] == "up" {
+			migration.Up = string(content)
+		} else {
+			migration.Down = string(content)
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, migration := range byVersion {
+		if migration.Up == "" || migration.Down == "" {
+			return nil, fmt.Errorf("migration %d_%s needs both an up and a down file", migration.Version, migration.Name)
+		}
+		migrations = append(migrations, *migration)
+	}
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+// MigrationVersion returns the version of the last migration applied to the database, 0 if there is none
+func MigrationVersion(ctx context.Context, DB *sql.DB) (int, error) {
+	var exists bool
+	err := DB.QueryRowContext(ctx, "SELECT to_regclass('schema_migrations') IS NOT NULL").Scan(&exists)
+	if err != nil || !exists {
+		return 0, err
+	}
+	var version int
+	err = DB.QueryRowContext(ctx, "SELECT COALESCE(MAX(version), 0) FROM schema_migrations").Scan(&version)
+	if err != nil {
+		return 0, err
+	}
+	return version, nil
+}
+
+// MigrateUp applies the migrations newer than the database in order, each in its own transaction together with its
+// row in schema_migrations, and returns the versions it applied.
+// A database created by db/init.sql before there were migrations has the tables of the first migration but no
+// schema_migrations rows, the first migration is then recorded as applied without running it.
+func MigrateUp(ctx context.Context, DB *sql.DB) ([]int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var applied []int
+	err = withMigrationLock(ctx, DB, func(conn *sql.Conn) error {
+		version, err := baselineVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			if migration.Version <= version {
+				continue
+			}
+			err = runMigration(ctx, conn, migration.Up, "INSERT INTO schema_migrations (version, name) VALUES ($1, $2)", migration.Version, migration.Name)
+			if err != nil {
+				return fmt.Errorf("migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			applied = append(applied, migration.Version)
+		}
+		return nil
+	})
+	return applied, err
+}
+
+// MigrateDown reverts the last steps migrations applied to the database, newest first, and returns the versions it
+// reverted
+func MigrateDown(ctx context.Context, DB *sql.DB, steps int) ([]int, error) {
+	migrations, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var reverted []int
+	err = withMigrationLock(ctx, DB, func(conn *sql.Conn) error {
+		version, err := baselineVersion(ctx, conn)
+		if err != nil {
+			return err
+		}
+		for i := len(migrations) - 1; i >= 0 && len(reverted) < steps; i-- {
+			migration := migrations[i]
+			if migration.Version > version {
+				continue
+			}
+			err = runMigration(ctx, conn, migration.Down, "DELETE FROM schema_migrations WHERE version = $1", migration.Version)
+			if err != nil {
+				return fmt.Errorf("reverting migration %d_%s: %w", migration.Version, migration.Name, err)
+			}
+			reverted = append(reverted, migration.Version)
+		}
+		return nil
+	})
+	return reverted, err
+}
+
+// withMigrationLock runs migrate on a connection holding the migration lock, creating schema_migrations first.
+// The advisory lock belongs to the session, so everything runs on the same connection.
+func withMigrationLock(ctx context.Context, DB *sql.DB, migrate func(conn *sql.Conn) error) error {
+	conn, err := DB.Conn(ctx)
+	if err != nil {
+		return err
+	}
+	defer conn.Close()
+
+	_, err = conn.ExecContext(ctx, "SELECT pg_advisory_lock($1)", migrationLockID)
+	if err != nil {
+		return err
+	}
+	// Unlocked even if ctx is done, closing the connection only returns it to the pool with the lock still held
+	defer conn.ExecContext(context.Background(), "SELECT pg_advisory_unlock($1)", migrationLockID)
+
+	_, err = conn.ExecContext(ctx, `
+    CREATE TABLE IF NOT EXISTS schema_migrations (
+        version INTEGER PRIMARY KEY,
+        name VARCHAR(255) NOT NULL,
+        applied_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP)
+`)
+	if err != nil {
+		return err
+	}
+	return migrate(conn)
+}
+
+// baselineVersion returns the version of the database, recording the first migration as applied if the database was
+// created by db/init.sql
+func baselineVersion(ctx context.Context, conn *sql.Conn) (int, error) {
+	var version int
+	var initialized bool
+	err := conn.QueryRowContext(ctx, `
+    SELECT COALESCE((SELECT MAX(version) FROM schema_migrations), 0), to_regclass('account_balance') IS NOT NULL
+`).Scan(&version, &initialized)
+	if err != nil {
+		return 0, err
+	}
+	if version == 0 && initialized {
+		_, err = conn.ExecContext(ctx, "INSERT INTO schema_migrations (version, name) VALUES (1, 'initial')")
+		if err != nil {
+			return 0, err
+		}
+		version = 1
+	}
+	return version, nil
+}
+
+// runMigration runs the migration SQL and the statement recording it in one transaction
+func runMigration(ctx context.Context, conn *sql.Conn, migration string, record string, args ...interface{}) error {
+	dbtx, err := conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	_, err = dbtx.ExecContext(ctx, migration)
+	if err != nil {
+		return err
+	}
+	_, err = dbtx.ExecContext(ctx, record, args...)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
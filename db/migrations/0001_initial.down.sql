@@ -0,0 +1,3 @@
+-- Drop everything 0001_initial.up.sql created, the indexes go with their tables
+DROP TABLE account_transactions;
+DROP TABLE account_balance;
@@ -0,0 +1,8 @@
+ALTER TABLE account_transactions
+    DROP COLUMN currency,
+    ALTER COLUMN amount TYPE DECIMAL(15, 2);
+
+ALTER TABLE account_balance
+    DROP COLUMN currency,
+    ALTER COLUMN balance SET DEFAULT 0.00,
+    ALTER COLUMN balance TYPE DECIMAL(15, 2);
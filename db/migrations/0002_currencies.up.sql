@@ -0,0 +1,10 @@
+-- Amounts are kept with three decimals, the most any supported currency has, and every account and transfer has a
+-- currency. Existing accounts and transfers were all in dollars.
+ALTER TABLE account_balance
+    ALTER COLUMN balance TYPE DECIMAL(18, 3),
+    ALTER COLUMN balance SET DEFAULT 0.000,
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
+
+ALTER TABLE account_transactions
+    ALTER COLUMN amount TYPE DECIMAL(18, 3),
+    ADD COLUMN currency CHAR(3) NOT NULL DEFAULT 'USD';
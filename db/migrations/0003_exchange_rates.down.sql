@@ -0,0 +1,7 @@
+DROP TABLE exchange_rates;
+
+ALTER TABLE account_transactions
+    DROP COLUMN rounding_remainder,
+    DROP COLUMN exchange_rate,
+    DROP COLUMN destination_currency,
+    DROP COLUMN destination_amount;
@@ -0,0 +1,21 @@
+-- A transfer records the amount that reached the destination, which differs from amount when it was converted.
+-- Existing transfers were never converted.
+ALTER TABLE account_transactions
+    ADD COLUMN destination_amount DECIMAL(18, 3),
+    ADD COLUMN destination_currency CHAR(3) NOT NULL DEFAULT 'USD',
+    ADD COLUMN exchange_rate DECIMAL(18, 10),
+    ADD COLUMN rounding_remainder DECIMAL(26, 13);
+
+UPDATE account_transactions SET destination_amount = amount, destination_currency = currency;
+
+ALTER TABLE account_transactions ALTER COLUMN destination_amount SET NOT NULL;
+
+-- Create the exchange rate table, a rate applies from effective_at until a later rate for the same pair
+CREATE TABLE exchange_rates (
+                             id SERIAL PRIMARY KEY,
+                             base_currency CHAR(3) NOT NULL,
+                             quote_currency CHAR(3) NOT NULL,
+                             rate DECIMAL(18, 10) NOT NULL CHECK (rate > 0),
+                             effective_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             UNIQUE (base_currency, quote_currency, effective_at));
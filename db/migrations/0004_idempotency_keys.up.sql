@@ -0,0 +1,11 @@
+-- Create the idempotency key table, a key is stored in the same transaction as the work it guards
+CREATE TABLE idempotency_keys (
+                             scope VARCHAR(64) NOT NULL,
+                             idempotency_key VARCHAR(255) NOT NULL,
+                             request_fingerprint CHAR(64) NOT NULL,
+                             response_status INTEGER NOT NULL,
+                             response_body BYTEA NOT NULL,
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             PRIMARY KEY (scope, idempotency_key));
+
+CREATE INDEX idx_idempotency_keys_created_at ON idempotency_keys (created_at);
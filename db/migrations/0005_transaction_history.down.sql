@@ -0,0 +1,7 @@
+DROP INDEX idx_transaction_account_transfer_in;
+DROP INDEX idx_transaction_account_transfer_out;
+CREATE INDEX idx_transaction_account_transfer ON account_transactions (account_transfer_out, account_transfer_in, amount);
+
+ALTER TABLE account_transactions
+    DROP COLUMN destination_balance_after,
+    DROP COLUMN source_balance_after;
@@ -0,0 +1,32 @@
+-- A transfer records the balances it left both accounts with
+ALTER TABLE account_transactions
+    ADD COLUMN source_balance_after DECIMAL(18, 3),
+    ADD COLUMN destination_balance_after DECIMAL(18, 3);
+
+-- Balances have only ever changed through transfers, so the balance an account had after a transfer is its current
+-- balance minus every change made to it by the later transfers
+WITH changes AS (
+    SELECT id, account_transfer_out AS account_id, -amount AS change FROM account_transactions
+    UNION ALL
+    SELECT id, account_transfer_in, destination_amount FROM account_transactions
+), balances_after AS (
+    SELECT c.id, c.account_id,
+           b.balance - COALESCE(SUM(c.change) OVER (PARTITION BY c.account_id ORDER BY c.id DESC
+                                                    ROWS BETWEEN UNBOUNDED PRECEDING AND 1 PRECEDING), 0) AS balance
+    FROM changes c
+    JOIN account_balance b ON b.account_id = c.account_id
+)
+UPDATE account_transactions t
+SET source_balance_after = out_after.balance, destination_balance_after = in_after.balance
+FROM balances_after out_after, balances_after in_after
+WHERE out_after.id = t.id AND out_after.account_id = t.account_transfer_out
+  AND in_after.id = t.id AND in_after.account_id = t.account_transfer_in;
+
+ALTER TABLE account_transactions
+    ALTER COLUMN source_balance_after SET NOT NULL,
+    ALTER COLUMN destination_balance_after SET NOT NULL;
+
+-- Per-account history is read newest first, once for each direction
+DROP INDEX idx_transaction_account_transfer;
+CREATE INDEX idx_transaction_account_transfer_out ON account_transactions (account_transfer_out, created_at, id);
+CREATE INDEX idx_transaction_account_transfer_in ON account_transactions (account_transfer_in, created_at, id);
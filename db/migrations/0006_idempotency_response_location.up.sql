@@ -0,0 +1,2 @@
+-- The Location header of the stored response, replayed with it
+ALTER TABLE idempotency_keys ADD COLUMN response_location VARCHAR(255) NOT NULL DEFAULT '';
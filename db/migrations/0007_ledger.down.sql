@@ -0,0 +1,5 @@
+-- The indexes and triggers go with their tables
+DROP TABLE postings;
+DROP FUNCTION reject_posting_change();
+DROP FUNCTION check_journal_entry_balanced();
+DROP TABLE journal_entries;
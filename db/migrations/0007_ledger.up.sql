@@ -0,0 +1,69 @@
+-- Create the ledger. Every movement of money is a journal entry whose postings sum to zero in every currency,
+-- and account_balance.balance is a cached projection of the postings to each account.
+-- A posting goes either to a customer account or to a system account such as opening_balance or fx_position:EUR.
+CREATE TABLE journal_entries (
+                             id SERIAL PRIMARY KEY,
+                             transaction_id INTEGER REFERENCES account_transactions(id),
+                             description VARCHAR(255) NOT NULL,
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);
+
+CREATE TABLE postings (
+                             id SERIAL PRIMARY KEY,
+                             journal_entry_id INTEGER NOT NULL REFERENCES journal_entries(id),
+                             account_id INTEGER REFERENCES account_balance(account_id),
+                             system_account VARCHAR(64),
+                             amount DECIMAL(18, 3) NOT NULL CHECK (amount <> 0),
+                             currency CHAR(3) NOT NULL,
+                             CHECK ((account_id IS NULL) <> (system_account IS NULL)));
+
+-- Checked when the transaction commits, so all postings of an entry can be inserted one by one first
+CREATE FUNCTION check_journal_entry_balanced() RETURNS TRIGGER AS $$
+BEGIN
+    IF EXISTS (
+        SELECT 1
+        FROM postings
+        WHERE journal_entry_id = NEW.journal_entry_id
+        GROUP BY currency
+        HAVING SUM(amount) <> 0
+    ) THEN
+        RAISE EXCEPTION 'journal entry % does not balance', NEW.journal_entry_id;
+    END IF;
+    RETURN NULL;
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE CONSTRAINT TRIGGER postings_balanced
+    AFTER INSERT ON postings
+    DEFERRABLE INITIALLY DEFERRED
+    FOR EACH ROW EXECUTE FUNCTION check_journal_entry_balanced();
+
+-- Postings are an append-only audit trail, mistakes are corrected with a new journal entry
+CREATE FUNCTION reject_posting_change() RETURNS TRIGGER AS $$
+BEGIN
+    RAISE EXCEPTION 'postings cannot be updated or deleted';
+END;
+$$ LANGUAGE plpgsql;
+
+CREATE TRIGGER postings_append_only
+    BEFORE UPDATE OR DELETE ON postings
+    FOR EACH ROW EXECUTE FUNCTION reject_posting_change();
+
+CREATE INDEX idx_journal_entries_transaction_id ON journal_entries (transaction_id);
+CREATE INDEX idx_postings_journal_entry_id ON postings (journal_entry_id);
+CREATE INDEX idx_postings_account_id ON postings (account_id);
+
+-- The existing balances were not built from postings, each is carried into the ledger as the opening balance of its
+-- account, like the balance an account is created with
+DO $$
+DECLARE
+    account RECORD;
+    entry_id INTEGER;
+BEGIN
+    FOR account IN SELECT account_id, balance, currency FROM account_balance WHERE balance <> 0 ORDER BY account_id LOOP
+        INSERT INTO journal_entries (description) VALUES ('opening balance') RETURNING id INTO entry_id;
+        INSERT INTO postings (journal_entry_id, account_id, system_account, amount, currency)
+        VALUES (entry_id, NULL, 'opening_balance', -account.balance, account.currency),
+               (entry_id, account.account_id, NULL, account.balance, account.currency);
+    END LOOP;
+END;
+$$;
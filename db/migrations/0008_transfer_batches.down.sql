@@ -0,0 +1,2 @@
+ALTER TABLE account_transactions DROP COLUMN batch_id;
+DROP TABLE transfer_batches;
@@ -0,0 +1,8 @@
+-- Create the batch table, the transfers of a batch are committed or rolled back together
+CREATE TABLE transfer_batches (
+                             id SERIAL PRIMARY KEY,
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);
+
+ALTER TABLE account_transactions ADD COLUMN batch_id INTEGER REFERENCES transfer_batches(id);
+
+CREATE INDEX idx_transaction_batch_id ON account_transactions (batch_id);
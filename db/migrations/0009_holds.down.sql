@@ -0,0 +1,7 @@
+DROP TABLE holds;
+
+-- Fails if an account is left with a balance below zero
+ALTER TABLE account_balance
+    DROP CONSTRAINT account_balance_available_check,
+    DROP COLUMN held,
+    ADD CONSTRAINT account_balance_balance_check CHECK (balance >= 0);
@@ -0,0 +1,22 @@
+-- Funds reserved by active holds, balance - held is the available balance and is what may not go below zero
+ALTER TABLE account_balance
+    ADD COLUMN held DECIMAL(18, 3) NOT NULL DEFAULT 0.000 CHECK (held >= 0),
+    DROP CONSTRAINT account_balance_balance_check,
+    ADD CONSTRAINT account_balance_available_check CHECK (balance - held >= 0);
+
+-- Create the hold table. An active hold reserves amount on the source account (account_balance.held)
+-- until it is captured into a transfer, voided, or expires.
+CREATE TABLE holds (
+                             id SERIAL PRIMARY KEY,
+                             source_account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             destination_account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             amount DECIMAL(18, 3) NOT NULL CHECK (amount > 0),
+                             captured_amount DECIMAL(18, 3) NOT NULL DEFAULT 0.000 CHECK (captured_amount <= amount),
+                             currency CHAR(3) NOT NULL,
+                             status VARCHAR(16) NOT NULL CHECK (status IN ('active', 'captured', 'voided', 'expired')),
+                             transaction_id INTEGER REFERENCES account_transactions(id),
+                             expires_at TIMESTAMP NOT NULL,
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);
+
+CREATE INDEX idx_holds_active_expires_at ON holds (expires_at) WHERE status = 'active';
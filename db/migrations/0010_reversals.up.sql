@@ -0,0 +1,4 @@
+-- A reversal references the transfer it reverses in reversal_of
+ALTER TABLE account_transactions ADD COLUMN reversal_of INTEGER REFERENCES account_transactions(id);
+
+CREATE INDEX idx_transaction_reversal_of ON account_transactions (reversal_of);
@@ -0,0 +1,2 @@
+DROP TABLE account_status_changes;
+ALTER TABLE account_balance DROP COLUMN status;
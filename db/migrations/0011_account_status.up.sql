@@ -0,0 +1,13 @@
+ALTER TABLE account_balance
+    ADD COLUMN status VARCHAR(16) NOT NULL DEFAULT 'active' CHECK (status IN ('active', 'frozen', 'closed'));
+
+-- Create the account status history, every freeze, unfreeze and closure is recorded with its reason
+CREATE TABLE account_status_changes (
+                             id SERIAL PRIMARY KEY,
+                             account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             from_status VARCHAR(16) NOT NULL,
+                             to_status VARCHAR(16) NOT NULL,
+                             reason VARCHAR(255) NOT NULL,
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);
+
+CREATE INDEX idx_account_status_changes_account_id ON account_status_changes (account_id, id);
@@ -0,0 +1,6 @@
+-- Fails if an account is left overdrawn
+ALTER TABLE account_balance
+    DROP CONSTRAINT account_balance_overdraft_check,
+    DROP COLUMN unlimited_overdraft,
+    DROP COLUMN overdraft_limit,
+    ADD CONSTRAINT account_balance_available_check CHECK (balance - held >= 0);
@@ -0,0 +1,6 @@
+-- How far the available balance may go below zero, internal settlement accounts may instead have no limit at all
+ALTER TABLE account_balance
+    ADD COLUMN overdraft_limit DECIMAL(18, 3) NOT NULL DEFAULT 0.000 CHECK (overdraft_limit >= 0),
+    ADD COLUMN unlimited_overdraft BOOLEAN NOT NULL DEFAULT FALSE,
+    DROP CONSTRAINT account_balance_available_check,
+    ADD CONSTRAINT account_balance_overdraft_check CHECK (unlimited_overdraft OR balance - held + overdraft_limit >= 0);
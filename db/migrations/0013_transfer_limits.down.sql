@@ -0,0 +1,2 @@
+DROP TABLE transfer_limit_policies;
+ALTER TABLE account_balance DROP COLUMN account_type;
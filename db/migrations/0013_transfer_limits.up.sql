@@ -0,0 +1,16 @@
+ALTER TABLE account_balance ADD COLUMN account_type VARCHAR(32) NOT NULL DEFAULT 'standard';
+
+-- Create the transfer limit table. A policy applies to a single account or to every account of a type,
+-- a NULL limit is not enforced.
+CREATE TABLE transfer_limit_policies (
+                             id SERIAL PRIMARY KEY,
+                             account_id INTEGER REFERENCES account_balance(account_id),
+                             account_type VARCHAR(32),
+                             max_per_transaction DECIMAL(18, 3) CHECK (max_per_transaction >= 0),
+                             max_per_day DECIMAL(18, 3) CHECK (max_per_day >= 0),
+                             max_per_30_days DECIMAL(18, 3) CHECK (max_per_30_days >= 0),
+                             max_transfers_per_hour INTEGER CHECK (max_transfers_per_hour >= 0),
+                             updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             UNIQUE (account_id),
+                             UNIQUE (account_type),
+                             CHECK ((account_id IS NULL) <> (account_type IS NULL)));
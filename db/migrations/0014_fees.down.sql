@@ -0,0 +1,6 @@
+DROP TABLE fee_schedules;
+
+ALTER TABLE account_transactions
+    DROP COLUMN fee_breakdown,
+    DROP COLUMN fee_account_id,
+    DROP COLUMN fee_amount;
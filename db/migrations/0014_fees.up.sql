@@ -0,0 +1,19 @@
+-- The fee is paid by the source account to fee_account_id on top of amount
+ALTER TABLE account_transactions
+    ADD COLUMN fee_amount DECIMAL(18, 3) NOT NULL DEFAULT 0.000,
+    ADD COLUMN fee_account_id INTEGER REFERENCES account_balance(account_id),
+    ADD COLUMN fee_breakdown JSONB;
+
+-- Create the fee schedule table. A schedule applies to transfers out of accounts of account_type in currency,
+-- or out of any account in currency if account_type is NULL, and pays the fee to revenue_account_id.
+CREATE TABLE fee_schedules (
+                             id SERIAL PRIMARY KEY,
+                             account_type VARCHAR(32),
+                             currency CHAR(3) NOT NULL,
+                             revenue_account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             tiers JSONB NOT NULL,
+                             min_fee DECIMAL(18, 3) CHECK (min_fee >= 0),
+                             max_fee DECIMAL(18, 3) CHECK (max_fee >= 0),
+                             updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);
+
+CREATE UNIQUE INDEX idx_fee_schedules_currency_account_type ON fee_schedules (currency, COALESCE(account_type, ''));
@@ -0,0 +1,24 @@
+-- Create the interest rate table. An account with a rate earns interest on its end-of-day balance,
+-- paid from expense_account_id, which holds the same currency.
+CREATE TABLE interest_rates (
+                             account_id INTEGER PRIMARY KEY REFERENCES account_balance(account_id),
+                             annual_rate DECIMAL(18, 10) NOT NULL CHECK (annual_rate >= 0),
+                             expense_account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             CHECK (account_id <> expense_account_id));
+
+-- Create the interest accrual table, one exact accrual per account and day. Accruals are posted together
+-- as a single transfer from the expense account, transaction_id is NULL until then.
+CREATE TABLE interest_accruals (
+                             id SERIAL PRIMARY KEY,
+                             account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             accrual_date DATE NOT NULL,
+                             balance DECIMAL(18, 3) NOT NULL,
+                             annual_rate DECIMAL(18, 10) NOT NULL,
+                             amount DECIMAL(26, 13) NOT NULL,
+                             transaction_id INTEGER REFERENCES account_transactions(id),
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             UNIQUE (account_id, accrual_date));
+
+CREATE INDEX idx_interest_accruals_unposted ON interest_accruals (account_id, accrual_date) WHERE transaction_id IS NULL;
@@ -0,0 +1,19 @@
+-- Create the scheduled transfer table. A pending transfer is executed once next_attempt_at has passed, which is
+-- execute_at at first and moves back after every failed attempt. transaction_id is the transfer it became.
+CREATE TABLE scheduled_transfers (
+                             id SERIAL PRIMARY KEY,
+                             source_account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             destination_account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             amount DECIMAL(18, 3) NOT NULL CHECK (amount > 0),
+                             currency CHAR(3) NOT NULL,
+                             convert_currency BOOLEAN NOT NULL DEFAULT FALSE,
+                             execute_at TIMESTAMP NOT NULL,
+                             status VARCHAR(16) NOT NULL CHECK (status IN ('pending', 'succeeded', 'failed', 'cancelled')),
+                             attempts INTEGER NOT NULL DEFAULT 0,
+                             next_attempt_at TIMESTAMP NOT NULL,
+                             last_error TEXT,
+                             transaction_id INTEGER REFERENCES account_transactions(id),
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);
+
+CREATE INDEX idx_scheduled_transfers_pending_next_attempt_at ON scheduled_transfers (next_attempt_at, id) WHERE status = 'pending';
@@ -0,0 +1,36 @@
+-- Create the standing order table. While a standing order is active, next_scheduled_at is when its next occurrence
+-- is due and next_execute_at is that time moved off weekends by business_day_adjustment.
+CREATE TABLE standing_orders (
+                             id SERIAL PRIMARY KEY,
+                             source_account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             destination_account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             amount DECIMAL(18, 3) NOT NULL CHECK (amount > 0),
+                             currency CHAR(3) NOT NULL,
+                             convert_currency BOOLEAN NOT NULL DEFAULT FALSE,
+                             frequency VARCHAR(16) NOT NULL CHECK (frequency IN ('weekly', 'monthly', 'cron')),
+                             cron_expression VARCHAR(255),
+                             start_at TIMESTAMP NOT NULL,
+                             end_at TIMESTAMP,
+                             max_occurrences INTEGER CHECK (max_occurrences > 0),
+                             business_day_adjustment VARCHAR(32) NOT NULL DEFAULT 'none',
+                             status VARCHAR(16) NOT NULL CHECK (status IN ('active', 'completed', 'cancelled')),
+                             occurrences INTEGER NOT NULL DEFAULT 0,
+                             next_scheduled_at TIMESTAMP,
+                             next_execute_at TIMESTAMP,
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             CHECK (status <> 'active' OR next_execute_at IS NOT NULL));
+
+-- Create the standing order execution history. The primary key makes sure an occurrence is executed at most once.
+CREATE TABLE standing_order_executions (
+                             standing_order_id INTEGER NOT NULL REFERENCES standing_orders(id),
+                             occurrence INTEGER NOT NULL,
+                             scheduled_at TIMESTAMP NOT NULL,
+                             execute_at TIMESTAMP NOT NULL,
+                             status VARCHAR(16) NOT NULL CHECK (status IN ('succeeded', 'failed')),
+                             error TEXT,
+                             transaction_id INTEGER REFERENCES account_transactions(id),
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             PRIMARY KEY (standing_order_id, occurrence));
+
+CREATE INDEX idx_standing_orders_active_next_execute_at ON standing_orders (next_execute_at, id) WHERE status = 'active';
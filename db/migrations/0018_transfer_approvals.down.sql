@@ -0,0 +1,2 @@
+DROP TABLE transfer_approvals;
+DROP TABLE approval_policies;
@@ -0,0 +1,27 @@
+-- Create the approval policy table. Transfers out of accounts in currency of more than threshold wait in
+-- transfer_approvals for a second principal, for at most ttl_seconds.
+CREATE TABLE approval_policies (
+                             currency CHAR(3) PRIMARY KEY,
+                             threshold DECIMAL(18, 3) NOT NULL CHECK (threshold >= 0),
+                             ttl_seconds INTEGER NOT NULL CHECK (ttl_seconds > 0),
+                             updated_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP);
+
+-- Create the transfer approval table. transaction_id is the transfer an approved request became.
+CREATE TABLE transfer_approvals (
+                             id SERIAL PRIMARY KEY,
+                             source_account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             destination_account_id INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             amount DECIMAL(18, 3) NOT NULL CHECK (amount > 0),
+                             currency CHAR(3) NOT NULL,
+                             convert_currency BOOLEAN NOT NULL DEFAULT FALSE,
+                             status VARCHAR(16) NOT NULL CHECK (status IN ('pending_approval', 'approved', 'rejected', 'expired')),
+                             requested_by VARCHAR(255) NOT NULL,
+                             decided_by VARCHAR(255),
+                             reason VARCHAR(255),
+                             transaction_id INTEGER REFERENCES account_transactions(id),
+                             expires_at TIMESTAMP NOT NULL,
+                             created_at TIMESTAMP NOT NULL DEFAULT CURRENT_TIMESTAMP,
+                             decided_at TIMESTAMP,
+                             CHECK (decided_by IS NULL OR decided_by <> requested_by));
+
+CREATE INDEX idx_transfer_approvals_pending_expires_at ON transfer_approvals (expires_at) WHERE status = 'pending_approval';
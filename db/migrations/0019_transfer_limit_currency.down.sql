@@ -0,0 +1,6 @@
+DELETE FROM transfer_limit_policies WHERE account_type IS NOT NULL AND currency <> 'USD';
+
+ALTER TABLE transfer_limit_policies
+    DROP CONSTRAINT transfer_limit_policies_account_type_currency_key,
+    ADD CONSTRAINT transfer_limit_policies_account_type_key UNIQUE (account_type),
+    DROP COLUMN currency;
@@ -0,0 +1,25 @@
+-- Transfer limits are amounts, so a policy has a currency. A policy of an account is in the currency of the account,
+-- and an account type has a policy per currency.
+ALTER TABLE transfer_limit_policies
+    ADD COLUMN currency CHAR(3),
+    DROP CONSTRAINT transfer_limit_policies_account_type_key;
+
+UPDATE transfer_limit_policies p
+SET currency = a.currency
+FROM account_balance a
+WHERE p.account_id = a.account_id;
+
+-- Account type policies applied their amounts to accounts of every currency, they are copied to each currency their
+-- accounts hold so that no account loses a limit it was checked against
+INSERT INTO transfer_limit_policies (account_type, currency, max_per_transaction, max_per_day, max_per_30_days,
+                                     max_transfers_per_hour)
+SELECT p.account_type, a.currency, p.max_per_transaction, p.max_per_day, p.max_per_30_days, p.max_transfers_per_hour
+FROM transfer_limit_policies p
+JOIN (SELECT DISTINCT account_type, currency FROM account_balance WHERE currency <> 'USD') a
+    ON a.account_type = p.account_type;
+
+UPDATE transfer_limit_policies SET currency = 'USD' WHERE currency IS NULL;
+
+ALTER TABLE transfer_limit_policies
+    ALTER COLUMN currency SET NOT NULL,
+    ADD CONSTRAINT transfer_limit_policies_account_type_currency_key UNIQUE (account_type, currency);
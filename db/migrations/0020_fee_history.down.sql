@@ -0,0 +1,2 @@
+DROP INDEX idx_transaction_fee_account;
+ALTER TABLE account_transactions DROP COLUMN fee_account_balance_after;
@@ -0,0 +1,15 @@
+-- A transfer records the balance it left the revenue account of its fee with, so that the fee shows in the history
+-- of that account
+ALTER TABLE account_transactions ADD COLUMN fee_account_balance_after DECIMAL(18, 3);
+
+-- Every change of a balance is a posting, and postings are inserted in the order the locked balances changed, so the
+-- balance after a transfer is the sum of the postings of the account up to the journal entry of the transfer
+UPDATE account_transactions t
+SET fee_account_balance_after = (
+    SELECT SUM(p.amount)
+    FROM postings p
+    WHERE p.account_id = t.fee_account_id
+      AND p.journal_entry_id <= (SELECT MIN(j.id) FROM journal_entries j WHERE j.transaction_id = t.id))
+WHERE t.fee_account_id IS NOT NULL;
+
+CREATE INDEX idx_transaction_fee_account ON account_transactions (fee_account_id, created_at, id) WHERE fee_account_id IS NOT NULL;
@@ -0,0 +1,42 @@
+package db
+
+import (
+	"database/sql"
+	. "takeHomeAssignment/entities"
+)
+
+var ErrOverdraftBelowBalance = newError(KindConflict, "overdraft_below_balance", "overdraft limit cannot be lower than what the account is already overdrawn by")
+
+// SetOverdraft changes how far the account may go below zero and fills account. A limit cannot be lowered
+// below what the account has already spent of it.
+func SetOverdraft(DB *sql.DB, accountID int, settings *OverdraftSettings, account *Account) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	accounts, err := lockAccounts(dbtx, []int{accountID})
+	if err != nil {
+		return err
+	}
+	locked := accounts[accountID]
+	err = locked.Currency.ValidateAmount(settings.OverdraftLimit)
+	if err != nil {
+		return err
+	}
+	locked.OverdraftLimit = settings.OverdraftLimit
+	locked.UnlimitedOverdraft = settings.Unlimited
+	if !locked.canSpend(0) {
+		return ErrOverdraftBelowBalance
+	}
+
+	_, err = dbtx.Exec("UPDATE account_balance SET overdraft_limit = $1, unlimited_overdraft = $2, updated_at = CURRENT_TIMESTAMP WHERE account_id = $3",
+		locked.OverdraftLimit, locked.UnlimitedOverdraft, accountID)
+	if err != nil {
+		return err
+	}
+
+	locked.toAccount(account)
+	return dbtx.Commit()
+}
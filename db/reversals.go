@@ -0,0 +1,86 @@
+package db
+
+import (
+	"database/sql"
+	. "takeHomeAssignment/entities"
+)
+
+var ErrReversalExceedsTransfer = newError(KindConflict, "reversal_exceeds_transfer", "reversal amount exceeds the part of the transfer that has not been reversed yet")
+var ErrReversalOfReversal = newError(KindConflict, "reversal_of_reversal", "a reversal cannot itself be reversed")
+var ErrReversalInsufficientBalance = newError(KindConflict, "reversal_insufficient_funds", "the destination account of the original transfer does not have enough available balance to reverse it")
+
+// ReverseTransaction transfers amount back from the destination of the original transfer to its source, or whatever
+// has not been reversed yet if amount is nil, and fills record with the reversal.
+// Amount is in the destination currency. The source gets back the same share of what it originally sent, so a
+// cross-currency transfer is reversed at its original rate and the reversals of a transfer add up to exactly the original.
+// The fee of the original transfer is not refunded, even by a full reversal, it stays with the revenue account. A
+// reversal is not charged a fee either.
+func ReverseTransaction(DB *sql.DB, transactionID int, amount *Money, record *TransactionRecord) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	// Locking the original transfer serialises concurrent reversals of it
+	original := TransactionRecord{}
+	err = scanTransaction(dbtx.QueryRow("SELECT "+transactionColumns+" FROM account_transactions WHERE id = $1 FOR UPDATE", transactionID), &original)
+	if err != nil {
+		return notFound(err, ErrTransactionNotFound)
+	}
+	if original.ReversalOf != nil {
+		return ErrReversalOfReversal
+	}
+
+	var reversed, refunded Money
+	err = dbtx.QueryRow("SELECT COALESCE(SUM(amount), 0), COALESCE(SUM(destination_amount), 0) FROM account_transactions WHERE reversal_of = $1", transactionID).Scan(&reversed, &refunded)
+	if err != nil {
+		return err
+	}
+	remaining := original.DestinationAmount - reversed
+	reversalAmount := remaining
+	if amount != nil {
+		reversalAmount = *amount
+	}
+	if reversalAmount <= 0 || reversalAmount > remaining {
+		return ErrReversalExceedsTransfer
+	}
+	err = original.DestinationCurrency.ValidateAmount(reversalAmount)
+	if err != nil {
+		return err
+	}
+
+	// The last reversal refunds the rest of the original amount, so rounding never leaves anything behind
+	refundAmount := original.Amount - refunded
+	if reversalAmount < remaining {
+		refundAmount = original.Amount.Prorate(reversalAmount, original.DestinationAmount, original.Currency)
+	}
+	if refundAmount <= 0 {
+		return ErrAmountTooSmallToConvert
+	}
+
+	accounts, err := lockAccounts(dbtx, []int{original.SourceAccountID, original.DestinationAccountID})
+	if err != nil {
+		return err
+	}
+	if !accounts[original.DestinationAccountID].canSpend(reversalAmount) {
+		return ErrReversalInsufficientBalance
+	}
+
+	record.SourceAccountID = original.DestinationAccountID
+	record.DestinationAccountID = original.SourceAccountID
+	record.Amount = reversalAmount
+	record.Currency = original.DestinationCurrency
+	record.DestinationAmount = refundAmount
+	record.DestinationCurrency = original.Currency
+	record.ReversalOf = &original.TransactionID
+	err = recordTransfer(dbtx, accounts, "reversal", record)
+	if err != nil {
+		return err
+	}
+	err = writeBalances(dbtx, accounts)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
@@ -0,0 +1,200 @@
+package db
+
+import (
+	"database/sql"
+	"errors"
+	"strconv"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+var ErrScheduledTransferNotPending = newError(KindConflict, "scheduled_transfer_not_pending", "scheduled transfer has already been executed, has failed or was cancelled")
+
+const scheduledTransferColumns = `id, source_account_id, destination_account_id, amount, currency, convert_currency, execute_at,
+           status, attempts, next_attempt_at, last_error, transaction_id, created_at, updated_at`
+
+func scanScheduledTransfer(row rowScanner, transfer *ScheduledTransfer) error {
+	return row.Scan(&transfer.ScheduledTransferID, &transfer.SourceAccountID, &transfer.DestinationAccountID,
+		&transfer.Amount, &transfer.Currency, &transfer.ConvertCurrency, &transfer.ExecuteAt, &transfer.Status,
+		&transfer.Attempts, &transfer.NextAttemptAt, &transfer.LastError, &transfer.TransactionID, &transfer.CreatedAt,
+		&transfer.UpdatedAt)
+}
+
+// CreateScheduledTransfer stores the request to be executed at request.ExecuteAt and fills transfer.
+// The accounts have to exist, the amount has to suit the source currency and be within the approval threshold now,
+// the rest is checked on execution.
+func CreateScheduledTransfer(DB *sql.DB, request *ScheduledTransferRequest, transfer *ScheduledTransfer) error {
+	source := Account{}
+	err := QueryAccountByAccountId(DB, request.SourceAccountID, &source)
+	if err != nil {
+		return err
+	}
+	dest := Account{}
+	err = QueryAccountByAccountId(DB, request.DestinationAccountID, &dest)
+	if err != nil {
+		return err
+	}
+	if source.Currency != dest.Currency && !request.ConvertCurrency {
+		return ErrCurrencyMismatch
+	}
+	err = source.Currency.ValidateAmount(request.Amount)
+	if err != nil {
+		return err
+	}
+	err = checkApprovalPolicy(DB, source.Currency, request.Amount)
+	if err != nil {
+		return err
+	}
+
+	executeAt := formatTimestamp(request.ExecuteAt)
+	return scanScheduledTransfer(DB.QueryRow(`
+    INSERT INTO scheduled_transfers (source_account_id, destination_account_id, amount, currency, convert_currency,
+                                     execute_at, status, next_attempt_at)
+    VALUES ($1, $2, $3, $4, $5, $6::timestamp, $7, $6::timestamp)
+    RETURNING `+scheduledTransferColumns,
+		request.SourceAccountID, request.DestinationAccountID, request.Amount, source.Currency, request.ConvertCurrency,
+		executeAt, ScheduledTransferStatusPending), transfer)
+}
+
+func QueryScheduledTransferById(DB *sql.DB, scheduledTransferID int, transfer *ScheduledTransfer) error {
+	err := scanScheduledTransfer(DB.QueryRow("SELECT "+scheduledTransferColumns+" FROM scheduled_transfers WHERE id = $1", scheduledTransferID), transfer)
+	return notFound(err, ErrScheduledTransferNotFound)
+}
+
+// QueryScheduledTransfers fills transfers with the scheduled transfers matching filter, soonest first
+func QueryScheduledTransfers(DB *sql.DB, filter ScheduledTransferFilter, transfers *[]ScheduledTransfer) error {
+	var args []interface{}
+	addArg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+	where := ""
+	if filter.AccountID != nil {
+		accountID := addArg(*filter.AccountID)
+		where += " AND (source_account_id = " + accountID + " OR destination_account_id = " + accountID + ")"
+	}
+	if filter.Status != "" {
+		where += " AND status = " + addArg(filter.Status)
+	}
+	limit := addArg(filter.Limit)
+
+	rows, err := DB.Query("SELECT "+scheduledTransferColumns+" FROM scheduled_transfers WHERE TRUE"+where+" ORDER BY execute_at, id LIMIT "+limit, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	*transfers = []ScheduledTransfer{}
+	for rows.Next() {
+		transfer := ScheduledTransfer{}
+		err = scanScheduledTransfer(rows, &transfer)
+		if err != nil {
+			return err
+		}
+		*transfers = append(*transfers, transfer)
+	}
+	return rows.Err()
+}
+
+// CancelScheduledTransfer cancels a pending scheduled transfer and fills transfer. A transfer being executed
+// at the same time is locked by the scheduler, so the cancellation waits for it and then fails if it succeeded.
+func CancelScheduledTransfer(DB *sql.DB, scheduledTransferID int, transfer *ScheduledTransfer) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	err = scanScheduledTransfer(dbtx.QueryRow("SELECT "+scheduledTransferColumns+" FROM scheduled_transfers WHERE id = $1 FOR UPDATE", scheduledTransferID), transfer)
+	if err != nil {
+		return notFound(err, ErrScheduledTransferNotFound)
+	}
+	if transfer.Status != ScheduledTransferStatusPending {
+		return ErrScheduledTransferNotPending
+	}
+
+	err = scanScheduledTransfer(dbtx.QueryRow(`
+    UPDATE scheduled_transfers SET status = $1, updated_at = CURRENT_TIMESTAMP
+    WHERE id = $2
+    RETURNING `+scheduledTransferColumns, ScheduledTransferStatusCancelled, scheduledTransferID), transfer)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
+
+// ExecuteDueScheduledTransfer executes the pending scheduled transfer that has been due the longest and fills
+// transfer with its outcome, or returns sql.ErrNoRows if none is due. Transfers locked by another scheduler are
+// skipped, so several instances can execute scheduled transfers at once without executing any of them twice.
+// A transfer that fails is retried with a growing delay until MaxScheduledTransferAttempts, unless it can never succeed.
+func ExecuteDueScheduledTransfer(DB *sql.DB, transfer *ScheduledTransfer) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	err = scanScheduledTransfer(dbtx.QueryRow(`
+    SELECT `+scheduledTransferColumns+`
+    FROM scheduled_transfers
+    WHERE status = $1 AND next_attempt_at <= CURRENT_TIMESTAMP
+    ORDER BY next_attempt_at, id
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+`, ScheduledTransferStatusPending), transfer)
+	if err != nil {
+		return err
+	}
+
+	// The transfer runs in a savepoint, so that a failed attempt is rolled back on its own and can still be recorded
+	_, err = dbtx.Exec("SAVEPOINT scheduled_transfer")
+	if err != nil {
+		return err
+	}
+	transaction := transfer.Transaction()
+	record := TransactionRecord{}
+	transferErr := processTransaction(dbtx, &transaction, false, &record)
+	if transferErr != nil {
+		_, err = dbtx.Exec("ROLLBACK TO SAVEPOINT scheduled_transfer")
+		if err != nil {
+			return err
+		}
+	}
+
+	transfer.Attempts++
+	status := ScheduledTransferStatusSucceeded
+	var transactionID *int
+	var lastError *string
+	var retryDelay time.Duration
+	if transferErr == nil {
+		transactionID = &record.TransactionID
+	} else {
+		message := transferErr.Error()
+		lastError = &message
+		if isPermanentTransferError(transferErr) || transfer.Attempts >= MaxScheduledTransferAttempts {
+			status = ScheduledTransferStatusFailed
+		} else {
+			status = ScheduledTransferStatusPending
+			retryDelay = ScheduledTransferRetryDelay(transfer.Attempts)
+		}
+	}
+
+	err = scanScheduledTransfer(dbtx.QueryRow(`
+    UPDATE scheduled_transfers
+    SET status = $1, attempts = $2, next_attempt_at = CURRENT_TIMESTAMP + $3::float8 * INTERVAL '1 second',
+        last_error = $4, transaction_id = $5, updated_at = CURRENT_TIMESTAMP
+    WHERE id = $6
+    RETURNING `+scheduledTransferColumns,
+		status, transfer.Attempts, retryDelay.Seconds(), lastError, transactionID, transfer.ScheduledTransferID), transfer)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
+
+// isPermanentTransferError reports whether retrying a transfer that failed with err cannot help.
+// Insufficient balance, frozen accounts, transfer limits and missing exchange rates may all change by the next attempt.
+func isPermanentTransferError(err error) bool {
+	return errors.Is(err, sql.ErrNoRows) || errors.Is(err, ErrAccountClosed) || errors.Is(err, ErrCurrencyMismatch) ||
+		errors.Is(err, ErrTooManyDecimals) || errors.Is(err, ErrAmountTooSmallToConvert) || errors.Is(err, ErrApprovalRequired)
+}
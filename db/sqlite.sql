@@ -0,0 +1,69 @@
+-- The schema of the SQLite backend, the tables of db/migrations that SQLiteStore uses with the same constraints.
+-- Amounts are INTEGER thousandths, since SQLite has no exact DECIMAL type, and timestamps are UTC text with a fixed
+-- width, so that they compare in time order.
+-- There are no holds, account statuses or overdrafts, so an account is always active and its balance never negative.
+CREATE TABLE IF NOT EXISTS account_balance (
+                                 id INTEGER PRIMARY KEY AUTOINCREMENT,
+                                 account_id INTEGER NOT NULL,
+                                 balance INTEGER NOT NULL DEFAULT 0,
+                                 currency CHAR(3) NOT NULL DEFAULT 'USD',
+                                 account_type VARCHAR(32) NOT NULL DEFAULT 'standard',
+                                 updated_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                                 UNIQUE (account_id),
+                                 CONSTRAINT account_balance_balance_check CHECK (balance >= 0)
+);
+
+CREATE TABLE IF NOT EXISTS account_transactions (
+                             id INTEGER PRIMARY KEY AUTOINCREMENT,
+                             account_transfer_out INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             account_transfer_in INTEGER NOT NULL REFERENCES account_balance(account_id),
+                             amount INTEGER NOT NULL,
+                             currency CHAR(3) NOT NULL DEFAULT 'USD',
+                             destination_amount INTEGER NOT NULL,
+                             destination_currency CHAR(3) NOT NULL DEFAULT 'USD',
+                             source_balance_after INTEGER NOT NULL,
+                             destination_balance_after INTEGER NOT NULL,
+                             created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')));
+
+CREATE TABLE IF NOT EXISTS journal_entries (
+                             id INTEGER PRIMARY KEY AUTOINCREMENT,
+                             transaction_id INTEGER REFERENCES account_transactions(id),
+                             description VARCHAR(255) NOT NULL,
+                             created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')));
+
+CREATE TABLE IF NOT EXISTS postings (
+                             id INTEGER PRIMARY KEY AUTOINCREMENT,
+                             journal_entry_id INTEGER NOT NULL REFERENCES journal_entries(id),
+                             account_id INTEGER REFERENCES account_balance(account_id),
+                             system_account VARCHAR(64),
+                             amount INTEGER NOT NULL CHECK (amount <> 0),
+                             currency CHAR(3) NOT NULL,
+                             CHECK ((account_id IS NULL) <> (system_account IS NULL)));
+
+-- SQLite has no deferred triggers, so the postings of an entry are checked to balance by JournalEntry.Validate alone
+CREATE TRIGGER IF NOT EXISTS postings_no_update
+    BEFORE UPDATE ON postings
+BEGIN
+    SELECT RAISE(ABORT, 'postings cannot be updated or deleted');
+END;
+
+CREATE TRIGGER IF NOT EXISTS postings_no_delete
+    BEFORE DELETE ON postings
+BEGIN
+    SELECT RAISE(ABORT, 'postings cannot be updated or deleted');
+END;
+
+CREATE TABLE IF NOT EXISTS idempotency_keys (
+                             scope VARCHAR(64) NOT NULL,
+                             idempotency_key VARCHAR(255) NOT NULL,
+                             request_fingerprint CHAR(64) NOT NULL,
+                             response_status INTEGER NOT NULL,
+                             response_body BLOB NOT NULL,
+                             response_location VARCHAR(255) NOT NULL DEFAULT '',
+                             created_at TIMESTAMP NOT NULL DEFAULT (strftime('%Y-%m-%d %H:%M:%f', 'now')),
+                             PRIMARY KEY (scope, idempotency_key));
+
+CREATE INDEX IF NOT EXISTS idx_transaction_account_transfer_out ON account_transactions (account_transfer_out, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_transaction_account_transfer_in ON account_transactions (account_transfer_in, created_at, id);
+CREATE INDEX IF NOT EXISTS idx_postings_journal_entry_id ON postings (journal_entry_id);
+CREATE INDEX IF NOT EXISTS idx_idempotency_keys_created_at ON idempotency_keys (created_at);
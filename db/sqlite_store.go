@@ -0,0 +1,356 @@
+package db
+
+import (
+	"database/sql"
+	_ "embed"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/mattn/go-sqlite3"
+	"net/url"
+	"strings"
+	. "takeHomeAssignment/entities"
+)
+
+//go:embed sqlite.sql
+var sqliteSchema string
+
+// SQLiteStore is a Store in a single SQLite file, for deployments without Postgres. Like MemoryStore it has no fee
+// schedules, approval policies, exchange rates or transfer limits, and returns ErrNotSupported for the other features
+// of Store.
+// Every database transaction starts with BEGIN IMMEDIATE, which takes the write lock of the whole file up front, so
+// transfers are serialized where Postgres locks rows: a transfer always reads the balances it writes and none is
+// lost. Readers keep reading the last commit meanwhile, and a writer waits up to the busy timeout for the lock.
+type SQLiteStore struct {
+	unsupportedFeatures
+	DB *sql.DB
+}
+
+// OpenSQLiteStore opens the database file at path, creating it and its tables if needed
+func OpenSQLiteStore(path string) (*SQLiteStore, error) {
+	dsn := "file:" + url.PathEscape(path) + "?_txlock=immediate&_busy_timeout=10000&_journal_mode=WAL&_foreign_keys=on&_synchronous=FULL"
+	DB, err := sql.Open("sqlite3", dsn)
+	if err != nil {
+		return nil, err
+	}
+	_, err = DB.Exec(sqliteSchema)
+	if err != nil {
+		DB.Close()
+		return nil, fmt.Errorf("creating the SQLite schema: %w", err)
+	}
+	return &SQLiteStore{DB: DB}, nil
+}
+
+// sqliteError returns the Error a constraint violation stands for, and any other err unchanged. Violations no
+// specific Error is known for are ErrConstraintViolation, so that they are not mistaken for transient failures.
+func sqliteError(err error) error {
+	var sqliteErr sqlite3.Error
+	if !errors.As(err, &sqliteErr) || sqliteErr.Code != sqlite3.ErrConstraint {
+		return err
+	}
+	switch {
+	// Files created before the overdraft columns were dropped from the schema still have the overdraft check
+	case sqliteErr.ExtendedCode == sqlite3.ErrConstraintCheck && (strings.HasSuffix(sqliteErr.Error(), "account_balance_balance_check") ||
+		strings.HasSuffix(sqliteErr.Error(), "account_balance_overdraft_check")):
+		return ErrInsufficientBalance
+	case sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique && strings.HasSuffix(sqliteErr.Error(), "account_balance.account_id"):
+		return ErrAccountExists
+	case sqliteErr.ExtendedCode == sqlite3.ErrConstraintPrimaryKey && strings.Contains(sqliteErr.Error(), "idempotency_keys."):
+		return ErrIdempotencyKeyInUse
+	}
+	return fmt.Errorf("%w: %v", ErrConstraintViolation, err)
+}
+
+// sqliteAmount scans an INTEGER column of thousandths into a Money
+type sqliteAmount struct {
+	money *Money
+}
+
+func (a sqliteAmount) Scan(src interface{}) error {
+	value, ok := src.(int64)
+	if !ok {
+		return fmt.Errorf("cannot scan %T into an amount", src)
+	}
+	*a.money = Money(value)
+	return nil
+}
+
+// sqliteTimestamp is the current time, or the time the modifier away from it, in the format of the schema
+func sqliteTimestamp(modifier string) string {
+	return "strftime('%Y-%m-%d %H:%M:%f', 'now'" + modifier + ")"
+}
+
+func (s *SQLiteStore) CreateAccount(account *Account, idempotencyKey *IdempotencyKey) error {
+	dbtx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	if idempotencyKey != nil {
+		err = s.insertIdempotencyKey(dbtx, idempotencyKey)
+		if err != nil {
+			return err
+		}
+	}
+
+	var exists bool
+	err = dbtx.QueryRow("SELECT EXISTS (SELECT 1 FROM account_balance WHERE account_id = ?)", account.AccountID).Scan(&exists)
+	if err != nil {
+		return err
+	}
+	if exists {
+		return ErrAccountExists
+	}
+	if account.Currency == "" {
+		account.Currency = DefaultCurrency
+	}
+	if account.AccountType == "" {
+		account.AccountType = DefaultAccountType
+	}
+	err = account.Currency.ValidateAmount(account.Balance)
+	if err != nil {
+		return err
+	}
+	if account.Balance < 0 {
+		return ErrInsufficientBalance
+	}
+	_, err = dbtx.Exec("INSERT INTO account_balance (account_id, balance, currency, account_type) VALUES (?, ?, ?, ?)",
+		account.AccountID, int64(account.Balance), account.Currency, account.AccountType)
+	if err != nil {
+		return sqliteError(err)
+	}
+	account.AvailableBalance = account.Balance
+	account.Status = AccountStatusActive
+
+	if account.Balance != 0 {
+		err = s.insertJournalEntry(dbtx, &JournalEntry{
+			Description: "opening balance",
+			Postings: []Posting{
+				SystemPosting(SystemAccountOpeningBalance, -account.Balance, account.Currency),
+				AccountPosting(account.AccountID, account.Balance, account.Currency),
+			},
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return dbtx.Commit()
+}
+
+func (s *SQLiteStore) QueryAccountByAccountId(accountID int, account *Account) error {
+	err := s.DB.QueryRow(`
+    SELECT account_id, balance, currency, account_type
+    FROM account_balance
+    WHERE account_id = ?
+`, accountID).Scan(&account.AccountID, sqliteAmount{&account.Balance}, &account.Currency, &account.AccountType)
+	if err != nil {
+		return notFound(err, ErrAccountNotFound)
+	}
+	account.AvailableBalance = account.Balance
+	account.Status = AccountStatusActive
+	account.OverdraftLimit = 0
+	account.UnlimitedOverdraft = false
+	return nil
+}
+
+// ProcessTransaction performs the transfer with the same checks and in the same order as processTransaction, but for
+// the statuses and overdrafts that accounts do not have here
+func (s *SQLiteStore) ProcessTransaction(transaction *Transaction, idempotencyKey *IdempotencyKey, record *TransactionRecord) error {
+	dbtx, err := s.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	source, err := s.queryAccount(dbtx, transaction.SourceAccountID)
+	if err != nil {
+		return err
+	}
+	dest, err := s.queryAccount(dbtx, transaction.DestinationAccountID)
+	if err != nil {
+		return err
+	}
+	if !source.canSpend(transaction.Amount) {
+		return ErrInsufficientBalance
+	}
+	err = source.Currency.ValidateAmount(transaction.Amount)
+	if err != nil {
+		return err
+	}
+	if source.Currency != dest.Currency {
+		if !transaction.ConvertCurrency {
+			return ErrCurrencyMismatch
+		}
+		return ErrNoExchangeRate
+	}
+
+	// The check constraint on account_balance rejects the update if the balance would still go too low
+	_, err = dbtx.Exec("UPDATE account_balance SET balance = balance - ?, updated_at = "+sqliteTimestamp("")+" WHERE account_id = ?",
+		int64(transaction.Amount), source.AccountID)
+	if err != nil {
+		return sqliteError(err)
+	}
+	_, err = dbtx.Exec("UPDATE account_balance SET balance = balance + ?, updated_at = "+sqliteTimestamp("")+" WHERE account_id = ?",
+		int64(transaction.Amount), dest.AccountID)
+	if err != nil {
+		return sqliteError(err)
+	}
+
+	*record = TransactionRecord{
+		SourceAccountID:         transaction.SourceAccountID,
+		DestinationAccountID:    transaction.DestinationAccountID,
+		Amount:                  transaction.Amount,
+		Currency:                source.Currency,
+		DestinationAmount:       transaction.Amount,
+		DestinationCurrency:     dest.Currency,
+		SourceBalanceAfter:      source.Balance - transaction.Amount,
+		DestinationBalanceAfter: dest.Balance + transaction.Amount,
+	}
+	err = dbtx.QueryRow(`
+    INSERT INTO account_transactions (account_transfer_out, account_transfer_in, amount, currency, destination_amount,
+                                      destination_currency, source_balance_after, destination_balance_after)
+    VALUES (?, ?, ?, ?, ?, ?, ?, ?)
+    RETURNING id, created_at
+`, record.SourceAccountID, record.DestinationAccountID, int64(record.Amount), record.Currency,
+		int64(record.DestinationAmount), record.DestinationCurrency, int64(record.SourceBalanceAfter),
+		int64(record.DestinationBalanceAfter)).Scan(&record.TransactionID, &record.CreatedAt)
+	if err != nil {
+		return sqliteError(err)
+	}
+	err = s.insertJournalEntry(dbtx, &JournalEntry{TransactionID: &record.TransactionID, Description: "transfer", Postings: transferPostings(record)})
+	if err != nil {
+		return err
+	}
+
+	if idempotencyKey != nil {
+		idempotencyKey.ResponseBody, err = json.Marshal(record)
+		if err != nil {
+			return err
+		}
+		idempotencyKey.ResponseLocation = record.Location()
+		err = s.insertIdempotencyKey(dbtx, idempotencyKey)
+		if err != nil {
+			return err
+		}
+	}
+	return dbtx.Commit()
+}
+
+func (s *SQLiteStore) QueryTransactionById(transactionID int, record *TransactionRecord) error {
+	err := s.DB.QueryRow(`
+    SELECT id, account_transfer_out, account_transfer_in, amount, currency, destination_amount, destination_currency,
+           source_balance_after, destination_balance_after, created_at
+    FROM account_transactions
+    WHERE id = ?
+`, transactionID).Scan(&record.TransactionID, &record.SourceAccountID, &record.DestinationAccountID,
+		sqliteAmount{&record.Amount}, &record.Currency, sqliteAmount{&record.DestinationAmount}, &record.DestinationCurrency,
+		sqliteAmount{&record.SourceBalanceAfter}, sqliteAmount{&record.DestinationBalanceAfter}, &record.CreatedAt)
+	return notFound(err, ErrTransactionNotFound)
+}
+
+// QueryTransferFee leaves fee untouched, there are no fee schedules
+func (s *SQLiteStore) QueryTransferFee(transaction *Transaction, fee *Fee) error {
+	return nil
+}
+
+// QueryApprovalPolicy returns sql.ErrNoRows, there are no approval policies
+func (s *SQLiteStore) QueryApprovalPolicy(policy *ApprovalPolicy) error {
+	return sql.ErrNoRows
+}
+
+// CreateTransferApproval returns ErrNotSupported, transfers never need approval without approval policies
+func (s *SQLiteStore) CreateTransferApproval(transaction *Transaction, requestedBy string, policy *ApprovalPolicy, idempotencyKey *IdempotencyKey, approval *TransferApproval) error {
+	return ErrNotSupported
+}
+
+func (s *SQLiteStore) QueryIdempotencyKey(scope string, key string, idempotencyKey *IdempotencyKey) error {
+	return s.DB.QueryRow(`
+    SELECT idempotency_key, scope, request_fingerprint, response_status, response_body, response_location, created_at
+    FROM idempotency_keys
+    WHERE scope = ? AND idempotency_key = ? AND created_at >= `+sqliteTimestamp(", ?")+`
+`, scope, key, retentionModifier()).Scan(&idempotencyKey.Key, &idempotencyKey.Scope, &idempotencyKey.Fingerprint,
+		&idempotencyKey.ResponseStatus, &idempotencyKey.ResponseBody, &idempotencyKey.ResponseLocation, &idempotencyKey.CreatedAt)
+}
+
+func (s *SQLiteStore) DeleteExpiredIdempotencyKeys() (int64, error) {
+	result, err := s.DB.Exec("DELETE FROM idempotency_keys WHERE created_at < "+sqliteTimestamp(", ?"), retentionModifier())
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
+
+// retentionModifier moves the current time back by IdempotencyKeyRetention
+func retentionModifier() string {
+	return fmt.Sprintf("-%d seconds", int64(IdempotencyKeyRetention.Seconds()))
+}
+
+// queryAccount reads the account inside dbtx, which already holds the write lock. It returns ErrAccountNotFound if
+// the account does not exist.
+func (s *SQLiteStore) queryAccount(dbtx *sql.Tx, accountID int) (*lockedAccount, error) {
+	account := lockedAccount{}
+	err := dbtx.QueryRow(`
+    SELECT account_id, balance, currency, account_type
+    FROM account_balance
+    WHERE account_id = ?
+`, accountID).Scan(&account.AccountID, sqliteAmount{&account.Balance}, &account.Currency, &account.AccountType)
+	if err != nil {
+		return nil, notFound(err, ErrAccountNotFound)
+	}
+	account.Status = AccountStatusActive
+	return &account, nil
+}
+
+// insertIdempotencyKey stores the key like insertIdempotencyKey, failing with ErrIdempotencyKeyInUse while it is
+// retained and overwriting it once it has expired
+func (s *SQLiteStore) insertIdempotencyKey(dbtx *sql.Tx, idempotencyKey *IdempotencyKey) error {
+	result, err := dbtx.Exec(`
+    INSERT INTO idempotency_keys (scope, idempotency_key, request_fingerprint, response_status, response_body, response_location)
+    VALUES (?, ?, ?, ?, ?, ?)
+    ON CONFLICT (scope, idempotency_key) DO UPDATE
+        SET request_fingerprint = excluded.request_fingerprint,
+            response_status     = excluded.response_status,
+            response_body       = excluded.response_body,
+            response_location   = excluded.response_location,
+            created_at          = `+sqliteTimestamp("")+`
+        WHERE idempotency_keys.created_at < `+sqliteTimestamp(", ?"),
+		idempotencyKey.Scope, idempotencyKey.Key, idempotencyKey.Fingerprint, idempotencyKey.ResponseStatus,
+		idempotencyKey.ResponseBody, idempotencyKey.ResponseLocation, retentionModifier())
+	if err != nil {
+		return err
+	}
+	inserted, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if inserted == 0 {
+		return ErrIdempotencyKeyInUse
+	}
+	return nil
+}
+
+// insertJournalEntry writes the entry and its postings like insertJournalEntry
+func (s *SQLiteStore) insertJournalEntry(dbtx *sql.Tx, entry *JournalEntry) error {
+	err := entry.Validate()
+	if err != nil {
+		return err
+	}
+	err = dbtx.QueryRow("INSERT INTO journal_entries (transaction_id, description) VALUES (?, ?) RETURNING id, created_at",
+		entry.TransactionID, entry.Description).Scan(&entry.JournalEntryID, &entry.CreatedAt)
+	if err != nil {
+		return sqliteError(err)
+	}
+	for _, posting := range entry.Postings {
+		var systemAccount *string
+		if posting.SystemAccount != "" {
+			systemAccount = &posting.SystemAccount
+		}
+		_, err = dbtx.Exec("INSERT INTO postings (journal_entry_id, account_id, system_account, amount, currency) VALUES (?, ?, ?, ?, ?)",
+			entry.JournalEntryID, posting.AccountID, systemAccount, int64(posting.Amount), posting.Currency)
+		if err != nil {
+			return sqliteError(err)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,31 @@
+package db
+
+import (
+	"github.com/stretchr/testify/assert"
+	"path/filepath"
+	"testing"
+)
+
+func TestSQLiteError(t *testing.T) {
+	store, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+	if !assert.NoError(t, err) {
+		t.FailNow()
+	}
+	defer store.DB.Close()
+	_, err = store.DB.Exec("INSERT INTO account_balance (account_id, balance) VALUES (1, 10)")
+	assert.NoError(t, err)
+
+	_, err = store.DB.Exec("UPDATE account_balance SET balance = -1 WHERE account_id = 1")
+	assert.Equal(t, ErrInsufficientBalance, sqliteError(err))
+
+	_, err = store.DB.Exec("INSERT INTO account_balance (account_id) VALUES (1)")
+	assert.Equal(t, ErrAccountExists, sqliteError(err))
+
+	// Violations without an Error of their own are not mistaken for transient failures
+	_, err = store.DB.Exec("UPDATE account_balance SET currency = NULL WHERE account_id = 1")
+	assert.ErrorIs(t, sqliteError(err), ErrConstraintViolation)
+
+	_, err = store.DB.Exec("SELECT * FROM missing_table")
+	assert.Error(t, err)
+	assert.Equal(t, err, sqliteError(err))
+}
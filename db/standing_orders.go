@@ -0,0 +1,226 @@
+package db
+
+import (
+	"database/sql"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+var ErrStandingOrderNoOccurrences = newError(KindInvalid, "standing_order_no_occurrences", "standing order has no occurrence between start_at and end_at")
+var ErrStandingOrderNotActive = newError(KindConflict, "standing_order_not_active", "standing order has already completed or was cancelled")
+
+const standingOrderColumns = `id, source_account_id, destination_account_id, amount, currency, convert_currency, frequency,
+           cron_expression, start_at, end_at, max_occurrences, business_day_adjustment, status, occurrences,
+           next_scheduled_at, next_execute_at, created_at, updated_at`
+
+func scanStandingOrder(row rowScanner, order *StandingOrder) error {
+	return row.Scan(&order.StandingOrderID, &order.SourceAccountID, &order.DestinationAccountID, &order.Amount,
+		&order.Currency, &order.ConvertCurrency, &order.Frequency, &order.Cron, &order.StartAt, &order.EndAt,
+		&order.MaxOccurrences, &order.BusinessDayAdjustment, &order.Status, &order.Occurrences, &order.NextScheduledAt,
+		&order.NextExecuteAt, &order.CreatedAt, &order.UpdatedAt)
+}
+
+const standingOrderExecutionColumns = "standing_order_id, occurrence, scheduled_at, execute_at, status, error, transaction_id, created_at"
+
+func scanStandingOrderExecution(row rowScanner, execution *StandingOrderExecution) error {
+	return row.Scan(&execution.StandingOrderID, &execution.Occurrence, &execution.ScheduledAt, &execution.ExecuteAt,
+		&execution.Status, &execution.Error, &execution.TransactionID, &execution.CreatedAt)
+}
+
+// nullableTimestamp formats t like formatTimestamp, or returns nil for a NULL
+func nullableTimestamp(t *time.Time) interface{} {
+	if t == nil {
+		return nil
+	}
+	return formatTimestamp(*t)
+}
+
+// CreateStandingOrder stores the standing order with its first occurrence and fills order.
+// The accounts have to exist and the amount has to suit the source currency now, the rest is checked on every execution.
+func CreateStandingOrder(DB *sql.DB, request *StandingOrderRequest, order *StandingOrder) error {
+	source := Account{}
+	err := QueryAccountByAccountId(DB, request.SourceAccountID, &source)
+	if err != nil {
+		return err
+	}
+	dest := Account{}
+	err = QueryAccountByAccountId(DB, request.DestinationAccountID, &dest)
+	if err != nil {
+		return err
+	}
+	if source.Currency != dest.Currency && !request.ConvertCurrency {
+		return ErrCurrencyMismatch
+	}
+	err = source.Currency.ValidateAmount(request.Amount)
+	if err != nil {
+		return err
+	}
+	err = checkApprovalPolicy(DB, source.Currency, request.Amount)
+	if err != nil {
+		return err
+	}
+
+	var cron *string
+	if request.Frequency == FrequencyCron {
+		cron = &request.Cron
+	}
+	pending := StandingOrder{
+		Frequency:             request.Frequency,
+		Cron:                  cron,
+		StartAt:               request.StartAt,
+		EndAt:                 request.EndAt,
+		MaxOccurrences:        request.MaxOccurrences,
+		BusinessDayAdjustment: request.BusinessDayAdjustment,
+	}
+	scheduledAt, executeAt, ok, err := pending.Schedule(1, time.Time{})
+	if err != nil {
+		return err
+	}
+	if !ok {
+		return ErrStandingOrderNoOccurrences
+	}
+
+	return scanStandingOrder(DB.QueryRow(`
+    INSERT INTO standing_orders (source_account_id, destination_account_id, amount, currency, convert_currency, frequency,
+                                 cron_expression, start_at, end_at, max_occurrences, business_day_adjustment, status,
+                                 next_scheduled_at, next_execute_at)
+    VALUES ($1, $2, $3, $4, $5, $6, $7, $8::timestamp, $9::timestamp, $10, $11, $12, $13::timestamp, $14::timestamp)
+    RETURNING `+standingOrderColumns,
+		request.SourceAccountID, request.DestinationAccountID, request.Amount, source.Currency, request.ConvertCurrency,
+		request.Frequency, cron, formatTimestamp(request.StartAt), nullableTimestamp(request.EndAt), request.MaxOccurrences,
+		request.BusinessDayAdjustment, StandingOrderStatusActive, formatTimestamp(scheduledAt), formatTimestamp(executeAt)), order)
+}
+
+func QueryStandingOrderById(DB *sql.DB, standingOrderID int, order *StandingOrder) error {
+	err := scanStandingOrder(DB.QueryRow("SELECT "+standingOrderColumns+" FROM standing_orders WHERE id = $1", standingOrderID), order)
+	return notFound(err, ErrStandingOrderNotFound)
+}
+
+// QueryStandingOrderExecutions fills executions with the executed and failed occurrences of the standing order, oldest first
+func QueryStandingOrderExecutions(DB *sql.DB, standingOrderID int, executions *[]StandingOrderExecution) error {
+	rows, err := DB.Query("SELECT "+standingOrderExecutionColumns+" FROM standing_order_executions WHERE standing_order_id = $1 ORDER BY occurrence", standingOrderID)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	*executions = []StandingOrderExecution{}
+	for rows.Next() {
+		execution := StandingOrderExecution{}
+		err = scanStandingOrderExecution(rows, &execution)
+		if err != nil {
+			return err
+		}
+		*executions = append(*executions, execution)
+	}
+	return rows.Err()
+}
+
+// CancelStandingOrder stops an active standing order from generating further transfers and fills order
+func CancelStandingOrder(DB *sql.DB, standingOrderID int, order *StandingOrder) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	err = scanStandingOrder(dbtx.QueryRow("SELECT "+standingOrderColumns+" FROM standing_orders WHERE id = $1 FOR UPDATE", standingOrderID), order)
+	if err != nil {
+		return notFound(err, ErrStandingOrderNotFound)
+	}
+	if order.Status != StandingOrderStatusActive {
+		return ErrStandingOrderNotActive
+	}
+
+	err = scanStandingOrder(dbtx.QueryRow(`
+    UPDATE standing_orders SET status = $1, next_scheduled_at = NULL, next_execute_at = NULL, updated_at = CURRENT_TIMESTAMP
+    WHERE id = $2
+    RETURNING `+standingOrderColumns, StandingOrderStatusCancelled, standingOrderID), order)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
+
+// ExecuteDueStandingOrder executes the next occurrence of the active standing order that has been due the longest,
+// fills execution with its outcome and moves the standing order on to its following occurrence, all in one database
+// transaction. It returns sql.ErrNoRows if no standing order is due.
+// The standing order row is locked and standing orders locked by another instance are skipped, and the execution
+// history has one row per occurrence, so no occurrence is ever executed twice. A failed occurrence is not retried.
+func ExecuteDueStandingOrder(DB *sql.DB, execution *StandingOrderExecution) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	order := StandingOrder{}
+	err = scanStandingOrder(dbtx.QueryRow(`
+    SELECT `+standingOrderColumns+`
+    FROM standing_orders
+    WHERE status = $1 AND next_execute_at <= CURRENT_TIMESTAMP
+    ORDER BY next_execute_at, id
+    LIMIT 1
+    FOR UPDATE SKIP LOCKED
+`, StandingOrderStatusActive), &order)
+	if err != nil {
+		return err
+	}
+
+	// The transfer runs in a savepoint, so that a failed occurrence is rolled back on its own and can still be recorded
+	_, err = dbtx.Exec("SAVEPOINT standing_order")
+	if err != nil {
+		return err
+	}
+	transaction := order.Transaction()
+	record := TransactionRecord{}
+	transferErr := processTransaction(dbtx, &transaction, false, &record)
+	status := StandingOrderExecutionSucceeded
+	var transactionID *int
+	var message *string
+	if transferErr == nil {
+		transactionID = &record.TransactionID
+	} else {
+		_, err = dbtx.Exec("ROLLBACK TO SAVEPOINT standing_order")
+		if err != nil {
+			return err
+		}
+		status = StandingOrderExecutionFailed
+		text := transferErr.Error()
+		message = &text
+	}
+
+	occurrence := order.Occurrences + 1
+	err = scanStandingOrderExecution(dbtx.QueryRow(`
+    INSERT INTO standing_order_executions (standing_order_id, occurrence, scheduled_at, execute_at, status, error, transaction_id)
+    VALUES ($1, $2, $3::timestamp, $4::timestamp, $5, $6, $7)
+    RETURNING `+standingOrderExecutionColumns,
+		order.StandingOrderID, occurrence, nullableTimestamp(order.NextScheduledAt), nullableTimestamp(order.NextExecuteAt),
+		status, message, transactionID), execution)
+	if err != nil {
+		return err
+	}
+
+	orderStatus := StandingOrderStatusActive
+	var nextScheduledAt, nextExecuteAt *time.Time
+	scheduledAt, executeAt, ok, err := order.Schedule(occurrence+1, *order.NextScheduledAt)
+	if err != nil {
+		return err
+	}
+	if ok {
+		nextScheduledAt = &scheduledAt
+		nextExecuteAt = &executeAt
+	} else {
+		orderStatus = StandingOrderStatusCompleted
+	}
+	_, err = dbtx.Exec(`
+    UPDATE standing_orders
+    SET status = $1, occurrences = $2, next_scheduled_at = $3::timestamp, next_execute_at = $4::timestamp,
+        updated_at = CURRENT_TIMESTAMP
+    WHERE id = $5
+`, orderStatus, occurrence, nullableTimestamp(nextScheduledAt), nullableTimestamp(nextExecuteAt), order.StandingOrderID)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
@@ -0,0 +1,458 @@
+package db
+
+import (
+	"database/sql"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+var ErrAccountExists = newError(KindConflict, "duplicate_account", "account ID already exists")
+var ErrNotSupported = newError(KindNotSupported, "not_supported", "not supported by this storage backend")
+
+// Store is the storage the HTTP handlers and background workers work with. PostgresStore is the production backend
+// and has every feature. MemoryStore and SQLiteStore keep accounts and transfers with the same semantics and errors,
+// so that handlers can be tested without a database, and answer the other features, such as holds and fee schedules,
+// with ErrNotSupported.
+type Store interface {
+	// CreateAccount creates the account, failing with ErrAccountExists if its ID is taken, and if idempotencyKey is
+	// not nil stores the key atomically with it
+	CreateAccount(account *Account, idempotencyKey *IdempotencyKey) error
+	// QueryAccountByAccountId fills account, it returns ErrAccountNotFound if the account does not exist
+	QueryAccountByAccountId(accountID int, account *Account) error
+	// ProcessTransaction performs the transfer and fills record, see ProcessTransactionWithIdempotencyKey
+	ProcessTransaction(transaction *Transaction, idempotencyKey *IdempotencyKey, record *TransactionRecord) error
+	// QueryTransactionById fills record, it returns ErrTransactionNotFound if the transfer does not exist
+	QueryTransactionById(transactionID int, record *TransactionRecord) error
+	// QueryTransferFee fills fee with the fee the transfer would be charged, it is left untouched if there is none
+	QueryTransferFee(transaction *Transaction, fee *Fee) error
+	// QueryApprovalPolicy fills policy with the policy of policy.Currency, it returns sql.ErrNoRows if there is none
+	QueryApprovalPolicy(policy *ApprovalPolicy) error
+	// CreateTransferApproval stores the transfer as waiting for approval, see CreateTransferApproval
+	CreateTransferApproval(transaction *Transaction, requestedBy string, policy *ApprovalPolicy, idempotencyKey *IdempotencyKey, approval *TransferApproval) error
+	// QueryIdempotencyKey fills idempotencyKey with a key that is still retained, it returns sql.ErrNoRows otherwise
+	QueryIdempotencyKey(scope string, key string, idempotencyKey *IdempotencyKey) error
+	// DeleteExpiredIdempotencyKeys removes keys that are past the retention window and returns how many
+	DeleteExpiredIdempotencyKeys() (int64, error)
+
+	// The methods below are the features beyond accounts and transfers, each is documented on the function of this
+	// package of the same name
+
+	QueryAccountTransactions(accountID int, filter TransactionHistoryFilter, page *TransactionHistoryPage) error
+	ChangeAccountStatus(accountID int, change *AccountStatusChange, account *Account) error
+	QueryAccountStatusChanges(accountID int, changes *[]AccountStatusChange) error
+	SetOverdraft(accountID int, settings *OverdraftSettings, account *Account) error
+	UpsertTransferLimitPolicy(policy *TransferLimitPolicy) error
+	QueryTransferLimitPolicy(policy *TransferLimitPolicy) error
+	ProcessTransactionBatch(batch *TransactionBatch, record *TransactionBatchRecord) error
+	QueryTransactionBatchById(batchID int, record *TransactionBatchRecord) error
+	ReverseTransaction(transactionID int, amount *Money, record *TransactionRecord) error
+	CreateHold(request *HoldRequest, hold *Hold) error
+	QueryHoldById(holdID int, hold *Hold) error
+	CaptureHold(holdID int, amount *Money, hold *Hold, record *TransactionRecord) error
+	VoidHold(holdID int, hold *Hold) error
+	ExpireHolds(limit int) (int, error)
+	UpsertExchangeRates(rates []ExchangeRate) error
+	QueryCurrentExchangeRate(base Currency, quote Currency, rate *ExchangeRate) error
+	UpsertFeeSchedule(schedule *FeeSchedule) error
+	QueryFeeSchedules(schedules *[]FeeSchedule) error
+	SetInterestRate(rate *InterestRate) error
+	QueryInterestRate(rate *InterestRate) error
+	QueryInterestAccruals(accountID int, accruals *[]InterestAccrual) error
+	AccrueMissingInterest(through time.Time) (int, error)
+	QueryAccountsWithUnpostedInterest(before time.Time) ([]int, error)
+	PostInterest(accountID int, before time.Time, record *TransactionRecord) error
+	CreateScheduledTransfer(request *ScheduledTransferRequest, transfer *ScheduledTransfer) error
+	QueryScheduledTransferById(scheduledTransferID int, transfer *ScheduledTransfer) error
+	QueryScheduledTransfers(filter ScheduledTransferFilter, transfers *[]ScheduledTransfer) error
+	CancelScheduledTransfer(scheduledTransferID int, transfer *ScheduledTransfer) error
+	ExecuteDueScheduledTransfer(transfer *ScheduledTransfer) error
+	CreateStandingOrder(request *StandingOrderRequest, order *StandingOrder) error
+	QueryStandingOrderById(standingOrderID int, order *StandingOrder) error
+	QueryStandingOrderExecutions(standingOrderID int, executions *[]StandingOrderExecution) error
+	CancelStandingOrder(standingOrderID int, order *StandingOrder) error
+	ExecuteDueStandingOrder(execution *StandingOrderExecution) error
+	UpsertApprovalPolicy(policy *ApprovalPolicy) error
+	QueryApprovalPolicies(policies *[]ApprovalPolicy) error
+	QueryTransferApprovalById(transferApprovalID int, approval *TransferApproval) error
+	QueryTransferApprovals(status string, limit int, approvals *[]TransferApproval) error
+	ApproveTransfer(transferApprovalID int, decidedBy string, decision *ApprovalDecision, approval *TransferApproval, record *TransactionRecord) error
+	RejectTransfer(transferApprovalID int, decidedBy string, decision *ApprovalDecision, approval *TransferApproval) error
+	ExpireTransferApprovals() (int, error)
+}
+
+// PostgresStore is the Store backed by the database functions of this package
+type PostgresStore struct {
+	DB *sql.DB
+}
+
+func NewPostgresStore(DB *sql.DB) *PostgresStore {
+	return &PostgresStore{DB: DB}
+}
+
+func (s *PostgresStore) CreateAccount(account *Account, idempotencyKey *IdempotencyKey) error {
+	return CreateAccountWithIdempotencyKey(s.DB, account, idempotencyKey)
+}
+
+func (s *PostgresStore) QueryAccountByAccountId(accountID int, account *Account) error {
+	return QueryAccountByAccountId(s.DB, accountID, account)
+}
+
+func (s *PostgresStore) ProcessTransaction(transaction *Transaction, idempotencyKey *IdempotencyKey, record *TransactionRecord) error {
+	return ProcessTransactionWithIdempotencyKey(s.DB, transaction, idempotencyKey, record)
+}
+
+func (s *PostgresStore) QueryTransactionById(transactionID int, record *TransactionRecord) error {
+	return QueryTransactionById(s.DB, transactionID, record)
+}
+
+func (s *PostgresStore) QueryTransferFee(transaction *Transaction, fee *Fee) error {
+	return QueryTransferFee(s.DB, transaction, fee)
+}
+
+func (s *PostgresStore) QueryApprovalPolicy(policy *ApprovalPolicy) error {
+	return QueryApprovalPolicy(s.DB, policy)
+}
+
+func (s *PostgresStore) CreateTransferApproval(transaction *Transaction, requestedBy string, policy *ApprovalPolicy, idempotencyKey *IdempotencyKey, approval *TransferApproval) error {
+	return CreateTransferApproval(s.DB, transaction, requestedBy, policy, idempotencyKey, approval)
+}
+
+func (s *PostgresStore) QueryIdempotencyKey(scope string, key string, idempotencyKey *IdempotencyKey) error {
+	return QueryIdempotencyKey(s.DB, scope, key, idempotencyKey)
+}
+
+func (s *PostgresStore) DeleteExpiredIdempotencyKeys() (int64, error) {
+	return DeleteExpiredIdempotencyKeys(s.DB)
+}
+
+func (s *PostgresStore) QueryAccountTransactions(accountID int, filter TransactionHistoryFilter, page *TransactionHistoryPage) error {
+	return QueryAccountTransactions(s.DB, accountID, filter, page)
+}
+
+func (s *PostgresStore) ChangeAccountStatus(accountID int, change *AccountStatusChange, account *Account) error {
+	return ChangeAccountStatus(s.DB, accountID, change, account)
+}
+
+func (s *PostgresStore) QueryAccountStatusChanges(accountID int, changes *[]AccountStatusChange) error {
+	return QueryAccountStatusChanges(s.DB, accountID, changes)
+}
+
+func (s *PostgresStore) SetOverdraft(accountID int, settings *OverdraftSettings, account *Account) error {
+	return SetOverdraft(s.DB, accountID, settings, account)
+}
+
+func (s *PostgresStore) UpsertTransferLimitPolicy(policy *TransferLimitPolicy) error {
+	return UpsertTransferLimitPolicy(s.DB, policy)
+}
+
+func (s *PostgresStore) QueryTransferLimitPolicy(policy *TransferLimitPolicy) error {
+	return QueryTransferLimitPolicy(s.DB, policy)
+}
+
+func (s *PostgresStore) ProcessTransactionBatch(batch *TransactionBatch, record *TransactionBatchRecord) error {
+	return ProcessTransactionBatch(s.DB, batch, record)
+}
+
+func (s *PostgresStore) QueryTransactionBatchById(batchID int, record *TransactionBatchRecord) error {
+	return QueryTransactionBatchById(s.DB, batchID, record)
+}
+
+func (s *PostgresStore) ReverseTransaction(transactionID int, amount *Money, record *TransactionRecord) error {
+	return ReverseTransaction(s.DB, transactionID, amount, record)
+}
+
+func (s *PostgresStore) CreateHold(request *HoldRequest, hold *Hold) error {
+	return CreateHold(s.DB, request, hold)
+}
+
+func (s *PostgresStore) QueryHoldById(holdID int, hold *Hold) error {
+	return QueryHoldById(s.DB, holdID, hold)
+}
+
+func (s *PostgresStore) CaptureHold(holdID int, amount *Money, hold *Hold, record *TransactionRecord) error {
+	return CaptureHold(s.DB, holdID, amount, hold, record)
+}
+
+func (s *PostgresStore) VoidHold(holdID int, hold *Hold) error {
+	return VoidHold(s.DB, holdID, hold)
+}
+
+func (s *PostgresStore) ExpireHolds(limit int) (int, error) {
+	return ExpireHolds(s.DB, limit)
+}
+
+func (s *PostgresStore) UpsertExchangeRates(rates []ExchangeRate) error {
+	return UpsertExchangeRates(s.DB, rates)
+}
+
+func (s *PostgresStore) QueryCurrentExchangeRate(base Currency, quote Currency, rate *ExchangeRate) error {
+	return QueryCurrentExchangeRate(s.DB, base, quote, rate)
+}
+
+func (s *PostgresStore) UpsertFeeSchedule(schedule *FeeSchedule) error {
+	return UpsertFeeSchedule(s.DB, schedule)
+}
+
+func (s *PostgresStore) QueryFeeSchedules(schedules *[]FeeSchedule) error {
+	return QueryFeeSchedules(s.DB, schedules)
+}
+
+func (s *PostgresStore) SetInterestRate(rate *InterestRate) error {
+	return SetInterestRate(s.DB, rate)
+}
+
+func (s *PostgresStore) QueryInterestRate(rate *InterestRate) error {
+	return QueryInterestRate(s.DB, rate)
+}
+
+func (s *PostgresStore) QueryInterestAccruals(accountID int, accruals *[]InterestAccrual) error {
+	return QueryInterestAccruals(s.DB, accountID, accruals)
+}
+
+func (s *PostgresStore) AccrueMissingInterest(through time.Time) (int, error) {
+	return AccrueMissingInterest(s.DB, through)
+}
+
+func (s *PostgresStore) QueryAccountsWithUnpostedInterest(before time.Time) ([]int, error) {
+	return QueryAccountsWithUnpostedInterest(s.DB, before)
+}
+
+func (s *PostgresStore) PostInterest(accountID int, before time.Time, record *TransactionRecord) error {
+	return PostInterest(s.DB, accountID, before, record)
+}
+
+func (s *PostgresStore) CreateScheduledTransfer(request *ScheduledTransferRequest, transfer *ScheduledTransfer) error {
+	return CreateScheduledTransfer(s.DB, request, transfer)
+}
+
+func (s *PostgresStore) QueryScheduledTransferById(scheduledTransferID int, transfer *ScheduledTransfer) error {
+	return QueryScheduledTransferById(s.DB, scheduledTransferID, transfer)
+}
+
+func (s *PostgresStore) QueryScheduledTransfers(filter ScheduledTransferFilter, transfers *[]ScheduledTransfer) error {
+	return QueryScheduledTransfers(s.DB, filter, transfers)
+}
+
+func (s *PostgresStore) CancelScheduledTransfer(scheduledTransferID int, transfer *ScheduledTransfer) error {
+	return CancelScheduledTransfer(s.DB, scheduledTransferID, transfer)
+}
+
+func (s *PostgresStore) ExecuteDueScheduledTransfer(transfer *ScheduledTransfer) error {
+	return ExecuteDueScheduledTransfer(s.DB, transfer)
+}
+
+func (s *PostgresStore) CreateStandingOrder(request *StandingOrderRequest, order *StandingOrder) error {
+	return CreateStandingOrder(s.DB, request, order)
+}
+
+func (s *PostgresStore) QueryStandingOrderById(standingOrderID int, order *StandingOrder) error {
+	return QueryStandingOrderById(s.DB, standingOrderID, order)
+}
+
+func (s *PostgresStore) QueryStandingOrderExecutions(standingOrderID int, executions *[]StandingOrderExecution) error {
+	return QueryStandingOrderExecutions(s.DB, standingOrderID, executions)
+}
+
+func (s *PostgresStore) CancelStandingOrder(standingOrderID int, order *StandingOrder) error {
+	return CancelStandingOrder(s.DB, standingOrderID, order)
+}
+
+func (s *PostgresStore) ExecuteDueStandingOrder(execution *StandingOrderExecution) error {
+	return ExecuteDueStandingOrder(s.DB, execution)
+}
+
+func (s *PostgresStore) UpsertApprovalPolicy(policy *ApprovalPolicy) error {
+	return UpsertApprovalPolicy(s.DB, policy)
+}
+
+func (s *PostgresStore) QueryApprovalPolicies(policies *[]ApprovalPolicy) error {
+	return QueryApprovalPolicies(s.DB, policies)
+}
+
+func (s *PostgresStore) QueryTransferApprovalById(transferApprovalID int, approval *TransferApproval) error {
+	return QueryTransferApprovalById(s.DB, transferApprovalID, approval)
+}
+
+func (s *PostgresStore) QueryTransferApprovals(status string, limit int, approvals *[]TransferApproval) error {
+	return QueryTransferApprovals(s.DB, status, limit, approvals)
+}
+
+func (s *PostgresStore) ApproveTransfer(transferApprovalID int, decidedBy string, decision *ApprovalDecision, approval *TransferApproval, record *TransactionRecord) error {
+	return ApproveTransfer(s.DB, transferApprovalID, decidedBy, decision, approval, record)
+}
+
+func (s *PostgresStore) RejectTransfer(transferApprovalID int, decidedBy string, decision *ApprovalDecision, approval *TransferApproval) error {
+	return RejectTransfer(s.DB, transferApprovalID, decidedBy, decision, approval)
+}
+
+func (s *PostgresStore) ExpireTransferApprovals() (int, error) {
+	return ExpireTransferApprovals(s.DB)
+}
+
+// unsupportedFeatures is embedded by the stores that only keep accounts and transfers, it answers the features
+// beyond them with ErrNotSupported
+type unsupportedFeatures struct{}
+
+func (unsupportedFeatures) QueryAccountTransactions(accountID int, filter TransactionHistoryFilter, page *TransactionHistoryPage) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) ChangeAccountStatus(accountID int, change *AccountStatusChange, account *Account) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryAccountStatusChanges(accountID int, changes *[]AccountStatusChange) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) SetOverdraft(accountID int, settings *OverdraftSettings, account *Account) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) UpsertTransferLimitPolicy(policy *TransferLimitPolicy) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryTransferLimitPolicy(policy *TransferLimitPolicy) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) ProcessTransactionBatch(batch *TransactionBatch, record *TransactionBatchRecord) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryTransactionBatchById(batchID int, record *TransactionBatchRecord) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) ReverseTransaction(transactionID int, amount *Money, record *TransactionRecord) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) CreateHold(request *HoldRequest, hold *Hold) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryHoldById(holdID int, hold *Hold) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) CaptureHold(holdID int, amount *Money, hold *Hold, record *TransactionRecord) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) VoidHold(holdID int, hold *Hold) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) ExpireHolds(limit int) (int, error) {
+	return 0, ErrNotSupported
+}
+
+func (unsupportedFeatures) UpsertExchangeRates(rates []ExchangeRate) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryCurrentExchangeRate(base Currency, quote Currency, rate *ExchangeRate) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) UpsertFeeSchedule(schedule *FeeSchedule) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryFeeSchedules(schedules *[]FeeSchedule) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) SetInterestRate(rate *InterestRate) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryInterestRate(rate *InterestRate) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryInterestAccruals(accountID int, accruals *[]InterestAccrual) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) AccrueMissingInterest(through time.Time) (int, error) {
+	return 0, ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryAccountsWithUnpostedInterest(before time.Time) ([]int, error) {
+	return nil, ErrNotSupported
+}
+
+func (unsupportedFeatures) PostInterest(accountID int, before time.Time, record *TransactionRecord) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) CreateScheduledTransfer(request *ScheduledTransferRequest, transfer *ScheduledTransfer) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryScheduledTransferById(scheduledTransferID int, transfer *ScheduledTransfer) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryScheduledTransfers(filter ScheduledTransferFilter, transfers *[]ScheduledTransfer) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) CancelScheduledTransfer(scheduledTransferID int, transfer *ScheduledTransfer) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) ExecuteDueScheduledTransfer(transfer *ScheduledTransfer) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) CreateStandingOrder(request *StandingOrderRequest, order *StandingOrder) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryStandingOrderById(standingOrderID int, order *StandingOrder) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryStandingOrderExecutions(standingOrderID int, executions *[]StandingOrderExecution) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) CancelStandingOrder(standingOrderID int, order *StandingOrder) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) ExecuteDueStandingOrder(execution *StandingOrderExecution) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) UpsertApprovalPolicy(policy *ApprovalPolicy) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryApprovalPolicies(policies *[]ApprovalPolicy) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryTransferApprovalById(transferApprovalID int, approval *TransferApproval) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) QueryTransferApprovals(status string, limit int, approvals *[]TransferApproval) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) ApproveTransfer(transferApprovalID int, decidedBy string, decision *ApprovalDecision, approval *TransferApproval, record *TransactionRecord) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) RejectTransfer(transferApprovalID int, decidedBy string, decision *ApprovalDecision, approval *TransferApproval) error {
+	return ErrNotSupported
+}
+
+func (unsupportedFeatures) ExpireTransferApprovals() (int, error) {
+	return 0, ErrNotSupported
+}
@@ -0,0 +1,114 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	. "takeHomeAssignment/entities"
+)
+
+// ProcessTransactionBatch performs every transfer of the batch in one database transaction and fills record.
+// All accounts of the batch, including the revenue accounts of fees, are locked up front in account ID order.
+// The legs are applied in the order given and each is charged its fee like a single transfer, and the batch is only
+// committed if every source account can fund its leg and fee when the leg is applied.
+func ProcessTransactionBatch(DB *sql.DB, batch *TransactionBatch, record *TransactionBatchRecord) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	err = dbtx.QueryRow("INSERT INTO transfer_batches DEFAULT VALUES RETURNING id, created_at").Scan(&record.BatchID, &record.CreatedAt)
+	if err != nil {
+		return err
+	}
+
+	var accountIDs []int
+	seen := map[int]bool{}
+	fees := make([]*Fee, len(batch.Transactions))
+	for i, transaction := range batch.Transactions {
+		fees[i], err = transferFee(dbtx, &transaction)
+		if err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+		legAccountIDs := []int{transaction.SourceAccountID, transaction.DestinationAccountID}
+		if fees[i] != nil {
+			legAccountIDs = append(legAccountIDs, fees[i].RevenueAccountID)
+		}
+		for _, accountID := range legAccountIDs {
+			if !seen[accountID] {
+				seen[accountID] = true
+				accountIDs = append(accountIDs, accountID)
+			}
+		}
+	}
+	accounts, err := lockAccounts(dbtx, accountIDs)
+	if err != nil {
+		return err
+	}
+
+	record.Transactions = make([]TransactionRecord, len(batch.Transactions))
+	for i := range batch.Transactions {
+		transaction := &batch.Transactions[i]
+		// Only the account a leg debits is checked, against its balance after the earlier legs, so a leg may spend
+		// money an earlier leg brought in and an account that only receives is never refused
+		spent := transaction.Amount
+		if fees[i] != nil {
+			spent += fees[i].Amount
+		}
+		if !accounts[transaction.SourceAccountID].canSpend(spent) {
+			return fmt.Errorf("transaction %d: %w: account %d", i, ErrInsufficientBalance, transaction.SourceAccountID)
+		}
+		err = checkApprovalPolicy(dbtx, accounts[transaction.SourceAccountID].Currency, transaction.Amount)
+		if err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+		record.Transactions[i].Fee = fees[i]
+		err = applyTransfer(dbtx, accounts, transaction, &record.BatchID, &record.Transactions[i])
+		if err != nil {
+			return fmt.Errorf("transaction %d: %w", i, err)
+		}
+	}
+
+	err = writeBalances(dbtx, accounts)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
+
+// QueryTransactionBatchById fills record with the batch and its transactions
+func QueryTransactionBatchById(DB *sql.DB, batchID int, record *TransactionBatchRecord) error {
+	err := DB.QueryRow("SELECT id, created_at FROM transfer_batches WHERE id = $1", batchID).Scan(&record.BatchID, &record.CreatedAt)
+	if err != nil {
+		return notFound(err, ErrBatchNotFound)
+	}
+
+	rows, err := DB.Query("SELECT id FROM account_transactions WHERE batch_id = $1 ORDER BY id", batchID)
+	if err != nil {
+		return err
+	}
+	var transactionIDs []int
+	for rows.Next() {
+		var transactionID int
+		err = rows.Scan(&transactionID)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		transactionIDs = append(transactionIDs, transactionID)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	record.Transactions = make([]TransactionRecord, len(transactionIDs))
+	for i, transactionID := range transactionIDs {
+		err = QueryTransactionById(DB, transactionID, &record.Transactions[i])
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
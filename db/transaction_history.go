@@ -0,0 +1,117 @@
+package db
+
+import (
+	"database/sql"
+	"fmt"
+	"strconv"
+	"strings"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+// QueryAccountTransactions fills page with the transfers into and out of the account and the fees paid to it,
+// newest first. Each direction is read with its own index ordered by (created_at, id) and then merged, and
+// pagination is keyset based, so deep pages cost the same as the first one.
+// A fee paid to the account with a transfer into it is reported on the incoming row rather than as a row of its own,
+// so that no two rows share a transaction ID.
+func QueryAccountTransactions(DB *sql.DB, accountID int, filter TransactionHistoryFilter, page *TransactionHistoryPage) error {
+	args := []interface{}{accountID}
+	addArg := func(value interface{}) string {
+		args = append(args, value)
+		return "$" + strconv.Itoa(len(args))
+	}
+
+	// %[1]s is replaced by the amount column of each direction
+	var conditions []string
+	if filter.From != nil {
+		conditions = append(conditions, "created_at >= "+addArg(formatTimestamp(*filter.From))+"::timestamp")
+	}
+	if filter.To != nil {
+		conditions = append(conditions, "created_at < "+addArg(formatTimestamp(*filter.To))+"::timestamp")
+	}
+	if filter.MinAmount != nil {
+		conditions = append(conditions, "%[1]s >= "+addArg(*filter.MinAmount))
+	}
+	if filter.MaxAmount != nil {
+		conditions = append(conditions, "%[1]s <= "+addArg(*filter.MaxAmount))
+	}
+	if filter.After != nil {
+		conditions = append(conditions, fmt.Sprintf("(created_at, id) < (%s::timestamp, %s)",
+			addArg(formatTimestamp(filter.After.CreatedAt)), addArg(filter.After.TransactionID)))
+	}
+	where := ""
+	for _, condition := range conditions {
+		where += " AND " + condition
+	}
+	// Fetch one extra row to know whether there is a next page
+	limit := addArg(filter.Limit + 1)
+
+	var branches []string
+	if filter.Direction == "" || filter.Direction == DirectionOutgoing {
+		branches = append(branches, fmt.Sprintf(`(
+        SELECT id, 'outgoing' AS direction, account_transfer_in AS counterparty, amount, NULLIF(fee_amount, 0) AS fee,
+               currency, source_balance_after AS balance_after, created_at
+        FROM account_transactions
+        WHERE account_transfer_out = $1`+where+`
+        ORDER BY created_at DESC, id DESC
+        LIMIT `+limit+`)`, "amount"))
+	}
+	if filter.Direction == "" || filter.Direction == DirectionIncoming {
+		branches = append(branches, fmt.Sprintf(`(
+        SELECT id, 'incoming' AS direction, account_transfer_out AS counterparty, destination_amount,
+               CASE WHEN fee_account_id = $1 THEN fee_amount END AS fee, destination_currency,
+               destination_balance_after AS balance_after, created_at
+        FROM account_transactions
+        WHERE account_transfer_in = $1`+where+`
+        ORDER BY created_at DESC, id DESC
+        LIMIT `+limit+`)`, "destination_amount"))
+	}
+	if filter.Direction == "" || filter.Direction == DirectionFee {
+		branches = append(branches, fmt.Sprintf(`(
+        SELECT id, 'fee' AS direction, account_transfer_out AS counterparty, fee_amount, CAST(NULL AS DECIMAL(18, 3)),
+               currency, fee_account_balance_after AS balance_after, created_at
+        FROM account_transactions
+        WHERE fee_account_id = $1 AND account_transfer_in <> $1`+where+`
+        ORDER BY created_at DESC, id DESC
+        LIMIT `+limit+`)`, "fee_amount"))
+	}
+	query := `
+    SELECT id, direction, counterparty, amount, fee, currency, balance_after, created_at
+    FROM (` + strings.Join(branches, " UNION ALL ") + `) entries
+    ORDER BY created_at DESC, id DESC
+    LIMIT ` + limit
+
+	rows, err := DB.Query(query, args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	page.Transactions = []AccountTransaction{}
+	page.NextCursor = ""
+	for rows.Next() {
+		var entry AccountTransaction
+		err = rows.Scan(&entry.TransactionID, &entry.Direction, &entry.CounterpartyAccountID, &entry.Amount,
+			&entry.Fee, &entry.Currency, &entry.BalanceAfter, &entry.CreatedAt)
+		if err != nil {
+			return err
+		}
+		page.Transactions = append(page.Transactions, entry)
+	}
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+
+	if len(page.Transactions) > filter.Limit {
+		page.Transactions = page.Transactions[:filter.Limit]
+		last := page.Transactions[len(page.Transactions)-1]
+		page.NextCursor = TransactionHistoryCursor{CreatedAt: last.CreatedAt, TransactionID: last.TransactionID}.Encode()
+	}
+	return nil
+}
+
+// formatTimestamp converts to the UTC wall clock time that TIMESTAMP columns are stored in
+func formatTimestamp(t time.Time) string {
+	return t.UTC().Format(CursorTimeLayout)
+}
@@ -0,0 +1,232 @@
+package db
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	. "takeHomeAssignment/entities"
+)
+
+var ErrTransferApprovalNotPending = newError(KindConflict, "transfer_approval_not_pending", "transfer has already been approved, rejected or has expired")
+var ErrSelfApproval = newError(KindForbidden, "self_approval", "a transfer has to be approved or rejected by a different principal than the one who requested it")
+var ErrApprovalRequired = newError(KindForbidden, "approval_required", "transfer is over the approval threshold of its currency, it has to be requested with POST /transactions and approved by a second principal")
+
+const transferApprovalColumns = `id, source_account_id, destination_account_id, amount, currency, convert_currency, status,
+           requested_by, decided_by, reason, transaction_id, expires_at, created_at, decided_at`
+
+func scanTransferApproval(row rowScanner, approval *TransferApproval) error {
+	return row.Scan(&approval.TransferApprovalID, &approval.SourceAccountID, &approval.DestinationAccountID,
+		&approval.Amount, &approval.Currency, &approval.ConvertCurrency, &approval.Status, &approval.RequestedBy,
+		&approval.DecidedBy, &approval.Reason, &approval.TransactionID, &approval.ExpiresAt, &approval.CreatedAt,
+		&approval.DecidedAt)
+}
+
+// UpsertApprovalPolicy stores the policy, replacing the one for the same currency if there is one
+func UpsertApprovalPolicy(DB *sql.DB, policy *ApprovalPolicy) error {
+	return DB.QueryRow(`
+    INSERT INTO approval_policies (currency, threshold, ttl_seconds)
+    VALUES ($1, $2, $3)
+    ON CONFLICT (currency) DO UPDATE SET threshold = EXCLUDED.threshold,
+                                         ttl_seconds = EXCLUDED.ttl_seconds,
+                                         updated_at = CURRENT_TIMESTAMP
+    RETURNING currency, threshold, ttl_seconds
+`, policy.Currency, policy.Threshold, policy.TTLSeconds).Scan(&policy.Currency, &policy.Threshold, &policy.TTLSeconds)
+}
+
+// QueryApprovalPolicy fills policy with the policy of policy.Currency
+func QueryApprovalPolicy(DB *sql.DB, policy *ApprovalPolicy) error {
+	return DB.QueryRow("SELECT currency, threshold, ttl_seconds FROM approval_policies WHERE currency = $1", policy.Currency).Scan(
+		&policy.Currency, &policy.Threshold, &policy.TTLSeconds)
+}
+
+// checkApprovalPolicy fails with ErrApprovalRequired if a transfer of amount out of an account in currency is over
+// the approval threshold of the currency. Only ApproveTransfer may execute such a transfer, every other way of moving
+// money checks this, so that none of them gets around the second principal.
+func checkApprovalPolicy(q queryer, currency Currency, amount Money) error {
+	policy := ApprovalPolicy{}
+	err := q.QueryRow("SELECT currency, threshold, ttl_seconds FROM approval_policies WHERE currency = $1", currency).Scan(
+		&policy.Currency, &policy.Threshold, &policy.TTLSeconds)
+	if errors.Is(err, sql.ErrNoRows) {
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+	if policy.RequiresApproval(amount) {
+		return ErrApprovalRequired
+	}
+	return nil
+}
+
+// QueryApprovalPolicies fills policies with every approval policy, ordered by currency
+func QueryApprovalPolicies(DB *sql.DB, policies *[]ApprovalPolicy) error {
+	rows, err := DB.Query("SELECT currency, threshold, ttl_seconds FROM approval_policies ORDER BY currency")
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	*policies = []ApprovalPolicy{}
+	for rows.Next() {
+		policy := ApprovalPolicy{}
+		err = rows.Scan(&policy.Currency, &policy.Threshold, &policy.TTLSeconds)
+		if err != nil {
+			return err
+		}
+		*policies = append(*policies, policy)
+	}
+	return rows.Err()
+}
+
+// CreateTransferApproval stores the transfer as waiting for approval until the policy TTL has passed, and fills approval.
+// If idempotencyKey is not nil, the approval becomes its stored response and the key is inserted in the same
+// database transaction.
+func CreateTransferApproval(DB *sql.DB, transaction *Transaction, requestedBy string, policy *ApprovalPolicy, idempotencyKey *IdempotencyKey, approval *TransferApproval) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	// The currency is the one of the source account, ErrAccountNotFound if it does not exist
+	err = scanTransferApproval(dbtx.QueryRow(`
+    INSERT INTO transfer_approvals (source_account_id, destination_account_id, amount, currency, convert_currency, status,
+                                    requested_by, expires_at)
+    SELECT $1, $2, $3, currency, $4, $5, $6, CURRENT_TIMESTAMP + $7::float8 * INTERVAL '1 second'
+    FROM account_balance
+    WHERE account_id = $1
+    RETURNING `+transferApprovalColumns,
+		transaction.SourceAccountID, transaction.DestinationAccountID, transaction.Amount, transaction.ConvertCurrency,
+		TransferApprovalStatusPending, requestedBy, policy.TTL().Seconds()), approval)
+	if err != nil {
+		return notFound(err, ErrAccountNotFound)
+	}
+
+	if idempotencyKey != nil {
+		idempotencyKey.ResponseBody, err = json.Marshal(approval)
+		if err != nil {
+			return err
+		}
+		idempotencyKey.ResponseLocation = approval.Location()
+		err = insertIdempotencyKey(dbtx, idempotencyKey)
+		if err != nil {
+			return err
+		}
+	}
+	return dbtx.Commit()
+}
+
+func QueryTransferApprovalById(DB *sql.DB, transferApprovalID int, approval *TransferApproval) error {
+	err := scanTransferApproval(DB.QueryRow("SELECT "+transferApprovalColumns+" FROM transfer_approvals WHERE id = $1", transferApprovalID), approval)
+	return notFound(err, ErrTransferApprovalNotFound)
+}
+
+// QueryTransferApprovals fills approvals with at most limit approvals with the status, oldest first
+func QueryTransferApprovals(DB *sql.DB, status string, limit int, approvals *[]TransferApproval) error {
+	rows, err := DB.Query("SELECT "+transferApprovalColumns+" FROM transfer_approvals WHERE status = $1 ORDER BY id LIMIT $2", status, limit)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	*approvals = []TransferApproval{}
+	for rows.Next() {
+		approval := TransferApproval{}
+		err = scanTransferApproval(rows, &approval)
+		if err != nil {
+			return err
+		}
+		*approvals = append(*approvals, approval)
+	}
+	return rows.Err()
+}
+
+// ApproveTransfer executes the transfer waiting for approval exactly like ProcessTransaction, fills approval with the
+// decision and record with the transfer. The balance is checked again now, if the transfer fails the approval
+// stays pending so that it can be approved again before it expires.
+func ApproveTransfer(DB *sql.DB, transferApprovalID int, decidedBy string, decision *ApprovalDecision, approval *TransferApproval, record *TransactionRecord) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	err = lockPendingTransferApproval(dbtx, transferApprovalID, decidedBy, approval)
+	if err != nil {
+		return err
+	}
+	transaction := approval.Transaction()
+	err = processTransaction(dbtx, &transaction, true, record)
+	if err != nil {
+		return err
+	}
+
+	err = decideTransferApproval(dbtx, approval, TransferApprovalStatusApproved, decidedBy, decision, &record.TransactionID)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
+
+// RejectTransfer rejects the transfer waiting for approval without moving any money and fills approval
+func RejectTransfer(DB *sql.DB, transferApprovalID int, decidedBy string, decision *ApprovalDecision, approval *TransferApproval) error {
+	dbtx, err := DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer rollback(dbtx)
+
+	err = lockPendingTransferApproval(dbtx, transferApprovalID, decidedBy, approval)
+	if err != nil {
+		return err
+	}
+	err = decideTransferApproval(dbtx, approval, TransferApprovalStatusRejected, decidedBy, decision, nil)
+	if err != nil {
+		return err
+	}
+	return dbtx.Commit()
+}
+
+// ExpireTransferApprovals marks the approvals that have waited past their expiry as expired and returns how many
+func ExpireTransferApprovals(DB *sql.DB) (int, error) {
+	result, err := DB.Exec("UPDATE transfer_approvals SET status = $1, decided_at = CURRENT_TIMESTAMP WHERE status = $2 AND expires_at <= CURRENT_TIMESTAMP",
+		TransferApprovalStatusExpired, TransferApprovalStatusPending)
+	if err != nil {
+		return 0, err
+	}
+	expired, err := result.RowsAffected()
+	return int(expired), err
+}
+
+// lockPendingTransferApproval locks the approval row and fails with ErrTransferApprovalNotPending if it has already
+// been decided or has passed its expiry, even if ExpireTransferApprovals has not got to it yet, and with
+// ErrSelfApproval if decidedBy is the principal who requested the transfer
+func lockPendingTransferApproval(dbtx *sql.Tx, transferApprovalID int, decidedBy string, approval *TransferApproval) error {
+	var expired bool
+	err := dbtx.QueryRow("SELECT "+transferApprovalColumns+", expires_at <= CURRENT_TIMESTAMP FROM transfer_approvals WHERE id = $1 FOR UPDATE", transferApprovalID).Scan(
+		&approval.TransferApprovalID, &approval.SourceAccountID, &approval.DestinationAccountID, &approval.Amount,
+		&approval.Currency, &approval.ConvertCurrency, &approval.Status, &approval.RequestedBy, &approval.DecidedBy,
+		&approval.Reason, &approval.TransactionID, &approval.ExpiresAt, &approval.CreatedAt, &approval.DecidedAt, &expired)
+	if err != nil {
+		return notFound(err, ErrTransferApprovalNotFound)
+	}
+	if approval.Status != TransferApprovalStatusPending || expired {
+		return ErrTransferApprovalNotPending
+	}
+	if approval.RequestedBy == decidedBy {
+		return ErrSelfApproval
+	}
+	return nil
+}
+
+func decideTransferApproval(dbtx *sql.Tx, approval *TransferApproval, status string, decidedBy string, decision *ApprovalDecision, transactionID *int) error {
+	var reason *string
+	if decision.Reason != "" {
+		reason = &decision.Reason
+	}
+	return scanTransferApproval(dbtx.QueryRow(`
+    UPDATE transfer_approvals
+    SET status = $1, decided_by = $2, reason = $3, transaction_id = $4, decided_at = CURRENT_TIMESTAMP
+    WHERE id = $5
+    RETURNING `+transferApprovalColumns, status, decidedBy, reason, transactionID, approval.TransferApprovalID), approval)
+}
@@ -0,0 +1,128 @@
+package db
+
+import (
+	"database/sql"
+	"strconv"
+	. "takeHomeAssignment/entities"
+)
+
+const transferLimitColumns = "account_id, account_type, currency, max_per_transaction, max_per_day, max_per_30_days, max_transfers_per_hour"
+
+func scanTransferLimitPolicy(row rowScanner, policy *TransferLimitPolicy) error {
+	return row.Scan(&policy.AccountID, &policy.AccountType, &policy.Currency, &policy.MaxPerTransaction,
+		&policy.MaxPerDay, &policy.MaxPer30Days, &policy.MaxTransfersPerHour)
+}
+
+// QueryTransferLimitPolicy fills policy with the limits of policy.AccountID or, if it is nil, of policy.AccountType
+// in policy.Currency
+func QueryTransferLimitPolicy(DB *sql.DB, policy *TransferLimitPolicy) error {
+	var err error
+	if policy.AccountID != nil {
+		err = scanTransferLimitPolicy(DB.QueryRow("SELECT "+transferLimitColumns+" FROM transfer_limit_policies WHERE account_id = $1", *policy.AccountID), policy)
+	} else {
+		err = scanTransferLimitPolicy(DB.QueryRow("SELECT "+transferLimitColumns+" FROM transfer_limit_policies WHERE account_type = $1 AND currency = $2", *policy.AccountType, policy.Currency), policy)
+	}
+	return notFound(err, ErrTransferLimitsNotFound)
+}
+
+// UpsertTransferLimitPolicy stores the limits of policy.AccountID or, if it is nil, of policy.AccountType in
+// policy.Currency, replacing the ones it had before. The policy of an account is in the currency of the account,
+// policy.Currency may be left empty for it.
+func UpsertTransferLimitPolicy(DB *sql.DB, policy *TransferLimitPolicy) error {
+	conflict := "account_id"
+	if policy.AccountID != nil {
+		account := Account{}
+		err := QueryAccountByAccountId(DB, *policy.AccountID, &account)
+		if err != nil {
+			return err
+		}
+		if policy.Currency == "" {
+			policy.Currency = account.Currency
+		}
+		if policy.Currency != account.Currency {
+			return ErrCurrencyMismatch.withMessage("transfer limits of an account must be in the currency of the account")
+		}
+	} else {
+		conflict = "account_type, currency"
+	}
+	for _, limit := range []*Money{policy.MaxPerTransaction, policy.MaxPerDay, policy.MaxPer30Days} {
+		if limit != nil {
+			err := policy.Currency.ValidateAmount(*limit)
+			if err != nil {
+				return err
+			}
+		}
+	}
+	return scanTransferLimitPolicy(DB.QueryRow(`
+    INSERT INTO transfer_limit_policies (`+transferLimitColumns+`)
+    VALUES ($1, $2, $3, $4, $5, $6, $7)
+    ON CONFLICT (`+conflict+`) DO UPDATE SET max_per_transaction = EXCLUDED.max_per_transaction,
+                                            max_per_day = EXCLUDED.max_per_day,
+                                            max_per_30_days = EXCLUDED.max_per_30_days,
+                                            max_transfers_per_hour = EXCLUDED.max_transfers_per_hour,
+                                            updated_at = CURRENT_TIMESTAMP
+    RETURNING `+transferLimitColumns,
+		policy.AccountID, policy.AccountType, policy.Currency, policy.MaxPerTransaction, policy.MaxPerDay,
+		policy.MaxPer30Days, policy.MaxTransfersPerHour), policy)
+}
+
+// checkTransferLimits fails with a *LimitExceededError if sending amount, a transfer and its fee, from the account
+// would go over the policy of the account or the one of its account type and currency. Fees paid earlier are counted
+// the same way.
+// The account row is locked by the caller, so concurrent transfers from the same account are counted one after the
+// other and cannot jointly exceed a limit. Reversals are not counted, they give back money rather than spend it.
+func checkTransferLimits(dbtx *sql.Tx, account *lockedAccount, amount Money) error {
+	rows, err := dbtx.Query("SELECT "+transferLimitColumns+" FROM transfer_limit_policies WHERE account_id = $1 OR (account_type = $2 AND currency = $3)",
+		account.AccountID, account.AccountType, account.Currency)
+	if err != nil {
+		return err
+	}
+	var policies []TransferLimitPolicy
+	for rows.Next() {
+		policy := TransferLimitPolicy{}
+		err = scanTransferLimitPolicy(rows, &policy)
+		if err != nil {
+			rows.Close()
+			return err
+		}
+		policies = append(policies, policy)
+	}
+	rows.Close()
+	err = rows.Err()
+	if err != nil {
+		return err
+	}
+	if len(policies) == 0 {
+		return nil
+	}
+
+	// Transfers made earlier in the same database transaction, such as earlier legs of a batch, are included
+	var spentToday, spentLast30Days Money
+	var countLastHour int
+	err = dbtx.QueryRow(`
+    SELECT COALESCE(SUM(amount + fee_amount) FILTER (WHERE created_at >= date_trunc('day', CURRENT_TIMESTAMP)), 0),
+           COALESCE(SUM(amount + fee_amount), 0),
+           COUNT(*) FILTER (WHERE created_at >= CURRENT_TIMESTAMP - INTERVAL '1 hour')
+    FROM account_transactions
+    WHERE account_transfer_out = $1 AND reversal_of IS NULL AND created_at >= CURRENT_TIMESTAMP - INTERVAL '30 days'
+`, account.AccountID).Scan(&spentToday, &spentLast30Days, &countLastHour)
+	if err != nil {
+		return err
+	}
+
+	for _, policy := range policies {
+		if policy.MaxPerTransaction != nil && amount > *policy.MaxPerTransaction {
+			return &LimitExceededError{Limit: LimitMaxPerTransaction, Max: policy.MaxPerTransaction.Format(policy.Currency)}
+		}
+		if policy.MaxPerDay != nil && spentToday+amount > *policy.MaxPerDay {
+			return &LimitExceededError{Limit: LimitMaxPerDay, Max: policy.MaxPerDay.Format(policy.Currency)}
+		}
+		if policy.MaxPer30Days != nil && spentLast30Days+amount > *policy.MaxPer30Days {
+			return &LimitExceededError{Limit: LimitMaxPer30Days, Max: policy.MaxPer30Days.Format(policy.Currency)}
+		}
+		if policy.MaxTransfersPerHour != nil && countLastHour+1 > *policy.MaxTransfersPerHour {
+			return &LimitExceededError{Limit: LimitMaxTransfersPerHour, Max: strconv.Itoa(*policy.MaxTransfersPerHour)}
+		}
+	}
+	return nil
+}
@@ -2,44 +2,102 @@ package entities
 
 import (
 	"encoding/json"
-	"errors"
-	"strconv"
 )
 
+// Account.Balance is the ledger balance. AvailableBalance is the ledger balance minus the funds reserved by
+// active holds, and the account may spend up to OverdraftLimit beyond it, or without limit if UnlimitedOverdraft is set.
+// AccountType groups accounts that share transfer limit policies.
+// Only AccountID, Balance, Currency and AccountType are accepted as input, the overdraft is set through its own endpoint.
 type Account struct {
-	AccountID int     `json:"account_id" valid:"required"`
-	Balance   float64 `json:"balance" valid:"required"`
+	AccountID          int      `json:"account_id"`
+	Balance            Money    `json:"balance"`
+	AvailableBalance   Money    `json:"available_balance"`
+	Currency           Currency `json:"currency"`
+	AccountType        string   `json:"account_type,omitempty"`
+	Status             string   `json:"status,omitempty"`
+	OverdraftLimit     Money    `json:"overdraft_limit"`
+	UnlimitedOverdraft bool     `json:"unlimited_overdraft"`
+}
+
+// DefaultAccountType is assigned to accounts created without an explicit type
+const DefaultAccountType = "standard"
+
+// CanSpend reports whether the account can send amount without going over its overdraft limit
+func (a Account) CanSpend(amount Money) bool {
+	return a.UnlimitedOverdraft || a.AvailableBalance+a.OverdraftLimit >= amount
 }
 
 func (a *Account) UnmarshalJSON(data []byte) error {
-	type Alias Account
-	aux := &struct {
-		*Alias
-		Balance string `json:"balance"`
-	}{
-		Alias: (*Alias)(a),
-	}
-	err := json.Unmarshal(data, &aux)
+	dec, err := decodeObject(data)
 	if err != nil {
 		return err
 	}
-	balance, err := strconv.ParseFloat(aux.Balance, 64)
-	if err != nil {
-		return err
+	dec.positive("account_id", &a.AccountID, true)
+	hasBalance := dec.money("balance", &a.Balance, true)
+	if hasBalance && a.Balance < 0 {
+		dec.fail("balance", FieldOutOfRange, "cannot be negative")
+		hasBalance = false
+	}
+	hasCurrency := dec.currency("currency", &a.Currency, false)
+	// Accounts created without a currency keep the behaviour from before currencies were introduced
+	if !dec.present("currency") {
+		a.Currency = DefaultCurrency
+		hasCurrency = true
+	}
+	if hasBalance && hasCurrency {
+		err = a.Currency.ValidateAmount(a.Balance)
+		if err != nil {
+			dec.invalid("balance", err)
+		}
+	}
+	dec.field("account_type", &a.AccountType, false)
+	if a.AccountType == "" {
+		a.AccountType = DefaultAccountType
 	}
-	a.Balance = balance
+	if len(a.AccountType) > 32 {
+		dec.fail("account_type", FieldOutOfRange, "can be at most 32 characters")
+	}
+	return dec.err()
+}
 
-	// Check for extra fields
-	var temp map[string]interface{}
-	err = json.Unmarshal(data, &temp)
+// MarshalJSON formats the balances with the precision of the account currency and adds available_to_spend,
+// which is left out for accounts with an unlimited overdraft
+func (a Account) MarshalJSON() ([]byte, error) {
+	type Alias Account
+	var availableToSpend *string
+	if !a.UnlimitedOverdraft {
+		formatted := (a.AvailableBalance + a.OverdraftLimit).Format(a.Currency)
+		availableToSpend = &formatted
+	}
+	return json.Marshal(&struct {
+		Alias
+		Balance          string  `json:"balance"`
+		AvailableBalance string  `json:"available_balance"`
+		OverdraftLimit   string  `json:"overdraft_limit"`
+		AvailableToSpend *string `json:"available_to_spend,omitempty"`
+	}{
+		Alias:            Alias(a),
+		Balance:          a.Balance.Format(a.Currency),
+		AvailableBalance: a.AvailableBalance.Format(a.Currency),
+		OverdraftLimit:   a.OverdraftLimit.Format(a.Currency),
+		AvailableToSpend: availableToSpend,
+	})
+}
+
+// OverdraftSettings sets how far an account may go below zero. With Unlimited set, OverdraftLimit is ignored.
+type OverdraftSettings struct {
+	OverdraftLimit Money `json:"overdraft_limit"`
+	Unlimited      bool  `json:"unlimited_overdraft"`
+}
+
+func (o *OverdraftSettings) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
 	if err != nil {
 		return err
 	}
-	for key := range temp {
-		if key != "account_id" && key != "balance" {
-			return errors.New("extra field found")
-		}
+	if dec.field("overdraft_limit", &o.OverdraftLimit, false) && o.OverdraftLimit < 0 {
+		dec.fail("overdraft_limit", FieldOutOfRange, "cannot be negative")
 	}
-
-	return nil
+	dec.field("unlimited_overdraft", &o.Unlimited, false)
+	return dec.err()
 }
@@ -0,0 +1,56 @@
+package entities
+
+import (
+	"fmt"
+	"time"
+)
+
+const (
+	AccountStatusActive = "active"
+	// AccountStatusFrozen accounts can still receive money but cannot send any
+	AccountStatusFrozen = "frozen"
+	// AccountStatusClosed accounts can neither send nor receive money, closing is final
+	AccountStatusClosed = "closed"
+)
+
+// accountStatusTransitions lists the statuses each status can change to
+var accountStatusTransitions = map[string][]string{
+	AccountStatusActive: {AccountStatusFrozen, AccountStatusClosed},
+	AccountStatusFrozen: {AccountStatusActive},
+}
+
+// CanChangeAccountStatus reports whether an account can go from one status to the other.
+// Closing additionally requires the account to be empty, which is checked against the locked row.
+func CanChangeAccountStatus(from string, to string) bool {
+	for _, status := range accountStatusTransitions[from] {
+		if status == to {
+			return true
+		}
+	}
+	return false
+}
+
+// AccountStatusChange is a change of an account's status together with the reason for it
+type AccountStatusChange struct {
+	ID         int       `json:"id"`
+	AccountID  int       `json:"account_id"`
+	FromStatus string    `json:"from_status"`
+	Status     string    `json:"status"`
+	Reason     string    `json:"reason"`
+	CreatedAt  time.Time `json:"created_at"`
+}
+
+// UnmarshalJSON only accepts the status and the reason as input
+func (c *AccountStatusChange) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	if dec.field("status", &c.Status, true) && c.Status != AccountStatusActive && c.Status != AccountStatusFrozen && c.Status != AccountStatusClosed {
+		dec.fail("status", FieldInvalid, fmt.Sprintf("must be %q, %q or %q", AccountStatusActive, AccountStatusFrozen, AccountStatusClosed))
+	}
+	if dec.field("reason", &c.Reason, true) && (len(c.Reason) < 1 || len(c.Reason) > 255) {
+		dec.fail("reason", FieldOutOfRange, "must be between 1 and 255 characters")
+	}
+	return dec.err()
+}
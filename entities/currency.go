@@ -0,0 +1,65 @@
+package entities
+
+import (
+	"fmt"
+	"strings"
+)
+
+// Currency is an ISO 4217 alphabetic currency code such as "EUR" or "JPY"
+type Currency string
+
+// DefaultCurrency is assigned to accounts created without an explicit currency
+const DefaultCurrency Currency = "USD"
+
+// currencyMinorUnits holds the ISO 4217 minor unit (number of decimal places) of every supported currency.
+// It can never exceed MoneyScale.
+var currencyMinorUnits = map[Currency]int{
+	"AUD": 2,
+	"BHD": 3,
+	"CAD": 2,
+	"CHF": 2,
+	"CNY": 2,
+	"EUR": 2,
+	"GBP": 2,
+	"HKD": 2,
+	"IDR": 2,
+	"INR": 2,
+	"JOD": 3,
+	"JPY": 0,
+	"KRW": 0,
+	"KWD": 3,
+	"MYR": 2,
+	"NZD": 2,
+	"OMR": 3,
+	"SGD": 2,
+	"THB": 2,
+	"USD": 2,
+	"VND": 0,
+}
+
+// ParseCurrency normalises a currency code to upper case and checks that it is supported
+func ParseCurrency(code string) (Currency, error) {
+	currency := Currency(strings.ToUpper(code))
+	if _, ok := currencyMinorUnits[currency]; !ok {
+		return "", fmt.Errorf("unsupported currency %q", code)
+	}
+	return currency, nil
+}
+
+// MinorUnits returns the number of decimal places amounts in this currency may have
+func (c Currency) MinorUnits() int {
+	minorUnits, ok := currencyMinorUnits[c]
+	if !ok {
+		return MoneyScale
+	}
+	return minorUnits
+}
+
+// ValidateAmount checks that the amount does not have more decimal places than the currency allows,
+// e.g. 1.5 JPY or 1.234 EUR are rejected
+func (c Currency) ValidateAmount(m Money) error {
+	if int64(m)%pow10(MoneyScale-c.MinorUnits()) != 0 {
+		return fmt.Errorf("%w: %s amounts cannot have more than %d decimal places", ErrTooManyDecimals, c, c.MinorUnits())
+	}
+	return nil
+}
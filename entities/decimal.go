@@ -0,0 +1,115 @@
+package entities
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math/big"
+	"strconv"
+	"strings"
+)
+
+var ErrTooManyDecimals = errors.New("amount has too many decimal places")
+
+// parseDecimal parses a plain decimal string into an integer number of 10^-scale units.
+// kind is only used to describe the value in error messages.
+func parseDecimal(s string, scale int, maxIntegerDigits int, kind string) (int64, error) {
+	if s == "" {
+		return 0, fmt.Errorf("%s cannot be empty", kind)
+	}
+	negative := false
+	digits := s
+	if digits[0] == '-' || digits[0] == '+' {
+		negative = digits[0] == '-'
+		digits = digits[1:]
+	}
+	intPart, fracPart, hasPoint := strings.Cut(digits, ".")
+	if intPart == "" || (hasPoint && fracPart == "") || !isDigits(intPart) || !isDigits(fracPart) {
+		return 0, fmt.Errorf("invalid %s %q", kind, s)
+	}
+	if len(fracPart) > scale {
+		return 0, fmt.Errorf("%w: %s cannot have more than %d decimal places", ErrTooManyDecimals, kind, scale)
+	}
+	intPart = strings.TrimLeft(intPart, "0")
+	if len(intPart) > maxIntegerDigits {
+		return 0, &valueError{FieldOutOfRange, fmt.Sprintf("%s %q is too large", kind, s)}
+	}
+	fracPart += strings.Repeat("0", scale-len(fracPart))
+
+	units, err := strconv.ParseInt("0"+intPart+fracPart, 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("invalid %s %q", kind, s)
+	}
+	if negative {
+		units = -units
+	}
+	return units, nil
+}
+
+func isDigits(s string) bool {
+	for _, c := range s {
+		if c < '0' || c > '9' {
+			return false
+		}
+	}
+	return true
+}
+
+// formatDecimal formats an integer number of 10^-scale units with the given number of decimal places,
+// truncating any digits beyond them
+func formatDecimal(units *big.Int, scale int, decimals int) string {
+	sign := ""
+	value := new(big.Int).Set(units)
+	if value.Sign() < 0 {
+		sign = "-"
+		value.Neg(value)
+	}
+	value.Quo(value, big.NewInt(pow10(scale-decimals)))
+	digits := value.String()
+	if len(digits) <= decimals {
+		digits = strings.Repeat("0", decimals+1-len(digits)) + digits
+	}
+	if decimals == 0 {
+		return sign + digits
+	}
+	return sign + digits[:len(digits)-decimals] + "." + digits[len(digits)-decimals:]
+}
+
+// decimalText returns the literal text of a JSON string or number, so that decimals never go through a float64
+func decimalText(data []byte, kind string) (string, error) {
+	text := string(data)
+	if text == "null" {
+		return "", fmt.Errorf("%s cannot be null", kind)
+	}
+	if strings.HasPrefix(text, `"`) {
+		err := json.Unmarshal(data, &text)
+		if err != nil {
+			return "", err
+		}
+	} else if text == "" || (text[0] != '-' && (text[0] < '0' || text[0] > '9')) {
+		return "", &valueError{FieldWrongType, "must be a decimal string or number"}
+	}
+	return text, nil
+}
+
+// scannedDecimalText returns the text of a DECIMAL column, which the postgres driver returns as []byte
+func scannedDecimalText(src interface{}) (string, error) {
+	switch v := src.(type) {
+	case []byte:
+		return string(v), nil
+	case string:
+		return v, nil
+	case int64:
+		return strconv.FormatInt(v, 10), nil
+	default:
+		return "", fmt.Errorf("cannot scan %T into a decimal", src)
+	}
+}
+
+func pow10(n int) int64 {
+	result := int64(1)
+	for i := 0; i < n; i++ {
+		result *= 10
+	}
+	return result
+}
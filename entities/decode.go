@@ -0,0 +1,310 @@
+package entities
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"io"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Codes of a FieldError, they say what kind of problem the value has
+const (
+	FieldUnknown         = "unknown_field"
+	FieldWrongType       = "wrong_type"
+	FieldMissing         = "missing"
+	FieldOutOfRange      = "out_of_range"
+	FieldTooManyDecimals = "too_many_decimals"
+	FieldInvalid         = "invalid"
+)
+
+// FieldError is a problem with the value at Pointer, a JSON pointer (RFC 6901) into the request body.
+// Pointer is empty for a problem with the body as a whole.
+type FieldError struct {
+	Pointer string
+	Code    string
+	Message string
+	// Err is the error the problem was found from if there is one, like ErrTooManyDecimals
+	Err error
+}
+
+// ValidationError is every problem found decoding a request body, not only the first one
+type ValidationError struct {
+	Errors []FieldError
+}
+
+func (e *ValidationError) Error() string {
+	messages := make([]string, len(e.Errors))
+	for i, fieldErr := range e.Errors {
+		messages[i] = fieldErr.Message
+		if fieldErr.Pointer != "" {
+			messages[i] = fieldErr.Pointer + ": " + fieldErr.Message
+		}
+	}
+	return strings.Join(messages, "; ")
+}
+
+// Unwrap lets errors.Is find the errors the problems were found from
+func (e *ValidationError) Unwrap() []error {
+	var errs []error
+	for _, fieldErr := range e.Errors {
+		if fieldErr.Err != nil {
+			errs = append(errs, fieldErr.Err)
+		}
+	}
+	return errs
+}
+
+// valueError is a problem with a single JSON value, Code is one of the codes of FieldError
+type valueError struct {
+	code    string
+	message string
+}
+
+func (e *valueError) Error() string {
+	return e.message
+}
+
+// DecodeRequest decodes a JSON request body into v. The request types of this package decode strictly: every
+// unknown field, wrong type, missing field and invalid value is reported at once in a *ValidationError.
+// An empty body is a *ValidationError that matches io.EOF, so that handlers for which the body is optional can
+// tell it apart with errors.Is.
+func DecodeRequest(body io.Reader, v interface{}) error {
+	data, err := io.ReadAll(body)
+	if err != nil {
+		return err
+	}
+	if len(bytes.TrimSpace(data)) == 0 {
+		return &ValidationError{Errors: []FieldError{{Code: FieldMissing, Message: "request body is required", Err: io.EOF}}}
+	}
+	if !json.Valid(data) {
+		return &ValidationError{Errors: []FieldError{{Code: FieldInvalid, Message: "request body is not valid JSON"}}}
+	}
+	err = json.Unmarshal(data, v)
+	if err != nil {
+		return &ValidationError{Errors: fieldErrors("", err)}
+	}
+	return nil
+}
+
+// fieldErrors describes err, the error decoding the value at pointer. The problems of a nested object or array
+// are moved under pointer.
+func fieldErrors(pointer string, err error) []FieldError {
+	var validationErr *ValidationError
+	var valueErr *valueError
+	var typeErr *json.UnmarshalTypeError
+	switch {
+	case errors.As(err, &validationErr):
+		nested := make([]FieldError, len(validationErr.Errors))
+		for i, fieldErr := range validationErr.Errors {
+			fieldErr.Pointer = pointer + fieldErr.Pointer
+			nested[i] = fieldErr
+		}
+		return nested
+	case errors.As(err, &valueErr):
+		return []FieldError{{Pointer: pointer, Code: valueErr.code, Message: valueErr.message}}
+	case errors.As(err, &typeErr):
+		return []FieldError{typeFieldError(pointer, typeErr)}
+	case errors.Is(err, ErrTooManyDecimals):
+		return []FieldError{{Pointer: pointer, Code: FieldTooManyDecimals, Message: err.Error(), Err: err}}
+	default:
+		return []FieldError{{Pointer: pointer, Code: FieldInvalid, Message: err.Error(), Err: err}}
+	}
+}
+
+// typeFieldError describes a JSON value that does not fit the Go type it is decoded into. An integer too large
+// for its type is out of range rather than of the wrong type.
+func typeFieldError(pointer string, typeErr *json.UnmarshalTypeError) FieldError {
+	switch typeErr.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		number, isNumber := strings.CutPrefix(typeErr.Value, "number ")
+		if isNumber && !strings.ContainsAny(number, ".eE") {
+			return FieldError{Pointer: pointer, Code: FieldOutOfRange, Message: "is out of range"}
+		}
+		return FieldError{Pointer: pointer, Code: FieldWrongType, Message: "must be an integer"}
+	case reflect.Bool:
+		return FieldError{Pointer: pointer, Code: FieldWrongType, Message: "must be a boolean"}
+	case reflect.String:
+		return FieldError{Pointer: pointer, Code: FieldWrongType, Message: "must be a string"}
+	case reflect.Slice, reflect.Array:
+		return FieldError{Pointer: pointer, Code: FieldWrongType, Message: "must be an array"}
+	case reflect.Struct, reflect.Map:
+		return FieldError{Pointer: pointer, Code: FieldWrongType, Message: "must be an object"}
+	default:
+		return FieldError{Pointer: pointer, Code: FieldWrongType, Message: "cannot be a JSON " + typeErr.Value}
+	}
+}
+
+// pointerTo is the JSON pointer of the member name of an object
+func pointerTo(name string) string {
+	return "/" + strings.NewReplacer("~", "~0", "/", "~1").Replace(name)
+}
+
+// objectDecoder decodes a JSON object member by member and collects the problems of all of them, so that a client
+// learns everything wrong with its request at once. The members that are never decoded are unknown fields.
+type objectDecoder struct {
+	members map[string]json.RawMessage
+	decoded map[string]bool
+	errors  []FieldError
+}
+
+// decodeObject starts decoding data, which has to be a JSON object
+func decodeObject(data []byte) (*objectDecoder, error) {
+	var members map[string]json.RawMessage
+	err := json.Unmarshal(data, &members)
+	if err != nil || members == nil {
+		return nil, &ValidationError{Errors: []FieldError{{Code: FieldWrongType, Message: "must be an object"}}}
+	}
+	return &objectDecoder{members: members, decoded: map[string]bool{}}, nil
+}
+
+// field decodes the member name into target and reports whether it did. A missing or null member is a problem
+// only if it is required, otherwise target is left as it is.
+func (o *objectDecoder) field(name string, target interface{}, required bool) bool {
+	return o.decode(name, required, func(data []byte) error {
+		return decodeValue(data, target)
+	})
+}
+
+// arrayField decodes the member name, a JSON array, element by element, so that the problems of every element are
+// reported under its index
+func arrayField[T any](o *objectDecoder, name string, target *[]T, required bool) bool {
+	return o.decode(name, required, func(data []byte) error {
+		return decodeArray(data, target)
+	})
+}
+
+func (o *objectDecoder) decode(name string, required bool, decode func(data []byte) error) bool {
+	o.decoded[name] = true
+	if !o.present(name) {
+		if required {
+			o.fail(name, FieldMissing, "is required")
+		}
+		return false
+	}
+	err := decode(o.members[name])
+	if err != nil {
+		o.invalid(name, err)
+		return false
+	}
+	return true
+}
+
+// positive decodes the member name, an ID or a count, which has to be greater than zero
+func (o *objectDecoder) positive(name string, target *int, required bool) bool {
+	if !o.field(name, target, required) {
+		return false
+	}
+	if *target < 1 {
+		o.fail(name, FieldOutOfRange, "must be greater than zero")
+		return false
+	}
+	return true
+}
+
+// money decodes the member name, an amount, with the member named in the messages of its problems
+func (o *objectDecoder) money(name string, target *Money, required bool) bool {
+	return o.decode(name, required, func(data []byte) error {
+		return target.unmarshal(data, name)
+	})
+}
+
+// currency decodes the member name, a currency code, and normalises it
+func (o *objectDecoder) currency(name string, target *Currency, required bool) bool {
+	if !o.field(name, target, required) {
+		return false
+	}
+	currency, err := ParseCurrency(string(*target))
+	if err != nil {
+		o.invalid(name, err)
+		return false
+	}
+	*target = currency
+	return true
+}
+
+// fail records a problem with the member name
+func (o *objectDecoder) fail(name string, code string, message string) {
+	o.failAt(pointerTo(name), code, message)
+}
+
+// failAt records a problem with the value at pointer, relative to the object, for values nested in a member
+func (o *objectDecoder) failAt(pointer string, code string, message string) {
+	o.errors = append(o.errors, FieldError{Pointer: pointer, Code: code, Message: message})
+}
+
+// invalid records err as the problem with the member name
+func (o *objectDecoder) invalid(name string, err error) {
+	o.invalidAt(pointerTo(name), err)
+}
+
+// invalidAt records err as the problem with the value at pointer, relative to the object
+func (o *objectDecoder) invalidAt(pointer string, err error) {
+	o.errors = append(o.errors, fieldErrors(pointer, err)...)
+}
+
+// present reports whether the member name was given a value
+func (o *objectDecoder) present(name string) bool {
+	data, ok := o.members[name]
+	return ok && string(data) != "null"
+}
+
+// err finishes decoding and returns every problem found, nil if there is none
+func (o *objectDecoder) err() error {
+	var unknown []string
+	for name := range o.members {
+		if !o.decoded[name] {
+			unknown = append(unknown, name)
+		}
+	}
+	sort.Strings(unknown)
+	for _, name := range unknown {
+		o.fail(name, FieldUnknown, "is not a known field")
+	}
+	if len(o.errors) == 0 {
+		return nil
+	}
+	return &ValidationError{Errors: o.errors}
+}
+
+// decodeValue decodes a single JSON value. Timestamps get their own messages, the ones of time.Time are about
+// Go rather than the request.
+func decodeValue(data []byte, target interface{}) error {
+	switch target.(type) {
+	case *time.Time, **time.Time:
+		if data[0] != '"' {
+			return &valueError{FieldWrongType, "must be an RFC 3339 timestamp string"}
+		}
+		if json.Unmarshal(data, target) != nil {
+			return &valueError{FieldInvalid, "must be an RFC 3339 timestamp"}
+		}
+		return nil
+	}
+	return json.Unmarshal(data, target)
+}
+
+// decodeArray decodes a JSON array element by element and collects the problems of all of them
+func decodeArray[T any](data []byte, target *[]T) error {
+	var elements []json.RawMessage
+	err := json.Unmarshal(data, &elements)
+	if err != nil || elements == nil {
+		return &ValidationError{Errors: []FieldError{{Code: FieldWrongType, Message: "must be an array"}}}
+	}
+	decoded := make([]T, len(elements))
+	var errs []FieldError
+	for i, element := range elements {
+		err = decodeValue(element, &decoded[i])
+		if err != nil {
+			errs = append(errs, fieldErrors("/"+strconv.Itoa(i), err)...)
+		}
+	}
+	if len(errs) > 0 {
+		return &ValidationError{Errors: errs}
+	}
+	*target = decoded
+	return nil
+}
@@ -0,0 +1,111 @@
+package entities
+
+import (
+	"github.com/stretchr/testify/assert"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestDecodeRequest(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []FieldError
+	}{
+		{"valid", `{"source_account_id": 1, "destination_account_id": 2, "amount": "1.50"}`, nil},
+		{"empty", ` `, []FieldError{{Pointer: "", Code: FieldMissing}}},
+		{"not json", `{"source_account_id": 1,`, []FieldError{{Pointer: "", Code: FieldInvalid}}},
+		{"not an object", `[1, 2]`, []FieldError{{Pointer: "", Code: FieldWrongType}}},
+		{"unknown field", `{"source_account_id": 1, "destination_account_id": 2, "amount": "1", "memo": "rent"}`, []FieldError{{Pointer: "/memo", Code: FieldUnknown}}},
+		{"wrong type", `{"source_account_id": "1", "destination_account_id": 2, "amount": "1"}`, []FieldError{{Pointer: "/source_account_id", Code: FieldWrongType}}},
+		{"missing", `{"source_account_id": 1, "destination_account_id": null}`, []FieldError{{Pointer: "/destination_account_id", Code: FieldMissing}, {Pointer: "/amount", Code: FieldMissing}}},
+		{"out of range", `{"source_account_id": 0, "destination_account_id": 99999999999999999999, "amount": "-1"}`, []FieldError{{Pointer: "/source_account_id", Code: FieldOutOfRange}, {Pointer: "/destination_account_id", Code: FieldOutOfRange}, {Pointer: "/amount", Code: FieldOutOfRange}}},
+		{"too many decimals", `{"source_account_id": 1, "destination_account_id": 2, "amount": "0.0001"}`, []FieldError{{Pointer: "/amount", Code: FieldTooManyDecimals}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var tx Transaction
+			err := DecodeRequest(strings.NewReader(tt.input), &tx)
+			assert.Equal(t, tt.expected, fieldCodes(err))
+		})
+	}
+
+	// Handlers for which the body is optional tell an empty one apart by io.EOF
+	var tx Transaction
+	err := DecodeRequest(strings.NewReader(""), &tx)
+	assert.ErrorIs(t, err, io.EOF)
+	err = DecodeRequest(strings.NewReader("{}"), &tx)
+	assert.NotErrorIs(t, err, io.EOF)
+}
+
+func TestDecodeRequestNested(t *testing.T) {
+	var batch TransactionBatch
+	err := DecodeRequest(strings.NewReader(`{"transactions": [
+		{"source_account_id": 1, "destination_account_id": 2, "amount": "1"},
+		{"source_account_id": 1, "destination_account_id": 2, "amount": true},
+		{"source_account_id": 1, "destination_account_id": 2, "amount": "1", "a/b": 1}
+	]}`), &batch)
+	assert.Equal(t, []FieldError{
+		{Pointer: "/transactions/1/amount", Code: FieldWrongType},
+		{Pointer: "/transactions/2/a~1b", Code: FieldUnknown},
+	}, fieldCodes(err))
+
+	err = DecodeRequest(strings.NewReader(`{"transactions": []}`), &batch)
+	assert.Equal(t, []FieldError{{Pointer: "/transactions", Code: FieldOutOfRange}}, fieldCodes(err))
+
+	var schedule FeeSchedule
+	err = DecodeRequest(strings.NewReader(`{"currency": "EUR", "revenue_account_id": 99, "tiers": [{"up_to": "10", "flat": "1", "percentage": "0"}, {"up_to": "5", "flat": "1", "percentage": "0"}]}`), &schedule)
+	codes := fieldCodes(err)
+	if assert.NotEmpty(t, codes) {
+		assert.Equal(t, "/tiers/1/up_to", codes[0].Pointer)
+	}
+}
+
+func TestDecodeAccount(t *testing.T) {
+	tests := []struct {
+		name     string
+		input    string
+		expected []FieldError
+	}{
+		{"valid", `{"account_id": 1, "balance": "100.5", "currency": "eur"}`, nil},
+		{"default currency", `{"account_id": 1, "balance": "100"}`, nil},
+		{"negative balance", `{"account_id": 1, "balance": "-1"}`, []FieldError{{Pointer: "/balance", Code: FieldOutOfRange}}},
+		{"invalid currency", `{"account_id": 1, "balance": "1.5", "currency": "XXX"}`, []FieldError{{Pointer: "/currency", Code: FieldInvalid}}},
+		{"too many decimals for the currency", `{"account_id": 1, "balance": "1.5", "currency": "JPY"}`, []FieldError{{Pointer: "/balance", Code: FieldTooManyDecimals}}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var account Account
+			err := DecodeRequest(strings.NewReader(tt.input), &account)
+			assert.Equal(t, tt.expected, fieldCodes(err))
+		})
+	}
+
+	var account Account
+	err := DecodeRequest(strings.NewReader(`{"account_id": 1, "balance": "1.2345"}`), &account)
+	assert.ErrorContains(t, err, "balance cannot have more than 3 decimal places")
+	err = DecodeRequest(strings.NewReader(`{"account_id": 1, "balance": "12a"}`), &account)
+	assert.ErrorContains(t, err, `invalid balance "12a"`)
+	err = DecodeRequest(strings.NewReader(`{"account_id": 1, "balance": "100", "currency": "eur"}`), &account)
+	assert.NoError(t, err)
+	assert.Equal(t, Currency("EUR"), account.Currency)
+}
+
+// fieldCodes keeps only the pointers and codes of the problems of err, the messages are free to change
+func fieldCodes(err error) []FieldError {
+	if err == nil {
+		return nil
+	}
+	validationErr, ok := err.(*ValidationError)
+	if !ok {
+		return []FieldError{{Message: err.Error()}}
+	}
+	codes := make([]FieldError, len(validationErr.Errors))
+	for i, fieldErr := range validationErr.Errors {
+		codes[i] = FieldError{Pointer: fieldErr.Pointer, Code: fieldErr.Code}
+	}
+	return codes
+}
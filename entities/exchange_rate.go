@@ -0,0 +1,129 @@
+package entities
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"time"
+)
+
+// RateScale is the number of decimal places an exchange Rate carries
+const RateScale = 10
+
+// rateMaxIntegerDigits matches the DECIMAL(18, 10) rate column in db/migrations
+const rateMaxIntegerDigits = 18 - RateScale
+
+// RemainderScale is the number of decimal places of a conversion remainder, the exact product of an amount and a rate
+const RemainderScale = MoneyScale + RateScale
+
+// Rate is the exact number of quote currency units that one unit of the base currency buys,
+// stored as an integer number of 10^-RateScale units
+type Rate int64
+
+// ExchangeRate is the rate from BaseCurrency to QuoteCurrency that applies from EffectiveAt onwards,
+// until a rate with a later EffectiveAt takes over
+type ExchangeRate struct {
+	BaseCurrency  Currency  `json:"base_currency"`
+	QuoteCurrency Currency  `json:"quote_currency"`
+	Rate          Rate      `json:"rate"`
+	EffectiveAt   time.Time `json:"effective_at"`
+}
+
+func ParseRate(s string) (Rate, error) {
+	units, err := parseDecimal(s, RateScale, rateMaxIntegerDigits, "rate")
+	if err != nil {
+		return 0, err
+	}
+	return Rate(units), nil
+}
+
+func (r Rate) String() string {
+	return formatDecimal(big.NewInt(int64(r)), RateScale, RateScale)
+}
+
+// Convert converts an amount of the base currency into the quote currency.
+// The result is rounded down to the minor unit of the quote currency, and whatever was rounded off is returned
+// as a remainder with RemainderScale decimal places so that it can be accounted for.
+func (r Rate) Convert(amount Money, to Currency) (Money, string, error) {
+	exact := new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(int64(r)))
+	// One minor unit of the quote currency, expressed in 10^-RemainderScale units
+	quantum := big.NewInt(pow10(RemainderScale - to.MinorUnits()))
+	minorUnits, remainder := new(big.Int).QuoRem(exact, quantum, new(big.Int))
+
+	converted := new(big.Int).Mul(minorUnits, big.NewInt(pow10(MoneyScale-to.MinorUnits())))
+	if converted.CmpAbs(big.NewInt(pow10(moneyMaxIntegerDigits+MoneyScale))) >= 0 {
+		return 0, "", errors.New("converted amount is too large")
+	}
+	return Money(converted.Int64()), formatDecimal(remainder, RemainderScale, RemainderScale), nil
+}
+
+func (r Rate) MarshalJSON() ([]byte, error) {
+	return json.Marshal(r.String())
+}
+
+// UnmarshalJSON accepts both "1.0845" and 1.0845
+func (r *Rate) UnmarshalJSON(data []byte) error {
+	text, err := decimalText(data, "rate")
+	if err != nil {
+		return err
+	}
+	parsed, err := ParseRate(text)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Scan reads a DECIMAL column
+func (r *Rate) Scan(src interface{}) error {
+	text, err := scannedDecimalText(src)
+	if err != nil {
+		return err
+	}
+	parsed, err := ParseRate(text)
+	if err != nil {
+		return err
+	}
+	*r = parsed
+	return nil
+}
+
+// Value sends the rate to the database as exact decimal text
+func (r Rate) Value() (driver.Value, error) {
+	return r.String(), nil
+}
+
+func (e *ExchangeRate) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	hasBase := dec.currency("base_currency", &e.BaseCurrency, true)
+	hasQuote := dec.currency("quote_currency", &e.QuoteCurrency, true)
+	if hasBase && hasQuote && e.BaseCurrency == e.QuoteCurrency {
+		dec.fail("quote_currency", FieldInvalid, "must be different from base_currency")
+	}
+	if dec.field("rate", &e.Rate, true) && e.Rate <= 0 {
+		dec.fail("rate", FieldOutOfRange, "must be greater than zero")
+	}
+	dec.field("effective_at", &e.EffectiveAt, false)
+	return dec.err()
+}
+
+// ExchangeRates is an upload of exchange rates, which are stored all or none
+type ExchangeRates []ExchangeRate
+
+func (r *ExchangeRates) UnmarshalJSON(data []byte) error {
+	var rates []ExchangeRate
+	err := decodeArray(data, &rates)
+	if err != nil {
+		return err
+	}
+	if len(rates) == 0 {
+		return &ValidationError{Errors: []FieldError{{Code: FieldOutOfRange, Message: "at least one exchange rate is required"}}}
+	}
+	*r = rates
+	return nil
+}
@@ -0,0 +1,38 @@
+package entities
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestRateConvert(t *testing.T) {
+	tests := []struct {
+		name              string
+		amount            string
+		rate              string
+		to                Currency
+		expected          string
+		expectedRemainder string
+	}{
+		{"Converts exactly", "100", "1.5", "USD", "150", "0.0000000000000"},
+		{"Rounds down to cents", "10.01", "1.0845", "USD", "10.85", "0.0058450000000"},
+		{"Rounds down to whole yen", "12.34", "161.2345678901", "JPY", "1989", "0.6345677638340"},
+		{"Keeps three decimals for KWD", "1", "0.3071234567", "KWD", "0.307", "0.0001234567000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			amount, err := ParseMoney(tt.amount)
+			assert.NoError(t, err)
+			rate, err := ParseRate(tt.rate)
+			assert.NoError(t, err)
+			expected, err := ParseMoney(tt.expected)
+			assert.NoError(t, err)
+
+			converted, remainder, err := rate.Convert(amount, tt.to)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, converted)
+			assert.Equal(t, tt.expectedRemainder, remainder)
+		})
+	}
+}
@@ -0,0 +1,215 @@
+package entities
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"errors"
+	"math/big"
+	"strconv"
+)
+
+// FeeTier prices transfers of up to UpTo, or of any amount if UpTo is nil. Percentage is a fraction of the
+// amount, "0.015" is 1.5%.
+type FeeTier struct {
+	UpTo       *Money `json:"up_to"`
+	Flat       Money  `json:"flat"`
+	Percentage Rate   `json:"percentage"`
+}
+
+// FeeTiers is stored as a JSONB column
+type FeeTiers []FeeTier
+
+// Scan reads the JSONB tiers column
+func (t *FeeTiers) Scan(src interface{}) error {
+	data, ok := src.([]byte)
+	if !ok {
+		return errors.New("fee tiers must be JSON")
+	}
+	return json.Unmarshal(data, t)
+}
+
+// Value stores the tiers as JSON
+func (t FeeTiers) Value() (driver.Value, error) {
+	data, err := json.Marshal(t)
+	return string(data), err
+}
+
+// FeeSchedule is the fee charged on transfers out of accounts of AccountType in Currency, or out of any account
+// in Currency if AccountType is nil. The fee is paid to RevenueAccountID.
+// The whole amount is priced by the first tier it fits in, and the fee is then kept between MinFee and MaxFee.
+type FeeSchedule struct {
+	FeeScheduleID    int      `json:"fee_schedule_id"`
+	AccountType      *string  `json:"account_type"`
+	Currency         Currency `json:"currency"`
+	RevenueAccountID int      `json:"revenue_account_id"`
+	Tiers            FeeTiers `json:"tiers"`
+	MinFee           *Money   `json:"min_fee"`
+	MaxFee           *Money   `json:"max_fee"`
+}
+
+func (s *FeeSchedule) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	dec.field("account_type", &s.AccountType, false)
+	hasCurrency := dec.currency("currency", &s.Currency, true)
+	dec.positive("revenue_account_id", &s.RevenueAccountID, true)
+	hasTiers := arrayField(dec, "tiers", (*[]FeeTier)(&s.Tiers), true)
+	if hasTiers && len(s.Tiers) == 0 {
+		dec.fail("tiers", FieldOutOfRange, "a fee schedule needs at least one tier")
+	}
+	hasMinFee := dec.field("min_fee", &s.MinFee, false)
+	if hasMinFee && *s.MinFee < 0 {
+		dec.fail("min_fee", FieldOutOfRange, "cannot be negative")
+		hasMinFee = false
+	}
+	hasMaxFee := dec.field("max_fee", &s.MaxFee, false)
+	if hasMaxFee && *s.MaxFee < 0 {
+		dec.fail("max_fee", FieldOutOfRange, "cannot be negative")
+		hasMaxFee = false
+	}
+	if hasMinFee && hasMaxFee && *s.MinFee > *s.MaxFee {
+		dec.fail("min_fee", FieldOutOfRange, "cannot be greater than max_fee")
+	}
+
+	// Every amount has to fit the currency, they are listed by their pointer
+	type amount struct {
+		pointer string
+		value   *Money
+	}
+	var amounts []amount
+	if hasMinFee {
+		amounts = append(amounts, amount{pointerTo("min_fee"), s.MinFee})
+	}
+	if hasMaxFee {
+		amounts = append(amounts, amount{pointerTo("max_fee"), s.MaxFee})
+	}
+	if hasTiers {
+		var previous *Money
+		for i := range s.Tiers {
+			tier := pointerTo("tiers") + "/" + strconv.Itoa(i)
+			upTo := s.Tiers[i].UpTo
+			if upTo == nil && i != len(s.Tiers)-1 {
+				dec.failAt(tier+"/up_to", FieldInvalid, "only the last tier can be unbounded")
+			}
+			if upTo != nil && previous != nil && *upTo <= *previous {
+				dec.failAt(tier+"/up_to", FieldInvalid, "tiers must be in increasing order of up_to")
+			}
+			previous = upTo
+			if upTo != nil {
+				amounts = append(amounts, amount{tier + "/up_to", upTo})
+			}
+			amounts = append(amounts, amount{tier + "/flat", &s.Tiers[i].Flat})
+		}
+	}
+	for _, amount := range amounts {
+		if !hasCurrency {
+			break
+		}
+		err = s.Currency.ValidateAmount(*amount.value)
+		if err != nil {
+			dec.invalidAt(amount.pointer, err)
+		}
+	}
+	return dec.err()
+}
+
+func (t *FeeTier) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	dec.field("up_to", &t.UpTo, false)
+	if dec.field("flat", &t.Flat, true) && t.Flat < 0 {
+		dec.fail("flat", FieldOutOfRange, "cannot be negative")
+	}
+	if dec.field("percentage", &t.Percentage, true) && t.Percentage < 0 {
+		dec.fail("percentage", FieldOutOfRange, "cannot be negative")
+	}
+	return dec.err()
+}
+
+// Fee is the fee charged on a transfer and how it was worked out, all amounts are in Currency
+type Fee struct {
+	Amount           Money    `json:"amount"`
+	Currency         Currency `json:"currency"`
+	RevenueAccountID int      `json:"revenue_account_id"`
+	FeeScheduleID    int      `json:"fee_schedule_id"`
+	Tier             int      `json:"tier"`
+	Flat             Money    `json:"flat"`
+	Percentage       Rate     `json:"percentage"`
+	PercentageAmount Money    `json:"percentage_amount"`
+	MinFeeApplied    bool     `json:"min_fee_applied"`
+	MaxFeeApplied    bool     `json:"max_fee_applied"`
+}
+
+// Compute works out the fee on a transfer of amount. The percentage part is rounded half up to the minor unit
+// of the currency.
+func (s FeeSchedule) Compute(amount Money) Fee {
+	tier := len(s.Tiers) - 1
+	for i, t := range s.Tiers {
+		if t.UpTo == nil || amount <= *t.UpTo {
+			tier = i
+			break
+		}
+	}
+
+	exact := new(big.Int).Mul(big.NewInt(int64(amount)), big.NewInt(int64(s.Tiers[tier].Percentage)))
+	// One minor unit of the currency, expressed in 10^-RemainderScale units
+	quantum := big.NewInt(pow10(RemainderScale - s.Currency.MinorUnits()))
+	exact.Add(exact, new(big.Int).Quo(quantum, big.NewInt(2)))
+	minorUnits := new(big.Int).Quo(exact, quantum)
+	percentageAmount := Money(minorUnits.Int64() * pow10(MoneyScale-s.Currency.MinorUnits()))
+
+	fee := Fee{
+		Currency:         s.Currency,
+		RevenueAccountID: s.RevenueAccountID,
+		FeeScheduleID:    s.FeeScheduleID,
+		Tier:             tier,
+		Flat:             s.Tiers[tier].Flat,
+		Percentage:       s.Tiers[tier].Percentage,
+		PercentageAmount: percentageAmount,
+	}
+	fee.Amount = fee.Flat + fee.PercentageAmount
+	if s.MinFee != nil && fee.Amount < *s.MinFee {
+		fee.Amount = *s.MinFee
+		fee.MinFeeApplied = true
+	}
+	if s.MaxFee != nil && fee.Amount > *s.MaxFee {
+		fee.Amount = *s.MaxFee
+		fee.MaxFeeApplied = true
+	}
+	return fee
+}
+
+// MarshalJSON formats every amount with the precision of the currency
+func (f Fee) MarshalJSON() ([]byte, error) {
+	type Alias Fee
+	return json.Marshal(&struct {
+		Alias
+		Amount           string `json:"amount"`
+		Flat             string `json:"flat"`
+		PercentageAmount string `json:"percentage_amount"`
+	}{
+		Alias:            Alias(f),
+		Amount:           f.Amount.Format(f.Currency),
+		Flat:             f.Flat.Format(f.Currency),
+		PercentageAmount: f.PercentageAmount.Format(f.Currency),
+	})
+}
+
+// Scan reads the JSONB fee_breakdown column
+func (f *Fee) Scan(src interface{}) error {
+	data, ok := src.([]byte)
+	if !ok {
+		return errors.New("fee breakdown must be JSON")
+	}
+	return json.Unmarshal(data, f)
+}
+
+// Value stores the fee as JSON
+func (f Fee) Value() (driver.Value, error) {
+	data, err := json.Marshal(f)
+	return string(data), err
+}
@@ -0,0 +1,56 @@
+package entities
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestFeeScheduleCompute(t *testing.T) {
+	var schedule FeeSchedule
+	err := json.Unmarshal([]byte(`{
+		"currency": "EUR",
+		"revenue_account_id": 99,
+		"tiers": [
+			{"up_to": "100", "flat": "0.50", "percentage": "0"},
+			{"up_to": "1000", "flat": "0", "percentage": "0.015"},
+			{"up_to": null, "flat": "0", "percentage": "0.01"}
+		],
+		"min_fee": "1.00",
+		"max_fee": "25"
+	}`), &schedule)
+	assert.NoError(t, err)
+
+	tests := []struct {
+		amount        string
+		expectedFee   string
+		expectedTier  int
+		minFeeApplied bool
+		maxFeeApplied bool
+	}{
+		{"50", "1.00", 0, true, false},
+		{"100", "1.00", 0, true, false},
+		// 1.5% of 333.33 is 4.99995, rounded half up to the cent
+		{"333.33", "5.00", 1, false, false},
+		{"2000", "20.00", 2, false, false},
+		{"5000", "25.00", 2, false, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.amount, func(t *testing.T) {
+			amount, err := ParseMoney(tt.amount)
+			assert.NoError(t, err)
+			fee := schedule.Compute(amount)
+			expected, err := ParseMoney(tt.expectedFee)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, fee.Amount)
+			assert.Equal(t, tt.expectedTier, fee.Tier)
+			assert.Equal(t, tt.minFeeApplied, fee.MinFeeApplied)
+			assert.Equal(t, tt.maxFeeApplied, fee.MaxFeeApplied)
+		})
+	}
+
+	err = json.Unmarshal([]byte(`{"currency": "EUR", "revenue_account_id": 99, "tiers": [{"up_to": null, "flat": "0.001", "percentage": "0"}]}`), &schedule)
+	assert.ErrorIs(t, err, ErrTooManyDecimals)
+	err = json.Unmarshal([]byte(`{"currency": "EUR", "revenue_account_id": 99, "tiers": [{"up_to": null, "flat": "1", "percentage": "0"}, {"up_to": "10", "flat": "1", "percentage": "0"}]}`), &schedule)
+	assert.Error(t, err)
+}
@@ -0,0 +1,100 @@
+package entities
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	HoldStatusActive   = "active"
+	HoldStatusCaptured = "captured"
+	HoldStatusVoided   = "voided"
+	HoldStatusExpired  = "expired"
+)
+
+// DefaultHoldTTL is how long a hold reserves funds when the request does not say
+const DefaultHoldTTL = 7 * 24 * time.Hour
+
+// MaxHoldTTL is the longest a hold may reserve funds for
+const MaxHoldTTL = 30 * 24 * time.Hour
+
+// HoldRequest reserves Amount on the source account for a later transfer to the destination account
+type HoldRequest struct {
+	SourceAccountID      int   `json:"source_account_id"`
+	DestinationAccountID int   `json:"destination_account_id"`
+	Amount               Money `json:"amount"`
+	TTLSeconds           int   `json:"ttl_seconds"`
+}
+
+func (h *HoldRequest) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	decodeTransfer(dec, &h.SourceAccountID, &h.DestinationAccountID, &h.Amount, nil)
+	if dec.field("ttl_seconds", &h.TTLSeconds, false) && (h.TTLSeconds < 1 || h.TTL() > MaxHoldTTL) {
+		dec.fail("ttl_seconds", FieldOutOfRange, fmt.Sprintf("must be between 1 and %d", int(MaxHoldTTL.Seconds())))
+	}
+	return dec.err()
+}
+
+// TTL returns the requested time to live, or DefaultHoldTTL if none was given
+func (h HoldRequest) TTL() time.Duration {
+	if h.TTLSeconds == 0 {
+		return DefaultHoldTTL
+	}
+	return time.Duration(h.TTLSeconds) * time.Second
+}
+
+// CaptureRequest captures a hold. A nil Amount captures the full held amount, a smaller one captures
+// part of it and releases the rest.
+type CaptureRequest struct {
+	Amount *Money `json:"amount"`
+}
+
+func (c *CaptureRequest) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	if dec.field("amount", &c.Amount, false) && *c.Amount <= 0 {
+		dec.fail("amount", FieldOutOfRange, "must be greater than zero")
+	}
+	return dec.err()
+}
+
+// Hold is funds reserved on the source account. Once captured, TransactionID is the transfer it became.
+type Hold struct {
+	HoldID               int       `json:"hold_id"`
+	SourceAccountID      int       `json:"source_account_id"`
+	DestinationAccountID int       `json:"destination_account_id"`
+	Amount               Money     `json:"amount"`
+	CapturedAmount       Money     `json:"captured_amount"`
+	Currency             Currency  `json:"currency"`
+	Status               string    `json:"status"`
+	TransactionID        *int      `json:"transaction_id,omitempty"`
+	ExpiresAt            time.Time `json:"expires_at"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+// Location is the URL the hold can be fetched from
+func (h Hold) Location() string {
+	return "/holds/" + strconv.Itoa(h.HoldID)
+}
+
+// MarshalJSON formats the amounts with the precision of the currency
+func (h Hold) MarshalJSON() ([]byte, error) {
+	type Alias Hold
+	return json.Marshal(&struct {
+		Alias
+		Amount         string `json:"amount"`
+		CapturedAmount string `json:"captured_amount"`
+	}{
+		Alias:          Alias(h),
+		Amount:         h.Amount.Format(h.Currency),
+		CapturedAmount: h.CapturedAmount.Format(h.Currency),
+	})
+}
@@ -0,0 +1,32 @@
+package entities
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"time"
+)
+
+// IdempotencyKey is a client supplied key together with the request it was first used for
+// and the response that request produced
+type IdempotencyKey struct {
+	Key            string
+	Scope          string
+	Fingerprint    string
+	ResponseStatus int
+	ResponseBody   []byte
+	// ResponseLocation is the Location header of the response, empty if it had none
+	ResponseLocation string
+	CreatedAt        time.Time
+}
+
+// RequestFingerprint hashes the decoded request so that the same request sent with different
+// whitespace or field order still matches
+func RequestFingerprint(request interface{}) (string, error) {
+	canonical, err := json.Marshal(request)
+	if err != nil {
+		return "", err
+	}
+	sum := sha256.Sum256(canonical)
+	return hex.EncodeToString(sum[:]), nil
+}
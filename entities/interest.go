@@ -0,0 +1,86 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+	"time"
+)
+
+// InterestDaysPerYear is the day count convention of interest accrual, a day earns AnnualRate / 365
+const InterestDaysPerYear = 365
+
+// InterestRate makes an account earn interest at AnnualRate on its end-of-day balance, paid monthly from
+// ExpenseAccountID. AnnualRate is a fraction, "0.035" is 3.5% a year.
+type InterestRate struct {
+	AccountID        int  `json:"account_id"`
+	AnnualRate       Rate `json:"annual_rate"`
+	ExpenseAccountID int  `json:"expense_account_id"`
+}
+
+// UnmarshalJSON does not accept the account, it comes from the URL
+func (i *InterestRate) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	if dec.field("annual_rate", &i.AnnualRate, true) && i.AnnualRate < 0 {
+		dec.fail("annual_rate", FieldOutOfRange, "cannot be negative")
+	}
+	dec.positive("expense_account_id", &i.ExpenseAccountID, true)
+	return dec.err()
+}
+
+// DailyInterest returns the exact interest the balance earns in one day, with RemainderScale decimal places.
+// Only positive balances earn interest, and digits beyond RemainderScale are truncated.
+func (i InterestRate) DailyInterest(balance Money) string {
+	if balance <= 0 {
+		return formatDecimal(new(big.Int), RemainderScale, RemainderScale)
+	}
+	exact := new(big.Int).Mul(big.NewInt(int64(balance)), big.NewInt(int64(i.AnnualRate)))
+	exact.Quo(exact, big.NewInt(InterestDaysPerYear))
+	return formatDecimal(exact, RemainderScale, RemainderScale)
+}
+
+// RoundInterest rounds the sum of accruals, a decimal with at most RemainderScale decimal places, down to the
+// minor unit of the currency. It returns the amount to pay and what was rounded off.
+func RoundInterest(total string, currency Currency) (Money, string, error) {
+	exact, err := parseExactDecimal(total, RemainderScale)
+	if err != nil {
+		return 0, "", err
+	}
+	quantum := big.NewInt(pow10(RemainderScale - currency.MinorUnits()))
+	minorUnits, remainder := new(big.Int).QuoRem(exact, quantum, new(big.Int))
+
+	rounded := new(big.Int).Mul(minorUnits, big.NewInt(pow10(MoneyScale-currency.MinorUnits())))
+	if !rounded.IsInt64() || rounded.CmpAbs(big.NewInt(pow10(moneyMaxIntegerDigits+MoneyScale))) >= 0 {
+		return 0, "", errors.New("interest amount is too large")
+	}
+	return Money(rounded.Int64()), formatDecimal(remainder, RemainderScale, RemainderScale), nil
+}
+
+// parseExactDecimal parses a plain decimal string with at most scale decimal places into an integer number of
+// 10^-scale units, without the int64 bound of parseDecimal
+func parseExactDecimal(s string, scale int) (*big.Int, error) {
+	intPart, fracPart, _ := strings.Cut(s, ".")
+	if len(fracPart) > scale {
+		return nil, fmt.Errorf("%w: cannot have more than %d decimal places", ErrTooManyDecimals, scale)
+	}
+	units, ok := new(big.Int).SetString(intPart+fracPart+strings.Repeat("0", scale-len(fracPart)), 10)
+	if !ok {
+		return nil, fmt.Errorf("invalid decimal %q", s)
+	}
+	return units, nil
+}
+
+// InterestAccrual is the interest an account earned on one day. Amount is exact, with RemainderScale decimal
+// places, and is only rounded to the currency once the accruals of a month are posted as TransactionID.
+type InterestAccrual struct {
+	AccountID     int       `json:"account_id"`
+	AccrualDate   time.Time `json:"accrual_date"`
+	Balance       Money     `json:"balance"`
+	AnnualRate    Rate      `json:"annual_rate"`
+	Amount        string    `json:"amount"`
+	TransactionID *int      `json:"transaction_id"`
+}
@@ -0,0 +1,56 @@
+package entities
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestDailyInterest(t *testing.T) {
+	tests := []struct {
+		name     string
+		balance  string
+		rate     string
+		expected string
+	}{
+		{"Earns exactly", "1000", "0.0365", "0.1000000000000"},
+		{"Truncates beyond the remainder scale", "100", "0.05", "0.0136986301369"},
+		{"Negative balances earn nothing", "-50", "0.05", "0.0000000000000"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			balance, err := ParseMoney(tt.balance)
+			assert.NoError(t, err)
+			rate, err := ParseRate(tt.rate)
+			assert.NoError(t, err)
+
+			assert.Equal(t, tt.expected, InterestRate{AnnualRate: rate}.DailyInterest(balance))
+		})
+	}
+}
+
+func TestRoundInterest(t *testing.T) {
+	tests := []struct {
+		name              string
+		total             string
+		currency          Currency
+		expected          string
+		expectedRemainder string
+	}{
+		{"Rounds down to cents", "0.4109589041070", "USD", "0.41", "0.0009589041070"},
+		{"Rounds down to whole yen", "12.5", "JPY", "12", "0.5000000000000"},
+		{"Rounds a total below one cent to zero", "0.0099999999999", "USD", "0", "0.0099999999999"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			expected, err := ParseMoney(tt.expected)
+			assert.NoError(t, err)
+
+			rounded, remainder, err := RoundInterest(tt.total, tt.currency)
+			assert.NoError(t, err)
+			assert.Equal(t, expected, rounded)
+			assert.Equal(t, tt.expectedRemainder, remainder)
+		})
+	}
+}
@@ -0,0 +1,73 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"time"
+)
+
+// System accounts are ledger accounts that are not customer accounts, so they have no row in account_balance
+const (
+	// SystemAccountOpeningBalance funds the initial balance accounts are created with
+	SystemAccountOpeningBalance = "opening_balance"
+	// systemAccountFXPositionPrefix is followed by a currency code, e.g. "fx_position:EUR"
+	systemAccountFXPositionPrefix = "fx_position:"
+)
+
+// FXPositionAccount is the system account that holds the bank's position in a currency.
+// A cross-currency transfer moves money into the position of the source currency and out of the
+// position of the destination currency, so that every currency balances on its own.
+func FXPositionAccount(currency Currency) string {
+	return systemAccountFXPositionPrefix + string(currency)
+}
+
+// Posting is one leg of a journal entry. A positive amount credits the account (its balance goes up)
+// and a negative amount debits it. Exactly one of AccountID and SystemAccount is set.
+type Posting struct {
+	AccountID     *int     `json:"account_id,omitempty"`
+	SystemAccount string   `json:"system_account,omitempty"`
+	Amount        Money    `json:"amount"`
+	Currency      Currency `json:"currency"`
+}
+
+// JournalEntry is a set of postings that sum to zero in every currency.
+// TransactionID links the entry to the row in account_transactions it records, if any.
+type JournalEntry struct {
+	JournalEntryID int       `json:"journal_entry_id"`
+	TransactionID  *int      `json:"transaction_id,omitempty"`
+	Description    string    `json:"description"`
+	Postings       []Posting `json:"postings"`
+	CreatedAt      time.Time `json:"created_at"`
+}
+
+func AccountPosting(accountID int, amount Money, currency Currency) Posting {
+	return Posting{AccountID: &accountID, Amount: amount, Currency: currency}
+}
+
+func SystemPosting(systemAccount string, amount Money, currency Currency) Posting {
+	return Posting{SystemAccount: systemAccount, Amount: amount, Currency: currency}
+}
+
+// Validate checks the double-entry invariant before anything is written,
+// the same invariant is enforced again by a constraint trigger in db/migrations
+func (e JournalEntry) Validate() error {
+	if len(e.Postings) < 2 {
+		return errors.New("journal entry needs at least two postings")
+	}
+	totals := map[Currency]Money{}
+	for _, posting := range e.Postings {
+		if (posting.AccountID == nil) == (posting.SystemAccount == "") {
+			return errors.New("posting must have exactly one of account ID and system account")
+		}
+		if posting.Amount == 0 {
+			return errors.New("posting amount cannot be zero")
+		}
+		totals[posting.Currency] += posting.Amount
+	}
+	for currency, total := range totals {
+		if total != 0 {
+			return fmt.Errorf("journal entry does not balance in %s, postings sum to %s", currency, total.Format(currency))
+		}
+	}
+	return nil
+}
@@ -0,0 +1,91 @@
+package entities
+
+import (
+	"database/sql/driver"
+	"encoding/json"
+	"math/big"
+)
+
+// MoneyScale is the number of decimal places a Money value carries.
+// It is the largest minor unit of any supported currency, see currency.go.
+const MoneyScale = 3
+
+// moneyMaxIntegerDigits matches the DECIMAL(18, 3) columns in db/migrations
+const moneyMaxIntegerDigits = 18 - MoneyScale
+
+// Money is an exact fixed-point amount stored as an integer number of 10^-MoneyScale units,
+// so that balances never drift the way float64 arithmetic does
+type Money int64
+
+// ParseMoney parses a plain decimal string such as "100", "-3.5" or "12.34".
+// Amounts with more than MoneyScale decimal places are rejected instead of being rounded.
+func ParseMoney(s string) (Money, error) {
+	units, err := parseDecimal(s, MoneyScale, moneyMaxIntegerDigits, "amount")
+	if err != nil {
+		return 0, err
+	}
+	return Money(units), nil
+}
+
+// String formats the amount with exactly MoneyScale decimal places, e.g. "12.300"
+func (m Money) String() string {
+	return formatDecimal(big.NewInt(int64(m)), MoneyScale, MoneyScale)
+}
+
+// Format formats the amount with the number of decimal places of the currency, e.g. "12.30" EUR or "1200" JPY.
+// Callers are expected to have validated the amount against the currency first.
+func (m Money) Format(currency Currency) string {
+	return formatDecimal(big.NewInt(int64(m)), MoneyScale, currency.MinorUnits())
+}
+
+// Prorate returns the share part/whole of the amount, rounded down to the minor units of the currency
+func (m Money) Prorate(part, whole Money, currency Currency) Money {
+	share := new(big.Int).Mul(big.NewInt(int64(m)), big.NewInt(int64(part)))
+	share.Quo(share, big.NewInt(int64(whole)))
+	step := big.NewInt(pow10(MoneyScale - currency.MinorUnits()))
+	share.Sub(share, new(big.Int).Rem(share, step))
+	return Money(share.Int64())
+}
+
+// MarshalJSON encodes the amount as a string so that no precision is lost in JSON clients
+func (m Money) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.String())
+}
+
+// UnmarshalJSON accepts both "12.34" and 12.34
+func (m *Money) UnmarshalJSON(data []byte) error {
+	return m.unmarshal(data, "amount")
+}
+
+// unmarshal decodes the amount like UnmarshalJSON, kind describes the value in error messages
+func (m *Money) unmarshal(data []byte, kind string) error {
+	text, err := decimalText(data, kind)
+	if err != nil {
+		return err
+	}
+	units, err := parseDecimal(text, MoneyScale, moneyMaxIntegerDigits, kind)
+	if err != nil {
+		return err
+	}
+	*m = Money(units)
+	return nil
+}
+
+// Scan reads a DECIMAL column
+func (m *Money) Scan(src interface{}) error {
+	text, err := scannedDecimalText(src)
+	if err != nil {
+		return err
+	}
+	parsed, err := ParseMoney(text)
+	if err != nil {
+		return err
+	}
+	*m = parsed
+	return nil
+}
+
+// Value sends the amount to the database as exact decimal text
+func (m Money) Value() (driver.Value, error) {
+	return m.String(), nil
+}
@@ -0,0 +1,103 @@
+package entities
+
+import (
+	"encoding/json"
+	"github.com/stretchr/testify/assert"
+	"testing"
+)
+
+func TestParseMoney(t *testing.T) {
+	tests := []struct {
+		input       string
+		expected    Money
+		expectError bool
+	}{
+		{"100", 100000, false},
+		{"0.1", 100, false},
+		{"12.34", 12340, false},
+		{"-3.50", -3500, false},
+		{"0.001", 1, false},
+		{"1.0005", 0, true},
+		{"1.", 0, true},
+		{".5", 0, true},
+		{"1e3", 0, true},
+		{"", 0, true},
+		{"abc", 0, true},
+		{"9999999999999999", 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.input, func(t *testing.T) {
+			amount, err := ParseMoney(tt.input)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expected, amount)
+			}
+		})
+	}
+}
+
+func TestMoneyJSON(t *testing.T) {
+	var tx Transaction
+	err := json.Unmarshal([]byte(`{"source_account_id": 1, "destination_account_id": 2, "amount": "0.30"}`), &tx)
+	assert.NoError(t, err)
+	assert.Equal(t, Money(300), tx.Amount)
+
+	err = json.Unmarshal([]byte(`{"source_account_id": 1, "destination_account_id": 2, "amount": 0.1}`), &tx)
+	assert.NoError(t, err)
+	assert.Equal(t, Money(100), tx.Amount)
+
+	err = json.Unmarshal([]byte(`{"source_account_id": 1, "destination_account_id": 2, "amount": "0.0001"}`), &tx)
+	assert.ErrorIs(t, err, ErrTooManyDecimals)
+
+	encoded, err := json.Marshal(Account{AccountID: 1, Balance: -50, Currency: "EUR"})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"account_id": 1, "balance": "-0.05", "available_balance": "0.00", "currency": "EUR", "overdraft_limit": "0.00", "unlimited_overdraft": false, "available_to_spend": "0.00"}`, string(encoded))
+}
+
+func TestAccountCurrency(t *testing.T) {
+	tests := []struct {
+		name             string
+		input            string
+		expectedCurrency Currency
+		expectError      bool
+	}{
+		{"Defaults to USD", `{"account_id": 1, "balance": "10.50"}`, "USD", false},
+		{"Normalises currency code", `{"account_id": 1, "balance": "10", "currency": "jpy"}`, "JPY", false},
+		{"Allows three decimals for KWD", `{"account_id": 1, "balance": "10.125", "currency": "KWD"}`, "KWD", false},
+		{"Rejects decimals for JPY", `{"account_id": 1, "balance": "10.5", "currency": "JPY"}`, "", true},
+		{"Rejects three decimals for EUR", `{"account_id": 1, "balance": "10.125", "currency": "EUR"}`, "", true},
+		{"Rejects unknown currency", `{"account_id": 1, "balance": "10", "currency": "XYZ"}`, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var account Account
+			err := json.Unmarshal([]byte(tt.input), &account)
+			if tt.expectError {
+				assert.Error(t, err)
+			} else {
+				assert.NoError(t, err)
+				assert.Equal(t, tt.expectedCurrency, account.Currency)
+			}
+		})
+	}
+
+	encoded, err := json.Marshal(Account{AccountID: 1, Balance: 1200000, AvailableBalance: 1000000, Currency: "JPY", OverdraftLimit: 500000})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"account_id": 1, "balance": "1200", "available_balance": "1000", "currency": "JPY", "overdraft_limit": "500", "unlimited_overdraft": false, "available_to_spend": "1500"}`, string(encoded))
+
+	// Accounts with an unlimited overdraft have no available_to_spend
+	encoded, err = json.Marshal(Account{AccountID: 1, Currency: "USD", Status: AccountStatusActive, UnlimitedOverdraft: true})
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"account_id": 1, "balance": "0.00", "available_balance": "0.00", "currency": "USD", "status": "active", "overdraft_limit": "0.00", "unlimited_overdraft": true}`, string(encoded))
+}
+
+func TestMoneyProrate(t *testing.T) {
+	// A third of 10.00 EUR rounds down to the cent
+	assert.Equal(t, Money(3330), Money(10000).Prorate(1, 3, "EUR"))
+	assert.Equal(t, Money(3000), Money(10000).Prorate(1, 3, "JPY"))
+	assert.Equal(t, Money(10000), Money(10000).Prorate(7, 7, "EUR"))
+}
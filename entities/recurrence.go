@@ -0,0 +1,215 @@
+package entities
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	FrequencyWeekly  = "weekly"
+	FrequencyMonthly = "monthly"
+	FrequencyCron    = "cron"
+)
+
+// Business day conventions, they move an occurrence that falls on a weekend
+const (
+	BusinessDayNone              = "none"
+	BusinessDayFollowing         = "following"
+	BusinessDayPreceding         = "preceding"
+	BusinessDayModifiedFollowing = "modified_following"
+)
+
+// cronSearchLimit bounds the search for the next match of a cron expression, which may never match (e.g. 30 February)
+const cronSearchLimit = 5 * 366 * 24 * time.Hour
+
+var ErrCronNeverMatches = errors.New("cron expression does not match any time in the next five years")
+
+// CronSchedule is a parsed five field cron expression: minute, hour, day of month, month and day of week.
+// Each field accepts *, a value, a range a-b, a step */n or a-b/n, and comma separated lists of those.
+// As in cron, if both day of month and day of week are restricted, a day matching either of them matches.
+type CronSchedule struct {
+	minutes     map[int]bool
+	hours       map[int]bool
+	daysOfMonth map[int]bool
+	months      map[int]bool
+	daysOfWeek  map[int]bool
+	// domAny and dowAny record whether the day fields were *
+	domAny bool
+	dowAny bool
+}
+
+func ParseCron(expression string) (CronSchedule, error) {
+	fields := strings.Fields(expression)
+	if len(fields) != 5 {
+		return CronSchedule{}, errors.New("cron expression must have 5 fields: minute hour day-of-month month day-of-week")
+	}
+	var schedule CronSchedule
+	var err error
+	bounds := []struct {
+		name     string
+		min, max int
+		target   *map[int]bool
+	}{
+		{"minute", 0, 59, &schedule.minutes},
+		{"hour", 0, 23, &schedule.hours},
+		{"day of month", 1, 31, &schedule.daysOfMonth},
+		{"month", 1, 12, &schedule.months},
+		// 7 is Sunday too
+		{"day of week", 0, 7, &schedule.daysOfWeek},
+	}
+	for i, bound := range bounds {
+		*bound.target, err = parseCronField(fields[i], bound.min, bound.max)
+		if err != nil {
+			return CronSchedule{}, fmt.Errorf("cron %s: %w", bound.name, err)
+		}
+	}
+	if schedule.daysOfWeek[7] {
+		schedule.daysOfWeek[0] = true
+	}
+	schedule.domAny = fields[2] == "*"
+	schedule.dowAny = fields[4] == "*"
+	return schedule, nil
+}
+
+func parseCronField(field string, min, max int) (map[int]bool, error) {
+	values := map[int]bool{}
+	for _, part := range strings.Split(field, ",") {
+		rangePart, stepPart, hasStep := strings.Cut(part, "/")
+		step := 1
+		if hasStep {
+			var err error
+			step, err = strconv.Atoi(stepPart)
+			if err != nil || step < 1 {
+				return nil, fmt.Errorf("invalid step %q", stepPart)
+			}
+		}
+		low, high := min, max
+		if rangePart != "*" {
+			lowPart, highPart, isRange := strings.Cut(rangePart, "-")
+			var err error
+			low, err = strconv.Atoi(lowPart)
+			if err != nil {
+				return nil, fmt.Errorf("invalid value %q", lowPart)
+			}
+			high = low
+			if isRange {
+				high, err = strconv.Atoi(highPart)
+				if err != nil {
+					return nil, fmt.Errorf("invalid value %q", highPart)
+				}
+			} else if hasStep {
+				high = max
+			}
+		}
+		if low < min || high > max || low > high {
+			return nil, fmt.Errorf("%q is out of range %d-%d", part, min, max)
+		}
+		for value := low; value <= high; value += step {
+			values[value] = true
+		}
+	}
+	return values, nil
+}
+
+// matchesDay reports whether the date of t matches the day of month, month and day of week fields
+func (c CronSchedule) matchesDay(t time.Time) bool {
+	if !c.months[int(t.Month())] {
+		return false
+	}
+	dom := c.daysOfMonth[t.Day()]
+	dow := c.daysOfWeek[int(t.Weekday())]
+	if c.domAny || c.dowAny {
+		return dom && dow
+	}
+	return dom || dow
+}
+
+// Next returns the first time strictly after after that matches, in the location of after
+func (c CronSchedule) Next(after time.Time) (time.Time, error) {
+	t := after.Truncate(time.Minute).Add(time.Minute)
+	limit := after.Add(cronSearchLimit)
+	for t.Before(limit) {
+		if !c.matchesDay(t) {
+			t = time.Date(t.Year(), t.Month(), t.Day()+1, 0, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.hours[t.Hour()] {
+			t = time.Date(t.Year(), t.Month(), t.Day(), t.Hour()+1, 0, 0, 0, t.Location())
+			continue
+		}
+		if !c.minutes[t.Minute()] {
+			t = t.Add(time.Minute)
+			continue
+		}
+		return t, nil
+	}
+	return time.Time{}, ErrCronNeverMatches
+}
+
+// Recurrence is when a standing order falls due. Weekly occurrences are a whole number of weeks after StartAt,
+// monthly ones are on the day of month of StartAt, or the last day of shorter months, at the time of day of StartAt.
+// Cron occurrences are the times matching Cron from StartAt on, in UTC.
+type Recurrence struct {
+	Frequency string
+	Cron      string
+	StartAt   time.Time
+}
+
+// Occurrence returns when occurrence n, counting from 1, is scheduled. previous is the scheduled time of
+// occurrence n-1 and is only used by cron recurrences.
+func (r Recurrence) Occurrence(n int, previous time.Time) (time.Time, error) {
+	start := r.StartAt.UTC()
+	switch r.Frequency {
+	case FrequencyWeekly:
+		return start.AddDate(0, 0, 7*(n-1)), nil
+	case FrequencyMonthly:
+		// time.Date normalises the month, the day is clamped so that 31 January is followed by 28 February
+		firstOfMonth := time.Date(start.Year(), start.Month()+time.Month(n-1), 1, start.Hour(), start.Minute(), start.Second(), start.Nanosecond(), time.UTC)
+		day := start.Day()
+		if lastDay := firstOfMonth.AddDate(0, 1, -1).Day(); day > lastDay {
+			day = lastDay
+		}
+		return firstOfMonth.AddDate(0, 0, day-1), nil
+	case FrequencyCron:
+		schedule, err := ParseCron(r.Cron)
+		if err != nil {
+			return time.Time{}, err
+		}
+		if n == 1 {
+			// The start itself counts if it matches
+			return schedule.Next(start.Add(-time.Minute))
+		}
+		return schedule.Next(previous.UTC())
+	default:
+		return time.Time{}, fmt.Errorf("unknown frequency %q", r.Frequency)
+	}
+}
+
+// AdjustBusinessDay moves t off a weekend according to the convention, keeping its time of day.
+// Modified following moves forward unless that changes the month, in which case it moves back.
+func AdjustBusinessDay(t time.Time, convention string) time.Time {
+	switch convention {
+	case BusinessDayFollowing:
+		return moveToBusinessDay(t, 1)
+	case BusinessDayPreceding:
+		return moveToBusinessDay(t, -1)
+	case BusinessDayModifiedFollowing:
+		adjusted := moveToBusinessDay(t, 1)
+		if adjusted.Month() != t.Month() {
+			return moveToBusinessDay(t, -1)
+		}
+		return adjusted
+	default:
+		return t
+	}
+}
+
+func moveToBusinessDay(t time.Time, direction int) time.Time {
+	for t.Weekday() == time.Saturday || t.Weekday() == time.Sunday {
+		t = t.AddDate(0, 0, direction)
+	}
+	return t
+}
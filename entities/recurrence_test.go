@@ -0,0 +1,68 @@
+package entities
+
+import (
+	"github.com/stretchr/testify/assert"
+	"testing"
+	"time"
+)
+
+func TestRecurrenceOccurrence(t *testing.T) {
+	tests := []struct {
+		name       string
+		recurrence Recurrence
+		expected   []string
+	}{
+		{
+			"Weekly from the start",
+			Recurrence{Frequency: FrequencyWeekly, StartAt: time.Date(2026, 3, 2, 9, 0, 0, 0, time.UTC)},
+			[]string{"2026-03-02T09:00:00Z", "2026-03-09T09:00:00Z", "2026-03-16T09:00:00Z"},
+		},
+		{
+			"Monthly clamps to the end of shorter months",
+			Recurrence{Frequency: FrequencyMonthly, StartAt: time.Date(2026, 1, 31, 0, 0, 0, 0, time.UTC)},
+			[]string{"2026-01-31T00:00:00Z", "2026-02-28T00:00:00Z", "2026-03-31T00:00:00Z"},
+		},
+		{
+			"Cron on the 1st and 15th at 08:30",
+			Recurrence{Frequency: FrequencyCron, Cron: "30 8 1,15 * *", StartAt: time.Date(2026, 1, 1, 8, 30, 0, 0, time.UTC)},
+			[]string{"2026-01-01T08:30:00Z", "2026-01-15T08:30:00Z", "2026-02-01T08:30:00Z"},
+		},
+		{
+			"Cron every 15 minutes on weekdays",
+			Recurrence{Frequency: FrequencyCron, Cron: "*/15 * * * 1-5", StartAt: time.Date(2026, 1, 2, 23, 40, 0, 0, time.UTC)},
+			[]string{"2026-01-02T23:45:00Z", "2026-01-05T00:00:00Z", "2026-01-05T00:15:00Z"},
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var previous time.Time
+			for i, expected := range tt.expected {
+				occurrence, err := tt.recurrence.Occurrence(i+1, previous)
+				assert.NoError(t, err)
+				assert.Equal(t, expected, occurrence.Format(time.RFC3339))
+				previous = occurrence
+			}
+		})
+	}
+}
+
+func TestParseCronRejectsInvalidExpressions(t *testing.T) {
+	for _, expression := range []string{"* * * *", "60 * * * *", "* * 0 * *", "*/0 * * * *", "5-1 * * * *"} {
+		_, err := ParseCron(expression)
+		assert.Error(t, err, expression)
+	}
+	_, err := Recurrence{Frequency: FrequencyCron, Cron: "0 0 30 2 *", StartAt: time.Now()}.Occurrence(1, time.Time{})
+	assert.ErrorIs(t, err, ErrCronNeverMatches)
+}
+
+func TestAdjustBusinessDay(t *testing.T) {
+	// 31 January 2026 is a Saturday
+	saturday := time.Date(2026, 1, 31, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, saturday, AdjustBusinessDay(saturday, BusinessDayNone))
+	assert.Equal(t, time.Date(2026, 2, 2, 9, 0, 0, 0, time.UTC), AdjustBusinessDay(saturday, BusinessDayFollowing))
+	assert.Equal(t, time.Date(2026, 1, 30, 9, 0, 0, 0, time.UTC), AdjustBusinessDay(saturday, BusinessDayPreceding))
+	assert.Equal(t, time.Date(2026, 1, 30, 9, 0, 0, 0, time.UTC), AdjustBusinessDay(saturday, BusinessDayModifiedFollowing))
+	sunday := time.Date(2026, 2, 15, 9, 0, 0, 0, time.UTC)
+	assert.Equal(t, time.Date(2026, 2, 16, 9, 0, 0, 0, time.UTC), AdjustBusinessDay(sunday, BusinessDayModifiedFollowing))
+}
@@ -0,0 +1,120 @@
+package entities
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	ScheduledTransferStatusPending   = "pending"
+	ScheduledTransferStatusSucceeded = "succeeded"
+	ScheduledTransferStatusFailed    = "failed"
+	ScheduledTransferStatusCancelled = "cancelled"
+)
+
+// MaxScheduledTransferAttempts is how many times a scheduled transfer is tried before it is marked failed
+const MaxScheduledTransferAttempts = 5
+
+// scheduledTransferRetryDelay is the wait after the first failed attempt, it doubles after every further attempt
+// up to maxScheduledTransferRetryDelay
+const scheduledTransferRetryDelay = time.Minute
+const maxScheduledTransferRetryDelay = time.Hour
+
+// ScheduledTransferRetryDelay returns how long to wait before the next attempt once attempts have failed
+func ScheduledTransferRetryDelay(attempts int) time.Duration {
+	delay := scheduledTransferRetryDelay
+	for i := 1; i < attempts && delay < maxScheduledTransferRetryDelay; i++ {
+		delay *= 2
+	}
+	if delay > maxScheduledTransferRetryDelay {
+		return maxScheduledTransferRetryDelay
+	}
+	return delay
+}
+
+// ScheduledTransferRequest is a Transaction to be executed at ExecuteAt instead of right away
+type ScheduledTransferRequest struct {
+	SourceAccountID      int       `json:"source_account_id"`
+	DestinationAccountID int       `json:"destination_account_id"`
+	Amount               Money     `json:"amount"`
+	ConvertCurrency      bool      `json:"convert_currency"`
+	ExecuteAt            time.Time `json:"execute_at"`
+}
+
+func (s *ScheduledTransferRequest) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	decodeTransfer(dec, &s.SourceAccountID, &s.DestinationAccountID, &s.Amount, &s.ConvertCurrency)
+	if dec.field("execute_at", &s.ExecuteAt, true) && !s.ExecuteAt.After(time.Now()) {
+		dec.fail("execute_at", FieldOutOfRange, "must be in the future")
+	}
+	return dec.err()
+}
+
+// Transaction returns the transfer the request schedules
+func (s ScheduledTransferRequest) Transaction() Transaction {
+	return Transaction{
+		SourceAccountID:      s.SourceAccountID,
+		DestinationAccountID: s.DestinationAccountID,
+		Amount:               s.Amount,
+		ConvertCurrency:      s.ConvertCurrency,
+	}
+}
+
+// ScheduledTransfer is a transfer waiting for ExecuteAt, or the outcome of executing it. A pending transfer is
+// next tried at NextAttemptAt, a failed attempt keeps its error in LastError, and once it succeeds TransactionID
+// is the transfer it became. Amount is in Currency, the currency of the source account.
+type ScheduledTransfer struct {
+	ScheduledTransferID  int       `json:"scheduled_transfer_id"`
+	SourceAccountID      int       `json:"source_account_id"`
+	DestinationAccountID int       `json:"destination_account_id"`
+	Amount               Money     `json:"amount"`
+	Currency             Currency  `json:"currency"`
+	ConvertCurrency      bool      `json:"convert_currency"`
+	ExecuteAt            time.Time `json:"execute_at"`
+	Status               string    `json:"status"`
+	Attempts             int       `json:"attempts"`
+	NextAttemptAt        time.Time `json:"next_attempt_at"`
+	LastError            *string   `json:"last_error,omitempty"`
+	TransactionID        *int      `json:"transaction_id,omitempty"`
+	CreatedAt            time.Time `json:"created_at"`
+	UpdatedAt            time.Time `json:"updated_at"`
+}
+
+// Transaction returns the transfer to execute
+func (s ScheduledTransfer) Transaction() Transaction {
+	return Transaction{
+		SourceAccountID:      s.SourceAccountID,
+		DestinationAccountID: s.DestinationAccountID,
+		Amount:               s.Amount,
+		ConvertCurrency:      s.ConvertCurrency,
+	}
+}
+
+// Location is the URL the scheduled transfer can be fetched from
+func (s ScheduledTransfer) Location() string {
+	return "/scheduled-transfers/" + strconv.Itoa(s.ScheduledTransferID)
+}
+
+// MarshalJSON formats the amount with the precision of the currency
+func (s ScheduledTransfer) MarshalJSON() ([]byte, error) {
+	type Alias ScheduledTransfer
+	return json.Marshal(&struct {
+		Alias
+		Amount string `json:"amount"`
+	}{
+		Alias:  Alias(s),
+		Amount: s.Amount.Format(s.Currency),
+	})
+}
+
+// ScheduledTransferFilter selects scheduled transfers. A nil AccountID matches every account, and AccountID matches
+// transfers both out of and into the account. An empty Status matches every status.
+type ScheduledTransferFilter struct {
+	AccountID *int
+	Status    string
+	Limit     int
+}
@@ -0,0 +1,182 @@
+package entities
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strconv"
+	"time"
+)
+
+const (
+	StandingOrderStatusActive    = "active"
+	StandingOrderStatusCompleted = "completed"
+	StandingOrderStatusCancelled = "cancelled"
+)
+
+const (
+	StandingOrderExecutionSucceeded = "succeeded"
+	StandingOrderExecutionFailed    = "failed"
+)
+
+// StandingOrderRequest repeats a Transaction on a Recurrence from StartAt until EndAt or until MaxOccurrences
+// transfers have been generated, whichever comes first. Either may be left out, but not both.
+// Cron is only used, and required, with the cron frequency.
+type StandingOrderRequest struct {
+	SourceAccountID       int        `json:"source_account_id"`
+	DestinationAccountID  int        `json:"destination_account_id"`
+	Amount                Money      `json:"amount"`
+	ConvertCurrency       bool       `json:"convert_currency"`
+	Frequency             string     `json:"frequency"`
+	Cron                  string     `json:"cron"`
+	StartAt               time.Time  `json:"start_at"`
+	EndAt                 *time.Time `json:"end_at"`
+	MaxOccurrences        *int       `json:"max_occurrences"`
+	BusinessDayAdjustment string     `json:"business_day_adjustment"`
+}
+
+func (s *StandingOrderRequest) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	decodeTransfer(dec, &s.SourceAccountID, &s.DestinationAccountID, &s.Amount, &s.ConvertCurrency)
+	hasFrequency := dec.field("frequency", &s.Frequency, true)
+	if hasFrequency && s.Frequency != FrequencyWeekly && s.Frequency != FrequencyMonthly && s.Frequency != FrequencyCron {
+		dec.fail("frequency", FieldInvalid, fmt.Sprintf("must be %q, %q or %q", FrequencyWeekly, FrequencyMonthly, FrequencyCron))
+	}
+	if dec.field("cron", &s.Cron, s.Frequency == FrequencyCron) {
+		if s.Frequency == FrequencyCron {
+			_, err = ParseCron(s.Cron)
+			if err != nil {
+				dec.invalid("cron", err)
+			}
+		} else if hasFrequency {
+			dec.fail("cron", FieldInvalid, "can only be given with the cron frequency")
+		}
+	}
+	hasStartAt := dec.field("start_at", &s.StartAt, true)
+	hasEndAt := dec.field("end_at", &s.EndAt, false)
+	if hasStartAt && hasEndAt && !s.EndAt.After(s.StartAt) {
+		dec.fail("end_at", FieldOutOfRange, "must be after start_at")
+	}
+	var maxOccurrences int
+	if dec.positive("max_occurrences", &maxOccurrences, false) {
+		s.MaxOccurrences = &maxOccurrences
+	}
+	if !dec.present("end_at") && !dec.present("max_occurrences") {
+		dec.fail("end_at", FieldMissing, "either end_at or max_occurrences is required")
+	}
+	dec.field("business_day_adjustment", &s.BusinessDayAdjustment, false)
+	switch s.BusinessDayAdjustment {
+	case "":
+		s.BusinessDayAdjustment = BusinessDayNone
+	case BusinessDayNone, BusinessDayFollowing, BusinessDayPreceding, BusinessDayModifiedFollowing:
+	default:
+		dec.fail("business_day_adjustment", FieldInvalid, fmt.Sprintf("must be %q, %q, %q or %q",
+			BusinessDayNone, BusinessDayFollowing, BusinessDayPreceding, BusinessDayModifiedFollowing))
+	}
+	return dec.err()
+}
+
+// Transaction returns the transfer each occurrence makes
+func (s StandingOrderRequest) Transaction() Transaction {
+	return Transaction{
+		SourceAccountID:      s.SourceAccountID,
+		DestinationAccountID: s.DestinationAccountID,
+		Amount:               s.Amount,
+		ConvertCurrency:      s.ConvertCurrency,
+	}
+}
+
+// StandingOrder is a stored standing order. Occurrences is how many occurrences have been executed or have failed.
+// While it is active, NextScheduledAt is when the next occurrence is due by its recurrence and NextExecuteAt is
+// that time after the business day adjustment. Amount is in Currency, the currency of the source account.
+type StandingOrder struct {
+	StandingOrderID       int        `json:"standing_order_id"`
+	SourceAccountID       int        `json:"source_account_id"`
+	DestinationAccountID  int        `json:"destination_account_id"`
+	Amount                Money      `json:"amount"`
+	Currency              Currency   `json:"currency"`
+	ConvertCurrency       bool       `json:"convert_currency"`
+	Frequency             string     `json:"frequency"`
+	Cron                  *string    `json:"cron,omitempty"`
+	StartAt               time.Time  `json:"start_at"`
+	EndAt                 *time.Time `json:"end_at,omitempty"`
+	MaxOccurrences        *int       `json:"max_occurrences,omitempty"`
+	BusinessDayAdjustment string     `json:"business_day_adjustment"`
+	Status                string     `json:"status"`
+	Occurrences           int        `json:"occurrences"`
+	NextScheduledAt       *time.Time `json:"next_scheduled_at,omitempty"`
+	NextExecuteAt         *time.Time `json:"next_execute_at,omitempty"`
+	CreatedAt             time.Time  `json:"created_at"`
+	UpdatedAt             time.Time  `json:"updated_at"`
+}
+
+// Transaction returns the transfer each occurrence makes
+func (s StandingOrder) Transaction() Transaction {
+	return Transaction{
+		SourceAccountID:      s.SourceAccountID,
+		DestinationAccountID: s.DestinationAccountID,
+		Amount:               s.Amount,
+		ConvertCurrency:      s.ConvertCurrency,
+	}
+}
+
+// Recurrence returns when the standing order falls due
+func (s StandingOrder) Recurrence() Recurrence {
+	recurrence := Recurrence{Frequency: s.Frequency, StartAt: s.StartAt}
+	if s.Cron != nil {
+		recurrence.Cron = *s.Cron
+	}
+	return recurrence
+}
+
+// Schedule works out occurrence n, counting from 1, given when occurrence n-1 was scheduled. It returns false
+// if the standing order has no occurrence n because of MaxOccurrences or EndAt.
+func (s StandingOrder) Schedule(n int, previous time.Time) (scheduledAt time.Time, executeAt time.Time, ok bool, err error) {
+	if s.MaxOccurrences != nil && n > *s.MaxOccurrences {
+		return time.Time{}, time.Time{}, false, nil
+	}
+	scheduledAt, err = s.Recurrence().Occurrence(n, previous)
+	if err != nil {
+		if errors.Is(err, ErrCronNeverMatches) {
+			return time.Time{}, time.Time{}, false, nil
+		}
+		return time.Time{}, time.Time{}, false, err
+	}
+	if s.EndAt != nil && scheduledAt.After(*s.EndAt) {
+		return time.Time{}, time.Time{}, false, nil
+	}
+	return scheduledAt, AdjustBusinessDay(scheduledAt, s.BusinessDayAdjustment), true, nil
+}
+
+// Location is the URL the standing order can be fetched from
+func (s StandingOrder) Location() string {
+	return "/standing-orders/" + strconv.Itoa(s.StandingOrderID)
+}
+
+// MarshalJSON formats the amount with the precision of the currency
+func (s StandingOrder) MarshalJSON() ([]byte, error) {
+	type Alias StandingOrder
+	return json.Marshal(&struct {
+		Alias
+		Amount string `json:"amount"`
+	}{
+		Alias:  Alias(s),
+		Amount: s.Amount.Format(s.Currency),
+	})
+}
+
+// StandingOrderExecution is the outcome of one occurrence of a standing order. A failed occurrence keeps its error
+// and is not retried, the standing order moves on to the next one.
+type StandingOrderExecution struct {
+	StandingOrderID int       `json:"standing_order_id"`
+	Occurrence      int       `json:"occurrence"`
+	ScheduledAt     time.Time `json:"scheduled_at"`
+	ExecuteAt       time.Time `json:"execute_at"`
+	Status          string    `json:"status"`
+	Error           *string   `json:"error,omitempty"`
+	TransactionID   *int      `json:"transaction_id,omitempty"`
+	CreatedAt       time.Time `json:"created_at"`
+}
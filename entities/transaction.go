@@ -2,44 +2,100 @@ package entities
 
 import (
 	"encoding/json"
-	"errors"
 	"strconv"
+	"time"
 )
 
 type Transaction struct {
-	SourceAccountID      int     `json:"source_account_id" valid:"required"`
-	DestinationAccountID int     `json:"destination_account_id" valid:"required"`
-	Amount               float64 `json:"amount" valid:"required"`
+	SourceAccountID      int   `json:"source_account_id"`
+	DestinationAccountID int   `json:"destination_account_id"`
+	Amount               Money `json:"amount"`
+	// ConvertCurrency must be set to transfer between accounts of different currencies
+	ConvertCurrency bool `json:"convert_currency"`
 }
 
 func (t *Transaction) UnmarshalJSON(data []byte) error {
-	type Alias Transaction
-	aux := &struct {
-		*Alias
-		Amount string `json:"amount"`
-	}{
-		Alias: (*Alias)(t),
-	}
-	err := json.Unmarshal(data, &aux)
+	dec, err := decodeObject(data)
 	if err != nil {
 		return err
 	}
-	amount, err := strconv.ParseFloat(aux.Amount, 64)
-	if err != nil {
-		return err
+	decodeTransfer(dec, &t.SourceAccountID, &t.DestinationAccountID, &t.Amount, &t.ConvertCurrency)
+	return dec.err()
+}
+
+// decodeTransfer decodes the members describing a transfer, which every request that makes transfers has.
+// A nil convertCurrency leaves convert_currency an unknown field.
+func decodeTransfer(dec *objectDecoder, sourceAccountID *int, destinationAccountID *int, amount *Money, convertCurrency *bool) {
+	dec.positive("source_account_id", sourceAccountID, true)
+	dec.positive("destination_account_id", destinationAccountID, true)
+	// Amount is parsed exactly by Money.UnmarshalJSON
+	if dec.field("amount", amount, true) && *amount <= 0 {
+		dec.fail("amount", FieldOutOfRange, "must be greater than zero")
+	}
+	// Holds cannot convert currencies
+	if convertCurrency != nil {
+		dec.field("convert_currency", convertCurrency, false)
 	}
-	t.Amount = amount
+}
 
-	// Check for extra fields
-	var temp map[string]interface{}
-	err = json.Unmarshal(data, &temp)
+// ReversalRequest reverses a transfer. Amount is in the destination currency of the original transfer,
+// a nil Amount reverses whatever has not been reversed yet.
+type ReversalRequest struct {
+	Amount *Money `json:"amount"`
+}
+
+func (r *ReversalRequest) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
 	if err != nil {
 		return err
 	}
-	for key := range temp {
-		if key != "source_account_id" && key != "destination_account_id" && key != "amount" {
-			return errors.New("extra field found")
-		}
+	if dec.field("amount", &r.Amount, false) && *r.Amount <= 0 {
+		dec.fail("amount", FieldOutOfRange, "must be greater than zero")
 	}
-	return nil
+	return dec.err()
+}
+
+// TransactionRecord is a transfer as stored in account_transactions. Amount is in the source currency and
+// DestinationAmount in the destination currency, they only differ for cross-currency transfers.
+// A reversal is a transfer back from the original destination, ReversalOf is the transfer it reverses.
+// Fee is charged to the source on top of Amount, so SourceBalanceAfter already has it taken off.
+type TransactionRecord struct {
+	TransactionID           int       `json:"transaction_id"`
+	SourceAccountID         int       `json:"source_account_id"`
+	DestinationAccountID    int       `json:"destination_account_id"`
+	Amount                  Money     `json:"amount"`
+	Currency                Currency  `json:"currency"`
+	DestinationAmount       Money     `json:"destination_amount"`
+	DestinationCurrency     Currency  `json:"destination_currency"`
+	ExchangeRate            *Rate     `json:"exchange_rate,omitempty"`
+	RoundingRemainder       *string   `json:"rounding_remainder,omitempty"`
+	SourceBalanceAfter      Money     `json:"source_balance_after"`
+	DestinationBalanceAfter Money     `json:"destination_balance_after"`
+	BatchID                 *int      `json:"batch_id,omitempty"`
+	ReversalOf              *int      `json:"reversal_of,omitempty"`
+	Fee                     *Fee      `json:"fee,omitempty"`
+	CreatedAt               time.Time `json:"created_at"`
+}
+
+// Location is the URL the record can be fetched from
+func (r TransactionRecord) Location() string {
+	return "/transactions/" + strconv.Itoa(r.TransactionID)
+}
+
+// MarshalJSON formats every amount with the precision of its currency
+func (r TransactionRecord) MarshalJSON() ([]byte, error) {
+	type Alias TransactionRecord
+	return json.Marshal(&struct {
+		Alias
+		Amount                  string `json:"amount"`
+		DestinationAmount       string `json:"destination_amount"`
+		SourceBalanceAfter      string `json:"source_balance_after"`
+		DestinationBalanceAfter string `json:"destination_balance_after"`
+	}{
+		Alias:                   Alias(r),
+		Amount:                  r.Amount.Format(r.Currency),
+		DestinationAmount:       r.DestinationAmount.Format(r.DestinationCurrency),
+		SourceBalanceAfter:      r.SourceBalanceAfter.Format(r.Currency),
+		DestinationBalanceAfter: r.DestinationBalanceAfter.Format(r.DestinationCurrency),
+	})
 }
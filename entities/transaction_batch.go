@@ -0,0 +1,32 @@
+package entities
+
+import (
+	"fmt"
+	"time"
+)
+
+// MaxBatchSize caps the number of legs in a batch, all of their accounts are locked at once
+const MaxBatchSize = 1000
+
+// TransactionBatch is a list of transfers that are committed or rolled back together
+type TransactionBatch struct {
+	Transactions []Transaction `json:"transactions"`
+}
+
+func (b *TransactionBatch) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	if arrayField(dec, "transactions", &b.Transactions, true) && (len(b.Transactions) == 0 || len(b.Transactions) > MaxBatchSize) {
+		dec.fail("transactions", FieldOutOfRange, fmt.Sprintf("must contain between 1 and %d transactions", MaxBatchSize))
+	}
+	return dec.err()
+}
+
+// TransactionBatchRecord is a committed batch, its transactions are in the order they were submitted
+type TransactionBatchRecord struct {
+	BatchID      int                 `json:"batch_id"`
+	Transactions []TransactionRecord `json:"transactions"`
+	CreatedAt    time.Time           `json:"created_at"`
+}
@@ -0,0 +1,105 @@
+package entities
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	DirectionIncoming = "incoming"
+	DirectionOutgoing = "outgoing"
+	// DirectionFee is the fee of a transfer between two other accounts paid to the revenue account
+	DirectionFee = "fee"
+)
+
+// CursorTimeLayout matches the microsecond precision of a postgres TIMESTAMP
+const CursorTimeLayout = "2006-01-02T15:04:05.999999"
+
+// AccountTransaction is a transfer as seen from one of its accounts. Fee is the fee paid on top of Amount by the
+// source of an outgoing transfer, or received with an incoming one by the revenue account, so the balance moves by
+// Amount plus Fee. A fee row is the fee alone, received by the revenue account from the counterparty.
+type AccountTransaction struct {
+	TransactionID         int       `json:"transaction_id"`
+	Direction             string    `json:"direction"`
+	CounterpartyAccountID int       `json:"counterparty_account_id"`
+	Amount                Money     `json:"amount"`
+	Fee                   *Money    `json:"fee,omitempty"`
+	Currency              Currency  `json:"currency"`
+	BalanceAfter          Money     `json:"balance_after"`
+	CreatedAt             time.Time `json:"created_at"`
+}
+
+// MarshalJSON formats the amounts with the precision of the currency
+func (a AccountTransaction) MarshalJSON() ([]byte, error) {
+	type Alias AccountTransaction
+	var fee *string
+	if a.Fee != nil {
+		formatted := a.Fee.Format(a.Currency)
+		fee = &formatted
+	}
+	return json.Marshal(&struct {
+		Alias
+		Amount       string  `json:"amount"`
+		Fee          *string `json:"fee,omitempty"`
+		BalanceAfter string  `json:"balance_after"`
+	}{
+		Alias:        Alias(a),
+		Amount:       a.Amount.Format(a.Currency),
+		Fee:          fee,
+		BalanceAfter: a.BalanceAfter.Format(a.Currency),
+	})
+}
+
+// TransactionHistoryCursor points at the last transaction of a page, the next page starts right after it
+type TransactionHistoryCursor struct {
+	CreatedAt     time.Time
+	TransactionID int
+}
+
+// TransactionHistoryFilter narrows down the history of an account, nil fields do not filter
+type TransactionHistoryFilter struct {
+	Direction string
+	From      *time.Time
+	To        *time.Time
+	MinAmount *Money
+	MaxAmount *Money
+	After     *TransactionHistoryCursor
+	Limit     int
+}
+
+// TransactionHistoryPage is one page of history, newest first
+type TransactionHistoryPage struct {
+	Transactions []AccountTransaction `json:"transactions"`
+	NextCursor   string               `json:"next_cursor,omitempty"`
+}
+
+// Encode returns the opaque cursor string handed to clients
+func (c TransactionHistoryCursor) Encode() string {
+	raw := c.CreatedAt.Format(CursorTimeLayout) + "|" + strconv.Itoa(c.TransactionID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func DecodeTransactionHistoryCursor(cursor string) (TransactionHistoryCursor, error) {
+	invalid := errors.New("invalid cursor")
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return TransactionHistoryCursor{}, invalid
+	}
+	createdAtText, idText, found := strings.Cut(string(raw), "|")
+	if !found {
+		return TransactionHistoryCursor{}, invalid
+	}
+	createdAt, err := time.Parse(CursorTimeLayout, createdAtText)
+	if err != nil {
+		return TransactionHistoryCursor{}, invalid
+	}
+	transactionID, err := strconv.Atoi(idText)
+	if err != nil {
+		return TransactionHistoryCursor{}, invalid
+	}
+	return TransactionHistoryCursor{CreatedAt: createdAt, TransactionID: transactionID}, nil
+}
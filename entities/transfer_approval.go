@@ -0,0 +1,134 @@
+package entities
+
+import (
+	"encoding/json"
+	"strconv"
+	"time"
+)
+
+const (
+	TransferApprovalStatusPending  = "pending_approval"
+	TransferApprovalStatusApproved = "approved"
+	TransferApprovalStatusRejected = "rejected"
+	TransferApprovalStatusExpired  = "expired"
+)
+
+// DefaultApprovalTTLSeconds is how long a transfer waits for approval when the policy does not say
+const DefaultApprovalTTLSeconds = 24 * 60 * 60
+
+// ApprovalPolicy makes transfers out of accounts in Currency of more than Threshold wait for a second principal
+// to approve them. A transfer that is not approved or rejected within TTLSeconds expires.
+type ApprovalPolicy struct {
+	Currency   Currency `json:"currency"`
+	Threshold  Money    `json:"threshold"`
+	TTLSeconds int      `json:"ttl_seconds"`
+}
+
+func (p *ApprovalPolicy) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	hasCurrency := dec.currency("currency", &p.Currency, true)
+	if dec.field("threshold", &p.Threshold, true) {
+		if p.Threshold < 0 {
+			dec.fail("threshold", FieldOutOfRange, "cannot be negative")
+		} else if hasCurrency {
+			err = p.Currency.ValidateAmount(p.Threshold)
+			if err != nil {
+				dec.invalid("threshold", err)
+			}
+		}
+	}
+	if dec.field("ttl_seconds", &p.TTLSeconds, false) && p.TTLSeconds < 0 {
+		dec.fail("ttl_seconds", FieldOutOfRange, "cannot be negative")
+	}
+	if p.TTLSeconds == 0 {
+		p.TTLSeconds = DefaultApprovalTTLSeconds
+	}
+	return dec.err()
+}
+
+// RequiresApproval reports whether a transfer of amount has to be approved first
+func (p ApprovalPolicy) RequiresApproval(amount Money) bool {
+	return amount > p.Threshold
+}
+
+// TTL is how long a transfer waits for approval
+func (p ApprovalPolicy) TTL() time.Duration {
+	return time.Duration(p.TTLSeconds) * time.Second
+}
+
+// MarshalJSON formats the threshold with the precision of the currency
+func (p ApprovalPolicy) MarshalJSON() ([]byte, error) {
+	type Alias ApprovalPolicy
+	return json.Marshal(&struct {
+		Alias
+		Threshold string `json:"threshold"`
+	}{
+		Alias:     Alias(p),
+		Threshold: p.Threshold.Format(p.Currency),
+	})
+}
+
+// TransferApproval is a transfer waiting for a principal other than RequestedBy to approve or reject it.
+// Once approved, TransactionID is the transfer it became. Amount is in Currency, the currency of the source account.
+type TransferApproval struct {
+	TransferApprovalID   int        `json:"transfer_approval_id"`
+	SourceAccountID      int        `json:"source_account_id"`
+	DestinationAccountID int        `json:"destination_account_id"`
+	Amount               Money      `json:"amount"`
+	Currency             Currency   `json:"currency"`
+	ConvertCurrency      bool       `json:"convert_currency"`
+	Status               string     `json:"status"`
+	RequestedBy          string     `json:"requested_by"`
+	DecidedBy            *string    `json:"decided_by,omitempty"`
+	Reason               *string    `json:"reason,omitempty"`
+	TransactionID        *int       `json:"transaction_id,omitempty"`
+	ExpiresAt            time.Time  `json:"expires_at"`
+	CreatedAt            time.Time  `json:"created_at"`
+	DecidedAt            *time.Time `json:"decided_at,omitempty"`
+}
+
+// Transaction returns the transfer waiting for approval
+func (a TransferApproval) Transaction() Transaction {
+	return Transaction{
+		SourceAccountID:      a.SourceAccountID,
+		DestinationAccountID: a.DestinationAccountID,
+		Amount:               a.Amount,
+		ConvertCurrency:      a.ConvertCurrency,
+	}
+}
+
+// Location is the URL the approval can be fetched from
+func (a TransferApproval) Location() string {
+	return "/transfer-approvals/" + strconv.Itoa(a.TransferApprovalID)
+}
+
+// MarshalJSON formats the amount with the precision of the currency
+func (a TransferApproval) MarshalJSON() ([]byte, error) {
+	type Alias TransferApproval
+	return json.Marshal(&struct {
+		Alias
+		Amount string `json:"amount"`
+	}{
+		Alias:  Alias(a),
+		Amount: a.Amount.Format(a.Currency),
+	})
+}
+
+// ApprovalDecision approves or rejects a transfer, Reason is kept with the decision
+type ApprovalDecision struct {
+	Reason string `json:"reason"`
+}
+
+func (d *ApprovalDecision) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	if dec.field("reason", &d.Reason, false) && (len(d.Reason) < 1 || len(d.Reason) > 255) {
+		dec.fail("reason", FieldOutOfRange, "must be between 1 and 255 characters")
+	}
+	return dec.err()
+}
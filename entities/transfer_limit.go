@@ -0,0 +1,70 @@
+package entities
+
+import (
+	"fmt"
+)
+
+// Names of the limits of a TransferLimitPolicy, used to say which limit a transfer hit
+const (
+	LimitMaxPerTransaction   = "max_per_transaction"
+	LimitMaxPerDay           = "max_per_day"
+	LimitMaxPer30Days        = "max_per_30_days"
+	LimitMaxTransfersPerHour = "max_transfers_per_hour"
+)
+
+// TransferLimitPolicy caps the money leaving an account. A policy is attached either to a single account or to
+// every account of an account type holding Currency, and a transfer has to stay within all the policies that apply
+// to its source. Amounts are in Currency, which for a single account is the currency of the account.
+// A nil limit is not enforced.
+// Per day is the current calendar day of the database clock, the 30 days and the hour are rolling windows.
+type TransferLimitPolicy struct {
+	AccountID           *int     `json:"account_id,omitempty"`
+	AccountType         *string  `json:"account_type,omitempty"`
+	Currency            Currency `json:"currency"`
+	MaxPerTransaction   *Money   `json:"max_per_transaction"`
+	MaxPerDay           *Money   `json:"max_per_day"`
+	MaxPer30Days        *Money   `json:"max_per_30_days"`
+	MaxTransfersPerHour *int     `json:"max_transfers_per_hour"`
+}
+
+// UnmarshalJSON does not accept the account or account type, they come from the URL. The currency is optional, it
+// only has to be given to make sure the limits are read in the currency they are meant in.
+func (p *TransferLimitPolicy) UnmarshalJSON(data []byte) error {
+	dec, err := decodeObject(data)
+	if err != nil {
+		return err
+	}
+	dec.currency("currency", &p.Currency, false)
+	for _, limit := range []struct {
+		name   string
+		amount **Money
+	}{
+		{LimitMaxPerTransaction, &p.MaxPerTransaction},
+		{LimitMaxPerDay, &p.MaxPerDay},
+		{LimitMaxPer30Days, &p.MaxPer30Days},
+	} {
+		if dec.field(limit.name, limit.amount, false) && **limit.amount < 0 {
+			dec.fail(limit.name, FieldOutOfRange, "cannot be negative")
+		}
+	}
+	if dec.field(LimitMaxTransfersPerHour, &p.MaxTransfersPerHour, false) && *p.MaxTransfersPerHour < 0 {
+		dec.fail(LimitMaxTransfersPerHour, FieldOutOfRange, "cannot be negative")
+	}
+	return dec.err()
+}
+
+// LimitExceededError is returned when a transfer would go over one of the limits of a policy.
+// Max is the amount limit formatted in the currency of the policy, or the maximum count for LimitMaxTransfersPerHour.
+type LimitExceededError struct {
+	Limit string
+	Max   string
+}
+
+func (e *LimitExceededError) Error() string {
+	return fmt.Sprintf("transfer limit exceeded: %s is %s", e.Limit, e.Max)
+}
+
+// IsVelocityLimit reports whether the limit counts transfers rather than summing amounts
+func (e *LimitExceededError) IsVelocityLimit() bool {
+	return e.Limit == LimitMaxTransfersPerHour
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	. "takeHomeAssignment/entities"
+)
+
+func uploadExchangeRates(w http.ResponseWriter, r *http.Request) {
+	// Every rate is validated before any of them is stored
+	var rates ExchangeRates
+	err := DecodeRequest(r.Body, &rates)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = store.UpsertExchangeRates(rates)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(rates)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getExchangeRate(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	base, err := ParseCurrency(vars["base_currency"])
+	if err != nil {
+		writeError(w, r, invalidParameter("base_currency", err.Error()))
+		return
+	}
+	quote, err := ParseCurrency(vars["quote_currency"])
+	if err != nil {
+		writeError(w, r, invalidParameter("quote_currency", err.Error()))
+		return
+	}
+
+	rate := ExchangeRate{}
+	err = store.QueryCurrentExchangeRate(base, quote, &rate)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(rate)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
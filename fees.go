@@ -0,0 +1,43 @@
+package main
+
+import (
+	"encoding/json"
+	"log"
+	"net/http"
+	. "takeHomeAssignment/entities"
+)
+
+// setFeeSchedule creates or replaces the fee schedule for an account type and currency
+func setFeeSchedule(w http.ResponseWriter, r *http.Request) {
+	var schedule FeeSchedule
+	err := DecodeRequest(r.Body, &schedule)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = store.UpsertFeeSchedule(&schedule)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(schedule)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getFeeSchedules(w http.ResponseWriter, r *http.Request) {
+	var schedules []FeeSchedule
+	err := store.QueryFeeSchedules(&schedules)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(schedules)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
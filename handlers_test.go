@@ -0,0 +1,286 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/lib/pq"
+	"github.com/stretchr/testify/assert"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"strings"
+	"sync"
+	. "takeHomeAssignment/db"
+	. "takeHomeAssignment/entities"
+	"testing"
+)
+
+// testStores opens an empty store of every backend, the Postgres one in a container
+var testStores = []struct {
+	name string
+	open func(t *testing.T) Store
+}{
+	{"memory", func(t *testing.T) Store {
+		return NewMemoryStore()
+	}},
+	{"sqlite", func(t *testing.T) Store {
+		sqliteStore, err := OpenSQLiteStore(filepath.Join(t.TempDir(), "test.db"))
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		t.Cleanup(func() { sqliteStore.DB.Close() })
+		return sqliteStore
+	}},
+	{"postgres", func(t *testing.T) Store {
+		db, err := CreatePostgresContainer(context.Background())
+		if !assert.NoError(t, err) {
+			t.FailNow()
+		}
+		t.Cleanup(func() { db.Close() })
+		return NewPostgresStore(db)
+	}},
+}
+
+// forEachStore runs the test once per backend, with store set to an empty store of that backend
+func forEachStore(t *testing.T, test func(t *testing.T)) {
+	for _, backend := range testStores {
+		t.Run(backend.name, func(t *testing.T) {
+			store = backend.open(t)
+			test(t)
+		})
+	}
+}
+
+// serve sends the request to the handlers, backed by whatever store is set
+func serve(method string, path string, body string, headers map[string]string) *httptest.ResponseRecorder {
+	request := httptest.NewRequest(method, path, strings.NewReader(body))
+	for name, value := range headers {
+		request.Header.Set(name, value)
+	}
+	response := httptest.NewRecorder()
+	newRouter().ServeHTTP(response, request)
+	return response
+}
+
+func TestAccountHandlers(t *testing.T) {
+	forEachStore(t, testAccountHandlers)
+}
+
+func testAccountHandlers(t *testing.T) {
+
+	response := serve("POST", "/accounts", `{"account_id": 1, "balance": "100.5"}`, nil)
+	assert.Equal(t, http.StatusCreated, response.Code)
+
+	response = serve("POST", "/accounts", `{"account_id": 1, "balance": "1"}`, nil)
+	assert.Equal(t, http.StatusConflict, response.Code)
+	assert.Equal(t, "duplicate_account", problemCode(t, response))
+
+	response = serve("GET", "/accounts/1", "", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	account := map[string]interface{}{}
+	err := json.Unmarshal(response.Body.Bytes(), &account)
+	assert.NoError(t, err)
+	assert.Equal(t, "100.50", account["balance"])
+	assert.Equal(t, AccountStatusActive, account["status"])
+
+	response = serve("GET", "/accounts/2", "", nil)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, "account_not_found", problemCode(t, response))
+	response = serve("GET", "/accounts/x", "", nil)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	assert.Equal(t, "validation_failed", problemCode(t, response))
+}
+
+// problemCode checks that the response is a problem and returns its code
+func problemCode(t *testing.T, response *httptest.ResponseRecorder) string {
+	assert.Equal(t, problemContentType, response.Header().Get("Content-Type"))
+	var p problem
+	err := json.Unmarshal(response.Body.Bytes(), &p)
+	assert.NoError(t, err)
+	assert.Equal(t, response.Code, p.Status)
+	return p.Code
+}
+
+func TestProblemResponses(t *testing.T) {
+	store = NewMemoryStore()
+
+	// Every field at fault is listed by its JSON pointer into the request body
+	response := serve("POST", "/transactions", `{"source_account_id": 1, "destination_account_id": 2}`, nil)
+	assert.Equal(t, http.StatusBadRequest, response.Code)
+	var p problem
+	err := json.Unmarshal(response.Body.Bytes(), &p)
+	assert.NoError(t, err)
+	assert.Equal(t, "validation_failed", p.Code)
+	assert.Equal(t, "/transactions", p.Instance)
+	if assert.Len(t, p.Errors, 1) {
+		assert.Equal(t, "#/amount", p.Errors[0].Pointer)
+		assert.Equal(t, FieldMissing, p.Errors[0].Code)
+	}
+
+	response = serve("POST", "/transactions", `{"source_account_id": "1", "destination_account_id": 2, "amount": "1", "memo": "x"}`, nil)
+	assert.Equal(t, "validation_failed", problemCode(t, response))
+	assert.Contains(t, response.Body.String(), `{"pointer":"#/source_account_id","code":"wrong_type"`)
+	assert.Contains(t, response.Body.String(), `{"pointer":"#/memo","code":"unknown_field"`)
+
+	response = serve("GET", "/accounts/x", "", nil)
+	assert.Contains(t, response.Body.String(), `{"parameter":"account_id","code":"invalid"`)
+
+	response = serve("POST", "/transactions", `{`, nil)
+	assert.Equal(t, "validation_failed", problemCode(t, response))
+
+	response = serve("GET", "/nowhere", "", nil)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+	assert.Equal(t, "route_not_found", problemCode(t, response))
+	response = serve("DELETE", "/accounts/1", "", nil)
+	assert.Equal(t, http.StatusMethodNotAllowed, response.Code)
+	assert.Equal(t, "method_not_allowed", problemCode(t, response))
+}
+
+func TestConstraintProblems(t *testing.T) {
+	tests := []struct {
+		constraint string
+		code       string
+		status     int
+	}{
+		{"account_balance_overdraft_check", "insufficient_funds", http.StatusBadRequest},
+		{"account_balance_account_id_key", "duplicate_account", http.StatusConflict},
+		{"holds_status_check", "constraint_violation", http.StatusConflict},
+	}
+	for _, tt := range tests {
+		t.Run(tt.constraint, func(t *testing.T) {
+			err := fmt.Errorf("processing transaction: %w", &pq.Error{Code: "23514", Constraint: tt.constraint})
+			p := problemFor(err)
+			assert.Equal(t, tt.code, p.Code)
+			assert.Equal(t, tt.status, p.Status)
+			assert.False(t, isRetryableError(err))
+		})
+	}
+
+	// Only violations are answered by their constraint, a serialization failure is still retried
+	assert.True(t, isRetryableError(&pq.Error{Code: "40001"}))
+}
+
+func TestTransactionHandlers(t *testing.T) {
+	forEachStore(t, testTransactionHandlers)
+}
+
+func testTransactionHandlers(t *testing.T) {
+	serve("POST", "/accounts", `{"account_id": 1, "balance": "100"}`, nil)
+	serve("POST", "/accounts", `{"account_id": 2, "balance": "1"}`, nil)
+	serve("POST", "/accounts", `{"account_id": 3, "balance": "1", "currency": "EUR"}`, nil)
+
+	tests := []struct {
+		name     string
+		body     string
+		expected int
+		code     string
+	}{
+		{"Transfers", `{"source_account_id": 1, "destination_account_id": 2, "amount": "40"}`, http.StatusCreated, ""},
+		{"Insufficient balance", `{"source_account_id": 1, "destination_account_id": 2, "amount": "60.01"}`, http.StatusBadRequest, "insufficient_funds"},
+		{"Missing account", `{"source_account_id": 1, "destination_account_id": 4, "amount": "1"}`, http.StatusNotFound, "account_not_found"},
+		{"Same account", `{"source_account_id": 1, "destination_account_id": 1, "amount": "1"}`, http.StatusBadRequest, "same_account"},
+		{"Different currency", `{"source_account_id": 1, "destination_account_id": 3, "amount": "1"}`, http.StatusBadRequest, "currency_mismatch"},
+		{"Extra field", `{"source_account_id": 1, "destination_account_id": 2, "amount": "1", "memo": "x"}`, http.StatusBadRequest, "validation_failed"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			response := serve("POST", "/transactions", tt.body, nil)
+			assert.Equal(t, tt.expected, response.Code, response.Body.String())
+			if tt.code != "" {
+				assert.Equal(t, tt.code, problemCode(t, response))
+			}
+		})
+	}
+
+	response := serve("GET", "/transactions/1", "", nil)
+	assert.Equal(t, http.StatusOK, response.Code)
+	record := map[string]interface{}{}
+	err := json.Unmarshal(response.Body.Bytes(), &record)
+	assert.NoError(t, err)
+	assert.Equal(t, "60.00", record["source_balance_after"])
+	response = serve("GET", "/transactions/2", "", nil)
+	assert.Equal(t, http.StatusNotFound, response.Code)
+
+	// A retry with the same key replays the first response instead of transferring again
+	key := map[string]string{idempotencyKeyHeader: "retry"}
+	body := `{"source_account_id": 1, "destination_account_id": 2, "amount": "10"}`
+	first := serve("POST", "/transactions", body, key)
+	assert.Equal(t, http.StatusCreated, first.Code)
+	retry := serve("POST", "/transactions", body, key)
+	assert.Equal(t, http.StatusCreated, retry.Code)
+	assert.Equal(t, first.Body.String(), retry.Body.String())
+	assert.Equal(t, "/transactions/2", retry.Header().Get("Location"))
+	other := serve("POST", "/transactions", `{"source_account_id": 1, "destination_account_id": 2, "amount": "11"}`, key)
+	assert.Equal(t, http.StatusUnprocessableEntity, other.Code)
+	assert.Equal(t, "idempotency_key_reused", problemCode(t, other))
+}
+
+func TestNotSupportedHandlers(t *testing.T) {
+	forEachStore(t, testNotSupportedHandlers)
+}
+
+func testNotSupportedHandlers(t *testing.T) {
+	if _, ok := store.(*PostgresStore); ok {
+		t.Skip("the postgres backend has every feature")
+	}
+	serve("POST", "/accounts", `{"account_id": 1, "balance": "100"}`, nil)
+	serve("POST", "/accounts", `{"account_id": 2, "balance": "1"}`, nil)
+
+	// The features beyond accounts and transfers are routed with every backend and answered as not implemented
+	tests := []struct {
+		method string
+		path   string
+		body   string
+	}{
+		{"GET", "/accounts/1/transactions", ""},
+		{"POST", "/admin/accounts/1/status", `{"status": "frozen", "reason": "review"}`},
+		{"POST", "/admin/accounts/1/overdraft", `{"overdraft_limit": "10"}`},
+		{"GET", "/admin/accounts/1/limits", ""},
+		{"GET", "/admin/fee-schedules", ""},
+		{"POST", "/transactions/batch", `{"transactions": [{"source_account_id": 1, "destination_account_id": 2, "amount": "1"}]}`},
+		{"POST", "/holds", `{"source_account_id": 1, "destination_account_id": 2, "amount": "1"}`},
+		{"GET", "/scheduled-transfers/1", ""},
+		{"GET", "/exchange-rates/EUR/USD", ""},
+	}
+	for _, tt := range tests {
+		t.Run(tt.method+" "+tt.path, func(t *testing.T) {
+			response := serve(tt.method, tt.path, tt.body, nil)
+			assert.Equal(t, http.StatusNotImplemented, response.Code, response.Body.String())
+			assert.Equal(t, "not_supported", problemCode(t, response))
+		})
+	}
+}
+
+func TestStoreConcurrentTransactions(t *testing.T) {
+	forEachStore(t, testStoreConcurrentTransactions)
+}
+
+func testStoreConcurrentTransactions(t *testing.T) {
+	serve("POST", "/accounts", `{"account_id": 1, "balance": "100"}`, nil)
+	serve("POST", "/accounts", `{"account_id": 2, "balance": "100"}`, nil)
+
+	// 150 transfers of 1 each way, of which only the first 100 out of each account can succeed without the other direction
+	var wg sync.WaitGroup
+	for i := 0; i < 150; i++ {
+		for _, accounts := range [][2]int{{1, 2}, {2, 1}} {
+			wg.Add(1)
+			go func(source int, destination int) {
+				defer wg.Done()
+				serve("POST", "/transactions", fmt.Sprintf(`{"source_account_id": %d, "destination_account_id": %d, "amount": "1"}`, source, destination), nil)
+			}(accounts[0], accounts[1])
+		}
+	}
+	wg.Wait()
+
+	// Whatever the interleaving, no money was created or lost and no balance went negative
+	var total Money
+	for _, accountID := range []int{1, 2} {
+		account := Account{}
+		err := store.QueryAccountByAccountId(accountID, &account)
+		assert.NoError(t, err)
+		assert.GreaterOrEqual(t, account.Balance, Money(0))
+		total += account.Balance
+	}
+	assert.Equal(t, money("200"), total)
+}
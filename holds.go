@@ -0,0 +1,131 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	. "takeHomeAssignment/db"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+func createHold(w http.ResponseWriter, r *http.Request) {
+	var request HoldRequest
+	err := DecodeRequest(r.Body, &request)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if request.SourceAccountID == request.DestinationAccountID {
+		writeError(w, r, ErrSameAccount)
+		return
+	}
+
+	hold := Hold{}
+	err = store.CreateHold(&request, &hold)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", hold.Location())
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(hold)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getHold(w http.ResponseWriter, r *http.Request) {
+	holdID, err := strconv.Atoi(mux.Vars(r)["hold_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("hold_id", "must be an integer"))
+		return
+	}
+
+	hold := Hold{}
+	err = store.QueryHoldById(holdID, &hold)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(hold)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func captureHold(w http.ResponseWriter, r *http.Request) {
+	holdID, err := strconv.Atoi(mux.Vars(r)["hold_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("hold_id", "must be an integer"))
+		return
+	}
+	// An empty body captures the full held amount
+	var request CaptureRequest
+	err = DecodeRequest(r.Body, &request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, err)
+		return
+	}
+
+	hold := Hold{}
+	record := TransactionRecord{}
+	err = store.CaptureHold(holdID, request.Amount, &hold, &record)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", record.Location())
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(record)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func voidHold(w http.ResponseWriter, r *http.Request) {
+	holdID, err := strconv.Atoi(mux.Vars(r)["hold_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("hold_id", "must be an integer"))
+		return
+	}
+
+	hold := Hold{}
+	err = store.VoidHold(holdID, &hold)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(hold)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// expireHolds runs until ctx is done, releasing the funds of holds that have passed their expiry
+func expireHolds(ctx context.Context, interval time.Duration) {
+	for range tick(ctx, interval) {
+		for ctx.Err() == nil {
+			expired, err := store.ExpireHolds(100)
+			if err != nil {
+				log.Println("Failed to expire holds:", err)
+				break
+			}
+			if expired > 0 {
+				log.Println("Expired holds:", expired)
+			}
+			if expired < 100 {
+				break
+			}
+		}
+	}
+}
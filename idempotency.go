@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+const idempotencyKeyHeader = "Idempotency-Key"
+
+const maxIdempotencyKeyLength = 255
+
+// newIdempotencyKey returns nil if the client did not send an Idempotency-Key header
+func newIdempotencyKey(r *http.Request, scope string, request interface{}) (*IdempotencyKey, error) {
+	key := r.Header.Get(idempotencyKeyHeader)
+	if key == "" {
+		return nil, nil
+	}
+	if len(key) > maxIdempotencyKeyLength {
+		return nil, invalidParameter(idempotencyKeyHeader, "cannot be longer than 255 characters")
+	}
+	fingerprint, err := RequestFingerprint(request)
+	if err != nil {
+		return nil, err
+	}
+	return &IdempotencyKey{Key: key, Scope: scope, Fingerprint: fingerprint}, nil
+}
+
+// replayIdempotentRequest writes the response to the request that first used the key,
+// and returns false if the key has not been used yet so the request should be processed
+func replayIdempotentRequest(w http.ResponseWriter, r *http.Request, idempotencyKey *IdempotencyKey) bool {
+	stored := IdempotencyKey{}
+	err := store.QueryIdempotencyKey(idempotencyKey.Scope, idempotencyKey.Key, &stored)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return false
+		}
+		writeError(w, r, err)
+		return true
+	}
+
+	if stored.Fingerprint != idempotencyKey.Fingerprint {
+		writeError(w, r, errIdempotencyKeyReused)
+		return true
+	}
+	if stored.ResponseLocation != "" {
+		w.Header().Set("Location", stored.ResponseLocation)
+	}
+	w.WriteHeader(stored.ResponseStatus)
+	_, err = w.Write(stored.ResponseBody)
+	if err != nil {
+		log.Println("Failed to replay idempotent response:", err)
+	}
+	return true
+}
+
+// purgeExpiredIdempotencyKeys runs until ctx is done, deleting keys that are past the retention window
+func purgeExpiredIdempotencyKeys(ctx context.Context, interval time.Duration) {
+	for range tick(ctx, interval) {
+		deleted, err := store.DeleteExpiredIdempotencyKeys()
+		if err != nil {
+			log.Println("Failed to delete expired idempotency keys:", err)
+			continue
+		}
+		if deleted > 0 {
+			log.Println("Deleted expired idempotency keys:", deleted)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	. "takeHomeAssignment/db"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+// setInterestRate makes an account earn interest, or changes the rate it earns from the next accrual on
+func setInterestRate(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(mux.Vars(r)["account_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("account_id", "must be an integer"))
+		return
+	}
+	var rate InterestRate
+	err = DecodeRequest(r.Body, &rate)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	rate.AccountID = accountID
+	err = store.SetInterestRate(&rate)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(rate)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getInterestRate(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(mux.Vars(r)["account_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("account_id", "must be an integer"))
+		return
+	}
+
+	rate := InterestRate{AccountID: accountID}
+	err = store.QueryInterestRate(&rate)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(rate)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getInterestAccruals(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(mux.Vars(r)["account_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("account_id", "must be an integer"))
+		return
+	}
+
+	var accruals []InterestAccrual
+	err = store.QueryInterestAccruals(accountID, &accruals)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(accruals)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// accrueInterest runs until ctx is done. Every tick it accrues the interest of every day up to yesterday that has not
+// been accrued yet, including days the server was down, and posts the interest accrued in previous months, both of
+// which do nothing if they have already been done.
+func accrueInterest(ctx context.Context, interval time.Duration) {
+	for range tick(ctx, interval) {
+		now := time.Now()
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+		accrued, err := store.AccrueMissingInterest(today.AddDate(0, 0, -1))
+		if err != nil {
+			log.Println("Failed to accrue interest:", err)
+			continue
+		}
+		if accrued > 0 {
+			log.Println("Accrued interest for accounts:", accrued)
+		}
+
+		monthStart := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, now.Location())
+		accountIDs, err := store.QueryAccountsWithUnpostedInterest(monthStart)
+		if err != nil {
+			log.Println("Failed to find interest to post:", err)
+			continue
+		}
+		for _, accountID := range accountIDs {
+			if ctx.Err() != nil {
+				break
+			}
+			record := TransactionRecord{}
+			err = store.PostInterest(accountID, monthStart, &record)
+			if err != nil {
+				if !errors.Is(err, ErrNoInterestToPost) {
+					log.Println("Failed to post interest for account", accountID, ":", err)
+				}
+				continue
+			}
+			log.Println("Posted interest for account", accountID, "as transaction", record.TransactionID)
+		}
+	}
+}
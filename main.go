@@ -1,79 +1,267 @@
 package main
 
 import (
+	"context"
 	"database/sql"
 	"encoding/json"
 	"errors"
+	"flag"
 	"fmt"
-	"github.com/asaskevich/govalidator"
 	"github.com/gorilla/mux"
-	"github.com/lib/pq"
 	"log"
 	"net/http"
+	"os"
+	"os/signal"
 	"strconv"
+	"sync"
+	"syscall"
+	"takeHomeAssignment/config"
 	. "takeHomeAssignment/db"
 	. "takeHomeAssignment/entities"
+	"time"
 )
 
-var DB *sql.DB
+// store is used by the handlers and the background workers
+var store Store
+
+// maxTransactionAttempts is how many times a transfer failing on a concurrency error is tried, set from the config
+var maxTransactionAttempts = 3
 
 func main() {
-	var err error
-	connString := fmt.Sprintf(
-		"host=%s port=%d user=%s password=%s dbname=%s sslmode=disable",
-		"0.0.0.0", 5432, "myuser", "mypassword", "mydb",
-	)
-	DB, err = sql.Open("postgres", connString)
+	configPath := flag.String("config", os.Getenv("CONFIG_FILE"), "YAML or JSON config file, overridden by environment variables")
+	printConfig := flag.Bool("print-config", false, "print the configuration with secrets redacted and exit")
+	flag.Usage = func() {
+		fmt.Fprintf(flag.CommandLine.Output(), "Usage: %s [flags] [migrate up | migrate down [steps] | migrate status]\n", os.Args[0])
+		flag.PrintDefaults()
+	}
+	flag.Parse()
+
+	cfg, err := config.Load(*configPath, os.LookupEnv)
+	if *printConfig {
+		out, marshalErr := cfg.Redact().YAML()
+		if marshalErr != nil {
+			log.Fatal(marshalErr)
+		}
+		fmt.Print(string(out))
+	}
+	if err != nil {
+		log.Fatalf("Invalid configuration:\n%v", err)
+	}
+	if *printConfig {
+		return
+	}
+	maxTransactionAttempts = cfg.Transactions.MaxAttempts
+
+	// DB is the Postgres database, nil with the other backends. storeDB is the database of the store, closed once
+	// the server has shut down.
+	var DB, storeDB *sql.DB
+	switch cfg.Storage.Backend {
+	case config.BackendMemory:
+		store = NewMemoryStore()
+	case config.BackendSQLite:
+		sqliteStore, openErr := OpenSQLiteStore(cfg.Storage.SQLitePath)
+		if openErr != nil {
+			log.Fatal(openErr)
+		}
+		storeDB = sqliteStore.DB
+		store = sqliteStore
+	default:
+		DB, err = sql.Open("postgres", cfg.Database.DataSourceName())
+		if err != nil {
+			log.Fatal(err)
+		}
+		DB.SetMaxOpenConns(cfg.Database.MaxOpenConns)
+		DB.SetMaxIdleConns(cfg.Database.MaxIdleConns)
+		DB.SetConnMaxLifetime(time.Duration(cfg.Database.ConnMaxLifetime))
+		storeDB = DB
+		store = NewPostgresStore(DB)
+	}
+
+	if flag.Arg(0) == "migrate" {
+		if DB == nil {
+			log.Fatal("migrate only applies to the postgres storage backend")
+		}
+		err = migrate(DB, flag.Args()[1:])
+		DB.Close()
+		if err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if DB != nil && cfg.Database.AutoMigrate {
+		err = migrate(DB, []string{"up"})
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	// SIGTERM or an interrupt starts the shutdown, and stops the background workers
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGTERM, os.Interrupt)
+	defer stop()
+	router := newRouter()
+
+	// The other workers run features that only the Postgres store has
+	var workers sync.WaitGroup
+	startWorker(ctx, &workers, purgeExpiredIdempotencyKeys, time.Hour)
+	if DB != nil {
+		startWorker(ctx, &workers, expireHolds, time.Minute)
+		startWorker(ctx, &workers, accrueInterest, time.Hour)
+		startWorker(ctx, &workers, executeScheduledTransfers, 10*time.Second)
+		startWorker(ctx, &workers, executeStandingOrders, 10*time.Second)
+		startWorker(ctx, &workers, expireTransferApprovals, time.Minute)
+	}
+
+	server := &http.Server{
+		Addr:              cfg.Server.ListenAddress,
+		Handler:           router,
+		ReadTimeout:       time.Duration(cfg.Server.ReadTimeout),
+		ReadHeaderTimeout: time.Duration(cfg.Server.ReadHeaderTimeout),
+		WriteTimeout:      time.Duration(cfg.Server.WriteTimeout),
+		IdleTimeout:       time.Duration(cfg.Server.IdleTimeout),
+	}
+	serverErr := make(chan error, 1)
+	go func() {
+		if cfg.Server.TLSCertFile != "" {
+			serverErr <- server.ListenAndServeTLS(cfg.Server.TLSCertFile, cfg.Server.TLSKeyFile)
+		} else {
+			serverErr <- server.ListenAndServe()
+		}
+	}()
+	fmt.Println("Server started on", cfg.Server.ListenAddress)
+
+	exitCode := 0
+	select {
+	case err = <-serverErr:
+		log.Println("Server failed:", err)
+		exitCode = 1
+	case <-ctx.Done():
+		log.Println("Shutting down")
+	}
+	stop()
+
+	// Stop accepting, let the requests in flight and the runs of the background workers finish, and only then close
+	// the database, all within the shutdown timeout
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), time.Duration(cfg.Server.ShutdownTimeout))
+	defer cancel()
+	err = server.Shutdown(shutdownCtx)
 	if err != nil {
-		log.Fatal(err)
+		log.Println("Failed to finish the requests in flight:", err)
+		exitCode = 1
 	}
-	defer func(DB *sql.DB) {
-		err := DB.Close()
+	workersDone := make(chan struct{})
+	go func() {
+		workers.Wait()
+		close(workersDone)
+	}()
+	select {
+	case <-workersDone:
+	case <-shutdownCtx.Done():
+		log.Println("Failed to finish the background workers:", shutdownCtx.Err())
+		exitCode = 1
+	}
+	if storeDB != nil {
+		err = storeDB.Close()
 		if err != nil {
 			log.Println(err)
+			exitCode = 1
 		}
-	}(DB)
+	}
+	log.Println("Shut down")
+	os.Exit(exitCode)
+}
+
+// newRouter routes the requests to the handlers. Every feature is routed whatever the backend, the features the store
+// does not have are answered with not_supported.
+func newRouter() *mux.Router {
 	router := mux.NewRouter()
+	router.NotFoundHandler = http.HandlerFunc(routeNotFound)
+	router.MethodNotAllowedHandler = http.HandlerFunc(methodNotAllowed)
 	router.HandleFunc("/accounts/{account_id}", getAccount).Methods("GET")
 	router.HandleFunc("/accounts", createAccount).Methods("POST")
 	router.HandleFunc("/transactions", addTransaction).Methods("POST")
-
-	fmt.Println("Server started on port 8080")
-	log.Fatal(http.ListenAndServe(":8080", router))
-
-}
-
-func init() {
-	govalidator.SetFieldsRequiredByDefault(true)
-
+	router.HandleFunc("/transactions/{transaction_id}", getTransaction).Methods("GET")
+	router.HandleFunc("/accounts/{account_id}/transactions", getAccountTransactions).Methods("GET")
+	router.HandleFunc("/accounts/{account_id}/interest-accruals", getInterestAccruals).Methods("GET")
+	router.HandleFunc("/admin/accounts/{account_id}/status", changeAccountStatus).Methods("POST")
+	router.HandleFunc("/admin/accounts/{account_id}/status-changes", getAccountStatusChanges).Methods("GET")
+	router.HandleFunc("/admin/accounts/{account_id}/overdraft", setOverdraft).Methods("POST")
+	router.HandleFunc("/admin/accounts/{account_id}/limits", setAccountTransferLimits).Methods("POST")
+	router.HandleFunc("/admin/accounts/{account_id}/limits", getAccountTransferLimits).Methods("GET")
+	router.HandleFunc("/admin/account-types/{account_type}/limits/{currency}", setAccountTypeTransferLimits).Methods("POST")
+	router.HandleFunc("/admin/account-types/{account_type}/limits/{currency}", getAccountTypeTransferLimits).Methods("GET")
+	router.HandleFunc("/admin/accounts/{account_id}/interest", setInterestRate).Methods("POST")
+	router.HandleFunc("/admin/accounts/{account_id}/interest", getInterestRate).Methods("GET")
+	router.HandleFunc("/admin/approval-policies", setApprovalPolicy).Methods("POST")
+	router.HandleFunc("/admin/approval-policies", getApprovalPolicies).Methods("GET")
+	router.HandleFunc("/admin/fee-schedules", setFeeSchedule).Methods("POST")
+	router.HandleFunc("/admin/fee-schedules", getFeeSchedules).Methods("GET")
+	router.HandleFunc("/transactions/batch", addTransactionBatch).Methods("POST")
+	router.HandleFunc("/transactions/batch/{batch_id}", getTransactionBatch).Methods("GET")
+	router.HandleFunc("/transactions/{transaction_id}/reversals", reverseTransaction).Methods("POST")
+	router.HandleFunc("/transfer-approvals", getTransferApprovals).Methods("GET")
+	router.HandleFunc("/transfer-approvals/{transfer_approval_id}", getTransferApproval).Methods("GET")
+	router.HandleFunc("/transfer-approvals/{transfer_approval_id}/approve", approveTransfer).Methods("POST")
+	router.HandleFunc("/transfer-approvals/{transfer_approval_id}/reject", rejectTransfer).Methods("POST")
+	router.HandleFunc("/scheduled-transfers", createScheduledTransfer).Methods("POST")
+	router.HandleFunc("/scheduled-transfers", getScheduledTransfers).Methods("GET")
+	router.HandleFunc("/scheduled-transfers/{scheduled_transfer_id}", getScheduledTransfer).Methods("GET")
+	router.HandleFunc("/scheduled-transfers/{scheduled_transfer_id}/cancel", cancelScheduledTransfer).Methods("POST")
+	router.HandleFunc("/standing-orders", createStandingOrder).Methods("POST")
+	router.HandleFunc("/standing-orders/{standing_order_id}", getStandingOrder).Methods("GET")
+	router.HandleFunc("/standing-orders/{standing_order_id}/executions", getStandingOrderExecutions).Methods("GET")
+	router.HandleFunc("/standing-orders/{standing_order_id}/cancel", cancelStandingOrder).Methods("POST")
+	router.HandleFunc("/holds", createHold).Methods("POST")
+	router.HandleFunc("/holds/{hold_id}", getHold).Methods("GET")
+	router.HandleFunc("/holds/{hold_id}/capture", captureHold).Methods("POST")
+	router.HandleFunc("/holds/{hold_id}/void", voidHold).Methods("POST")
+	router.HandleFunc("/exchange-rates", uploadExchangeRates).Methods("POST")
+	router.HandleFunc("/exchange-rates/{base_currency}/{quote_currency}", getExchangeRate).Methods("GET")
+	return router
 }
 
 func createAccount(w http.ResponseWriter, r *http.Request) {
 	var account Account
-	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&account)
+	err := DecodeRequest(r.Body, &account)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// New accounts always start active, with nothing held and no overdraft
+	account.Status = AccountStatusActive
+	account.AvailableBalance = account.Balance
 
+	// A retried request with the same Idempotency-Key gets the original response instead of a duplicate account error
+	idempotencyKey, err := newIdempotencyKey(r, "POST /accounts", account)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
-	// Validate the account struct
-	_, err = govalidator.ValidateStruct(account)
+	if idempotencyKey != nil && replayIdempotentRequest(w, r, idempotencyKey) {
+		return
+	}
+	response, err := json.Marshal(account)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
+	if idempotencyKey != nil {
+		idempotencyKey.ResponseStatus = http.StatusCreated
+		idempotencyKey.ResponseBody = response
+	}
 
-	err = CreateAccount(DB, &account)
+	err = store.CreateAccount(&account, idempotencyKey)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		// A concurrent request with the same key won the race
+		if errors.Is(err, ErrIdempotencyKeyInUse) && replayIdempotentRequest(w, r, idempotencyKey) {
+			return
+		}
+		writeError(w, r, err)
 		return
 	}
 	w.WriteHeader(http.StatusCreated)
-	err = json.NewEncoder(w).Encode(account)
+	_, err = w.Write(response)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
-		return
+		log.Println("Failed to write response:", err)
 	}
 }
 
@@ -83,24 +271,19 @@ func getAccount(w http.ResponseWriter, r *http.Request) {
 	accountID, err := strconv.Atoi(vars["account_id"])
 
 	if err != nil {
-		http.Error(w, "Invalid account ID. It must be an integer.", http.StatusBadRequest)
+		writeError(w, r, invalidParameter("account_id", "must be an integer"))
 		return
 	}
 
-	err = QueryAccountByAccountId(DB, accountID, &account)
+	err = store.QueryAccountByAccountId(accountID, &account)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, "Account does not exist", http.StatusNotFound)
-		} else {
-			http.Error(w, err.Error(), http.StatusInternalServerError)
-		}
+		writeError(w, r, err)
 		return
 	}
 
 	err = json.NewEncoder(w).Encode(account)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
-		return
+		log.Println("Failed to write response:", err)
 	}
 
 }
@@ -108,90 +291,143 @@ func getAccount(w http.ResponseWriter, r *http.Request) {
 func addTransaction(w http.ResponseWriter, r *http.Request) {
 	var tx Transaction
 
-	decoder := json.NewDecoder(r.Body)
-	err := decoder.Decode(&tx)
+	err := DecodeRequest(r.Body, &tx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
-	// Validate the account struct
-	_, err = govalidator.ValidateStruct(tx)
+	err = validateTransaction(tx)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusBadRequest)
+		writeError(w, r, err)
 		return
 	}
 
-	if tx.Amount <= 0.0 {
-		http.Error(w, "transaction amount cannot be less than or equals to zero", http.StatusBadRequest)
+	// A retried request with the same Idempotency-Key gets the original response instead of a duplicate transfer
+	idempotencyKey, err := newIdempotencyKey(r, "POST /transactions", tx)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
-
-	// Check if both source and destination are the same, no updates needed
-	if tx.DestinationAccountID == tx.SourceAccountID {
-		http.Error(w, "Transferring to the same account is not allowed", http.StatusBadRequest)
+	if idempotencyKey != nil && replayIdempotentRequest(w, r, idempotencyKey) {
 		return
 	}
 
 	// Check that both accounts exist
-	account := Account{}
+	destAccount := Account{}
+	sourceAccount := Account{}
 
-	err = QueryAccountByAccountId(DB, tx.DestinationAccountID, &account)
+	err = store.QueryAccountByAccountId(tx.DestinationAccountID, &destAccount)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			log.Println("Destination Account does not exist during transfer of funds:", err)
-			http.Error(w, "Destination Account does not exist", http.StatusNotFound)
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
 		return
 	}
 
-	err = QueryAccountByAccountId(DB, tx.SourceAccountID, &account)
+	err = store.QueryAccountByAccountId(tx.SourceAccountID, &sourceAccount)
 	if err != nil {
-		if errors.Is(err, sql.ErrNoRows) {
-			http.Error(w, "Source Account does not exist", http.StatusNotFound)
-		}
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		writeError(w, r, err)
+		return
+	}
+
+	// Check that both accounts hold the same currency unless a conversion was asked for
+	if sourceAccount.Currency != destAccount.Currency && !tx.ConvertCurrency {
+		writeError(w, r, ErrCurrencyMismatch)
+		return
+	}
+	err = sourceAccount.Currency.ValidateAmount(tx.Amount)
+	if err != nil {
+		writeError(w, r, err)
 		return
 	}
 
-	// Check that the transfer out account has sufficient balance
-	if account.Balance < tx.Amount {
-		http.Error(w, "Insufficient balance for transaction to happen", http.StatusBadRequest)
+	if idempotencyKey != nil {
+		idempotencyKey.ResponseStatus = http.StatusCreated
+	}
+
+	// Check that the transfer out account has sufficient available balance for the transfer and its fee,
+	// counting its overdraft
+	fee := Fee{}
+	err = store.QueryTransferFee(&tx, &fee)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if !sourceAccount.CanSpend(tx.Amount + fee.Amount) {
+		writeError(w, r, ErrInsufficientBalance)
 		return
 	}
+
+	// Transfers over the approval threshold of the currency wait for a second principal instead
+	policy := ApprovalPolicy{Currency: sourceAccount.Currency}
+	err = store.QueryApprovalPolicy(&policy)
+	if err != nil && !errors.Is(err, sql.ErrNoRows) {
+		writeError(w, r, err)
+		return
+	}
+	if err == nil && policy.RequiresApproval(tx.Amount) {
+		requestTransferApproval(w, r, &tx, &policy, idempotencyKey)
+		return
+	}
+
 	// Perform the transfer
-	// Retry the transaction up to 3 times if there is a concurrency error
-	for i := 0; i < 3; i++ {
-		err = ProcessTransaction(DB, &tx)
-		if err == nil {
+	// Retry the transaction if there is a concurrency error
+	record := TransactionRecord{}
+	for i := 0; i < maxTransactionAttempts; i++ {
+		err = store.ProcessTransaction(&tx, idempotencyKey, &record)
+		if err == nil || !isRetryableError(err) {
 			break
 		}
-		if err != nil {
-			var pqErr *pq.Error
-			if errors.As(err, &pqErr) {
-				// 23514 is the PostgreSQL error code for check constraint violation
-				if pqErr.Code == "23514" {
-					http.Error(w, "Insufficient balance for transaction to happen", http.StatusBadRequest)
-					// No need for retry because it is not a concurrency issue
-					return
-				} else {
-					log.Println("Unknown error when processing transaction:", err)
-				}
-			} else {
-				log.Println("Unknown error when processing transaction:", err)
-			}
-
-		}
+		log.Println("Unknown error when processing transaction:", err)
 	}
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		// A concurrent request with the same key won the race
+		if errors.Is(err, ErrIdempotencyKeyInUse) && replayIdempotentRequest(w, r, idempotencyKey) {
+			return
+		}
+		writeError(w, r, err)
 		return
 	}
 
+	// Written exactly like the response stored with the idempotency key, so that a replay is byte for byte the same
+	response, err := json.Marshal(record)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", record.Location())
 	w.WriteHeader(http.StatusCreated)
-	response := "Transaction successful"
-	_, err = w.Write([]byte(response))
+	_, err = w.Write(response)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// validateTransaction runs the checks across fields that decoding the transaction does not
+func validateTransaction(tx Transaction) error {
+	// Check if both source and destination are the same, no updates needed
+	if tx.DestinationAccountID == tx.SourceAccountID {
+		return ErrSameAccount
+	}
+	return nil
+}
+
+func getTransaction(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	record := TransactionRecord{}
+	transactionID, err := strconv.Atoi(vars["transaction_id"])
+
+	if err != nil {
+		writeError(w, r, invalidParameter("transaction_id", "must be an integer"))
+		return
+	}
+
+	err = store.QueryTransactionById(transactionID, &record)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(record)
 	if err != nil {
-		http.Error(w, err.Error(), http.StatusInternalServerError)
+		log.Println("Failed to write response:", err)
 	}
 }
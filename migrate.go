@@ -0,0 +1,61 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+	. "takeHomeAssignment/db"
+)
+
+// migrate runs the migrate subcommand: "up" applies the pending migrations, "down [steps]" reverts the last steps
+// migrations, one by default, and "status" prints the version of the database
+func migrate(DB *sql.DB, args []string) error {
+	ctx := context.Background()
+	if len(args) == 0 {
+		return fmt.Errorf("migrate needs up, down or status")
+	}
+	switch {
+	case args[0] == "up" && len(args) == 1:
+		applied, err := MigrateUp(ctx, DB)
+		for _, version := range applied {
+			log.Println("Applied migration", version)
+		}
+		return err
+	case args[0] == "down" && len(args) <= 2:
+		steps := 1
+		if len(args) == 2 {
+			var err error
+			steps, err = strconv.Atoi(args[1])
+			if err != nil || steps < 1 {
+				return fmt.Errorf("migrate down needs a positive number of steps, got %q", args[1])
+			}
+		}
+		reverted, err := MigrateDown(ctx, DB, steps)
+		for _, version := range reverted {
+			log.Println("Reverted migration", version)
+		}
+		return err
+	case args[0] == "status" && len(args) == 1:
+		migrations, err := Migrations()
+		if err != nil {
+			return err
+		}
+		version, err := MigrationVersion(ctx, DB)
+		if err != nil {
+			return err
+		}
+		for _, migration := range migrations {
+			state := "pending"
+			if migration.Version <= version {
+				state = "applied"
+			}
+			fmt.Printf("%04d_%s %s\n", migration.Version, migration.Name, state)
+		}
+		return nil
+	default:
+		return fmt.Errorf("unknown migrate command %q, want up, down [steps] or status", strings.Join(args, " "))
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	. "takeHomeAssignment/entities"
+)
+
+// setOverdraft changes the overdraft limit of an account, or lifts it for internal settlement accounts
+func setOverdraft(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(mux.Vars(r)["account_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("account_id", "must be an integer"))
+		return
+	}
+	var settings OverdraftSettings
+	err = DecodeRequest(r.Body, &settings)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	account := Account{}
+	err = store.SetOverdraft(accountID, &settings, &account)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(account)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
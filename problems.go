@@ -0,0 +1,169 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/lib/pq"
+	"log"
+	"net/http"
+	. "takeHomeAssignment/db"
+	. "takeHomeAssignment/entities"
+)
+
+// problemContentType is the media type of error responses, see RFC 7807
+const problemContentType = "application/problem+json"
+
+// problem is the body of every error response. Code is a stable machine-readable identifier of the error that
+// clients can rely on, unlike Detail which is meant for humans and may change.
+type problem struct {
+	Type     string       `json:"type"`
+	Title    string       `json:"title"`
+	Status   int          `json:"status"`
+	Code     string       `json:"code"`
+	Detail   string       `json:"detail,omitempty"`
+	Instance string       `json:"instance,omitempty"`
+	Errors   []fieldError `json:"errors,omitempty"`
+}
+
+// fieldError is what is wrong with one value of the request. A value of the body is identified by Pointer, a
+// JSON pointer written as a URI fragment like "#/amount" as in RFC 9457, and a path or query parameter or a header
+// by Parameter.
+type fieldError struct {
+	Pointer   string `json:"pointer,omitempty"`
+	Parameter string `json:"parameter,omitempty"`
+	Code      string `json:"code"`
+	Message   string `json:"message"`
+}
+
+// parameterError is a path or query parameter or a header that is missing or invalid
+type parameterError struct {
+	name    string
+	message string
+}
+
+func (e *parameterError) Error() string {
+	return e.name + " " + e.message
+}
+
+// invalidParameter is a parameterError, it is answered with validation_failed like an invalid body
+func invalidParameter(name string, message string) error {
+	return &parameterError{name: name, message: message}
+}
+
+// bodyFieldError is err, found with the value at pointer of the request body, as a FieldError. The errors of the
+// db package keep their code.
+func bodyFieldError(pointer string, err error) FieldError {
+	var dbErr *Error
+	if errors.As(err, &dbErr) {
+		return FieldError{Pointer: pointer, Code: dbErr.Code, Message: dbErr.Message, Err: err}
+	}
+	return FieldError{Pointer: pointer, Code: FieldInvalid, Message: err.Error(), Err: err}
+}
+
+// errIdempotencyKeyReused is a retry with an Idempotency-Key that was first used for a different request
+var errIdempotencyKeyReused = &Error{Kind: KindUnprocessable, Code: "idempotency_key_reused", Message: "Idempotency-Key has already been used for a different request"}
+
+// kindStatuses is the response status of each Kind of Error
+var kindStatuses = map[Kind]int{
+	KindInvalid:       http.StatusBadRequest,
+	KindNotFound:      http.StatusNotFound,
+	KindForbidden:     http.StatusForbidden,
+	KindConflict:      http.StatusConflict,
+	KindUnprocessable: http.StatusUnprocessableEntity,
+	KindNotSupported:  http.StatusNotImplemented,
+}
+
+// writeError answers the request with the problem err stands for. It is the only place errors are turned into
+// responses: errors of the db package are answered by their Kind and Code, anything unexpected is logged and answered
+// with a 500 that does not reveal it.
+func writeError(w http.ResponseWriter, r *http.Request, err error) {
+	p := problemFor(err)
+	if p.Status == http.StatusInternalServerError {
+		log.Printf("%s %s failed: %v", r.Method, r.URL.Path, err)
+	}
+	writeProblem(w, r, p)
+}
+
+// routeNotFound answers requests for a path no route matches
+func routeNotFound(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, problem{Status: http.StatusNotFound, Code: "route_not_found", Detail: "no resource exists at this path"})
+}
+
+// methodNotAllowed answers requests for a path that exists with a method it does not support
+func methodNotAllowed(w http.ResponseWriter, r *http.Request) {
+	writeProblem(w, r, problem{Status: http.StatusMethodNotAllowed, Code: "method_not_allowed", Detail: r.Method + " is not supported at this path"})
+}
+
+func writeProblem(w http.ResponseWriter, r *http.Request, p problem) {
+	p.Type = "about:blank"
+	p.Title = http.StatusText(p.Status)
+	p.Instance = r.URL.Path
+
+	w.Header().Set("Content-Type", problemContentType)
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	err := json.NewEncoder(w).Encode(p)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// isRetryableError reports whether an operation that failed with err may succeed if tried again. Only the errors no
+// problem is known for are, like serialization failures.
+func isRetryableError(err error) bool {
+	return problemFor(err).Status == http.StatusInternalServerError
+}
+
+func problemFor(err error) problem {
+	var invalidBody *ValidationError
+	var invalidParam *parameterError
+	var limitErr *LimitExceededError
+	var dbErr *Error
+	var pqErr *pq.Error
+	switch {
+	case errors.As(err, &invalidBody):
+		fields := make([]fieldError, len(invalidBody.Errors))
+		for i, fieldErr := range invalidBody.Errors {
+			fields[i] = fieldError{Pointer: "#" + fieldErr.Pointer, Code: fieldErr.Code, Message: fieldErr.Message}
+		}
+		return problem{Status: http.StatusBadRequest, Code: "validation_failed", Detail: "request body failed validation", Errors: fields}
+	case errors.As(err, &invalidParam):
+		fields := []fieldError{{Parameter: invalidParam.name, Code: FieldInvalid, Message: invalidParam.message}}
+		return problem{Status: http.StatusBadRequest, Code: "validation_failed", Detail: "request failed validation", Errors: fields}
+	case errors.As(err, &limitErr):
+		// Going over the number of transfers per hour is 429, going over an amount limit is 422
+		status := http.StatusUnprocessableEntity
+		if limitErr.IsVelocityLimit() {
+			status = http.StatusTooManyRequests
+		}
+		return problem{Status: status, Code: "transfer_limit_exceeded", Detail: limitErr.Error()}
+	case errors.As(err, &dbErr):
+		return problem{Status: kindStatuses[dbErr.Kind], Code: dbErr.Code, Detail: dbErr.Message}
+	case errors.Is(err, ErrTooManyDecimals):
+		return problem{Status: http.StatusBadRequest, Code: "validation_failed", Detail: err.Error()}
+	case errors.Is(err, sql.ErrNoRows):
+		return problem{Status: http.StatusNotFound, Code: "not_found", Detail: "resource does not exist"}
+	case errors.As(err, &pqErr) && pqErr.Code.Class() == "23":
+		constraintErr := constraintError(pqErr)
+		return problem{Status: kindStatuses[constraintErr.Kind], Code: constraintErr.Code, Detail: constraintErr.Message}
+	default:
+		return problem{Status: http.StatusInternalServerError, Code: "internal_error", Detail: "an unexpected error occurred"}
+	}
+}
+
+// constraintError is the Error a violation of a Postgres constraint stands for. The constraints of account_balance
+// catch a balance going too low or an account ID taken by a concurrent change that the checks made before the write
+// let through. Any other violation is a request the stored data does not allow, never worth retrying.
+func constraintError(pqErr *pq.Error) *Error {
+	switch pqErr.Constraint {
+	case "account_balance_overdraft_check", "account_balance_held_check":
+		return ErrInsufficientBalance
+	case "account_balance_account_id_key":
+		return ErrAccountExists
+	case "idempotency_keys_pkey":
+		return ErrIdempotencyKeyInUse
+	default:
+		return ErrConstraintViolation
+	}
+}
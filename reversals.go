@@ -0,0 +1,41 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	. "takeHomeAssignment/entities"
+)
+
+func reverseTransaction(w http.ResponseWriter, r *http.Request) {
+	transactionID, err := strconv.Atoi(mux.Vars(r)["transaction_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("transaction_id", "must be an integer"))
+		return
+	}
+	// An empty body reverses everything that has not been reversed yet
+	var request ReversalRequest
+	err = DecodeRequest(r.Body, &request)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, err)
+		return
+	}
+
+	record := TransactionRecord{}
+	err = store.ReverseTransaction(transactionID, request.Amount, &record)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", record.Location())
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(record)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
@@ -0,0 +1,146 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+const defaultScheduledTransferLimit = 50
+const maxScheduledTransferLimit = 200
+
+func createScheduledTransfer(w http.ResponseWriter, r *http.Request) {
+	var request ScheduledTransferRequest
+	err := DecodeRequest(r.Body, &request)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	err = validateTransaction(request.Transaction())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	transfer := ScheduledTransfer{}
+	err = store.CreateScheduledTransfer(&request, &transfer)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", transfer.Location())
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(transfer)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// getScheduledTransfers lists scheduled transfers, optionally only those of account_id or with status
+func getScheduledTransfers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	filter := ScheduledTransferFilter{Limit: defaultScheduledTransferLimit}
+	if value := query.Get("account_id"); value != "" {
+		accountID, err := strconv.Atoi(value)
+		if err != nil {
+			writeError(w, r, invalidParameter("account_id", "must be an integer"))
+			return
+		}
+		filter.AccountID = &accountID
+	}
+	filter.Status = query.Get("status")
+	switch filter.Status {
+	case "", ScheduledTransferStatusPending, ScheduledTransferStatusSucceeded, ScheduledTransferStatusFailed, ScheduledTransferStatusCancelled:
+	default:
+		writeError(w, r, invalidParameter("status", "is not a scheduled transfer status"))
+		return
+	}
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxScheduledTransferLimit {
+			writeError(w, r, invalidParameter("limit", fmt.Sprintf("must be an integer between 1 and %d", maxScheduledTransferLimit)))
+			return
+		}
+		filter.Limit = limit
+	}
+
+	var transfers []ScheduledTransfer
+	err := store.QueryScheduledTransfers(filter, &transfers)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(transfers)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getScheduledTransfer(w http.ResponseWriter, r *http.Request) {
+	scheduledTransferID, err := strconv.Atoi(mux.Vars(r)["scheduled_transfer_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("scheduled_transfer_id", "must be an integer"))
+		return
+	}
+
+	transfer := ScheduledTransfer{}
+	err = store.QueryScheduledTransferById(scheduledTransferID, &transfer)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(transfer)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func cancelScheduledTransfer(w http.ResponseWriter, r *http.Request) {
+	scheduledTransferID, err := strconv.Atoi(mux.Vars(r)["scheduled_transfer_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("scheduled_transfer_id", "must be an integer"))
+		return
+	}
+
+	transfer := ScheduledTransfer{}
+	err = store.CancelScheduledTransfer(scheduledTransferID, &transfer)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(transfer)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// executeScheduledTransfers runs until ctx is done, executing the scheduled transfers that are due
+func executeScheduledTransfers(ctx context.Context, interval time.Duration) {
+	for range tick(ctx, interval) {
+		for ctx.Err() == nil {
+			transfer := ScheduledTransfer{}
+			err := store.ExecuteDueScheduledTransfer(&transfer)
+			if err != nil {
+				if !errors.Is(err, sql.ErrNoRows) {
+					log.Println("Failed to execute scheduled transfer:", err)
+				}
+				break
+			}
+			if transfer.Status != ScheduledTransferStatusSucceeded {
+				log.Println("Scheduled transfer", transfer.ScheduledTransferID, "attempt", transfer.Attempts, "failed:", *transfer.LastError)
+			}
+		}
+	}
+}
@@ -0,0 +1,126 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+func createStandingOrder(w http.ResponseWriter, r *http.Request) {
+	var request StandingOrderRequest
+	err := DecodeRequest(r.Body, &request)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	err = validateTransaction(request.Transaction())
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	order := StandingOrder{}
+	err = store.CreateStandingOrder(&request, &order)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", order.Location())
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(order)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getStandingOrder(w http.ResponseWriter, r *http.Request) {
+	standingOrderID, err := strconv.Atoi(mux.Vars(r)["standing_order_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("standing_order_id", "must be an integer"))
+		return
+	}
+
+	order := StandingOrder{}
+	err = store.QueryStandingOrderById(standingOrderID, &order)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(order)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getStandingOrderExecutions(w http.ResponseWriter, r *http.Request) {
+	standingOrderID, err := strconv.Atoi(mux.Vars(r)["standing_order_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("standing_order_id", "must be an integer"))
+		return
+	}
+
+	err = store.QueryStandingOrderById(standingOrderID, &StandingOrder{})
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	var executions []StandingOrderExecution
+	err = store.QueryStandingOrderExecutions(standingOrderID, &executions)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(executions)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func cancelStandingOrder(w http.ResponseWriter, r *http.Request) {
+	standingOrderID, err := strconv.Atoi(mux.Vars(r)["standing_order_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("standing_order_id", "must be an integer"))
+		return
+	}
+
+	order := StandingOrder{}
+	err = store.CancelStandingOrder(standingOrderID, &order)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(order)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// executeStandingOrders runs until ctx is done, executing the occurrences of standing orders that are due
+func executeStandingOrders(ctx context.Context, interval time.Duration) {
+	for range tick(ctx, interval) {
+		for ctx.Err() == nil {
+			execution := StandingOrderExecution{}
+			err := store.ExecuteDueStandingOrder(&execution)
+			if err != nil {
+				if !errors.Is(err, sql.ErrNoRows) {
+					log.Println("Failed to execute standing order:", err)
+				}
+				break
+			}
+			if execution.Status == StandingOrderExecutionFailed {
+				log.Println("Standing order", execution.StandingOrderID, "occurrence", execution.Occurrence, "failed:", *execution.Error)
+			}
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	. "takeHomeAssignment/entities"
+)
+
+func addTransactionBatch(w http.ResponseWriter, r *http.Request) {
+	var batch TransactionBatch
+
+	err := DecodeRequest(r.Body, &batch)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	// Every invalid transaction is reported, with its index
+	var invalid []FieldError
+	for i, tx := range batch.Transactions {
+		err = validateTransaction(tx)
+		if err != nil {
+			invalid = append(invalid, bodyFieldError(fmt.Sprintf("/transactions/%d", i), err))
+		}
+	}
+	if len(invalid) > 0 {
+		writeError(w, r, &ValidationError{Errors: invalid})
+		return
+	}
+
+	// Perform the batch
+	// Retry if there is a concurrency error
+	record := TransactionBatchRecord{}
+	for i := 0; i < maxTransactionAttempts; i++ {
+		err = store.ProcessTransactionBatch(&batch, &record)
+		if err == nil || !isRetryableError(err) {
+			break
+		}
+		log.Println("Unknown error when processing transaction batch:", err)
+	}
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/transactions/batch/"+strconv.Itoa(record.BatchID))
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(record)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getTransactionBatch(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	record := TransactionBatchRecord{}
+	batchID, err := strconv.Atoi(vars["batch_id"])
+
+	if err != nil {
+		writeError(w, r, invalidParameter("batch_id", "must be an integer"))
+		return
+	}
+
+	err = store.QueryTransactionBatchById(batchID, &record)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(record)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+const defaultTransactionHistoryLimit = 50
+const maxTransactionHistoryLimit = 200
+
+func getAccountTransactions(w http.ResponseWriter, r *http.Request) {
+	vars := mux.Vars(r)
+	accountID, err := strconv.Atoi(vars["account_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("account_id", "must be an integer"))
+		return
+	}
+
+	filter, err := parseTransactionHistoryFilter(r)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	account := Account{}
+	err = store.QueryAccountByAccountId(accountID, &account)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	page := TransactionHistoryPage{}
+	err = store.QueryAccountTransactions(accountID, filter, &page)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(page)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// parseTransactionHistoryFilter reads direction, from, to, min_amount, max_amount, cursor and limit from the query string
+func parseTransactionHistoryFilter(r *http.Request) (TransactionHistoryFilter, error) {
+	query := r.URL.Query()
+	filter := TransactionHistoryFilter{Limit: defaultTransactionHistoryLimit}
+
+	direction := query.Get("direction")
+	if direction != "" && direction != DirectionIncoming && direction != DirectionOutgoing && direction != DirectionFee {
+		return filter, invalidParameter("direction", fmt.Sprintf("must be %q, %q or %q", DirectionIncoming, DirectionOutgoing, DirectionFee))
+	}
+	filter.Direction = direction
+
+	for name, target := range map[string]**time.Time{"from": &filter.From, "to": &filter.To} {
+		if value := query.Get(name); value != "" {
+			parsed, err := time.Parse(time.RFC3339, value)
+			if err != nil {
+				return filter, invalidParameter(name, "must be an RFC 3339 timestamp")
+			}
+			*target = &parsed
+		}
+	}
+	if filter.From != nil && filter.To != nil && !filter.From.Before(*filter.To) {
+		return filter, invalidParameter("from", "must be before to")
+	}
+
+	for name, target := range map[string]**Money{"min_amount": &filter.MinAmount, "max_amount": &filter.MaxAmount} {
+		if value := query.Get(name); value != "" {
+			parsed, err := ParseMoney(value)
+			if err != nil {
+				return filter, invalidParameter(name, err.Error())
+			}
+			*target = &parsed
+		}
+	}
+	if filter.MinAmount != nil && filter.MaxAmount != nil && *filter.MinAmount > *filter.MaxAmount {
+		return filter, invalidParameter("min_amount", "cannot be greater than max_amount")
+	}
+
+	if value := query.Get("cursor"); value != "" {
+		cursor, err := DecodeTransactionHistoryCursor(value)
+		if err != nil {
+			return filter, invalidParameter("cursor", err.Error())
+		}
+		filter.After = &cursor
+	}
+
+	if value := query.Get("limit"); value != "" {
+		limit, err := strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxTransactionHistoryLimit {
+			return filter, invalidParameter("limit", fmt.Sprintf("must be an integer between 1 and %d", maxTransactionHistoryLimit))
+		}
+		filter.Limit = limit
+	}
+	return filter, nil
+}
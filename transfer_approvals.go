@@ -0,0 +1,239 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gorilla/mux"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	. "takeHomeAssignment/db"
+	. "takeHomeAssignment/entities"
+	"time"
+)
+
+// principalHeader identifies who requests, approves or rejects a transfer that needs approval.
+// The server does not authenticate anyone, it trusts the header as it is: anyone who can reach it can claim to be any
+// principal, so on its own the header is not a security boundary. Maker-checker only holds if the server is
+// reachable solely through a gateway that authenticates the caller and sets the header itself, replacing any value
+// the client sent, and that keeps the /admin endpoints, which can change the approval thresholds, to administrators.
+const principalHeader = "X-Principal-ID"
+
+const maxPrincipalLength = 255
+
+const defaultTransferApprovalLimit = 50
+const maxTransferApprovalLimit = 200
+
+// principal returns the principal of the request, or writes an error and returns false if there is none
+func principal(w http.ResponseWriter, r *http.Request) (string, bool) {
+	principal := r.Header.Get(principalHeader)
+	if principal == "" || len(principal) > maxPrincipalLength {
+		writeError(w, r, invalidParameter(principalHeader, fmt.Sprintf("is required and can be at most %d characters", maxPrincipalLength)))
+		return "", false
+	}
+	return principal, true
+}
+
+// requestTransferApproval answers POST /transactions for a transfer over the approval threshold with 202,
+// the transfer waits for a second principal instead of being executed
+func requestTransferApproval(w http.ResponseWriter, r *http.Request, tx *Transaction, policy *ApprovalPolicy, idempotencyKey *IdempotencyKey) {
+	requestedBy, ok := principal(w, r)
+	if !ok {
+		return
+	}
+	if idempotencyKey != nil {
+		idempotencyKey.ResponseStatus = http.StatusAccepted
+	}
+
+	approval := TransferApproval{}
+	err := store.CreateTransferApproval(tx, requestedBy, policy, idempotencyKey, &approval)
+	if err != nil {
+		// A concurrent request with the same key won the race
+		if errors.Is(err, ErrIdempotencyKeyInUse) && replayIdempotentRequest(w, r, idempotencyKey) {
+			return
+		}
+		writeError(w, r, err)
+		return
+	}
+
+	// Written exactly like the response stored with the idempotency key, so that a replay is byte for byte the same
+	response, err := json.Marshal(approval)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	w.Header().Set("Location", approval.Location())
+	w.WriteHeader(http.StatusAccepted)
+	_, err = w.Write(response)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getTransferApprovals(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+	status := query.Get("status")
+	switch status {
+	case "":
+		status = TransferApprovalStatusPending
+	case TransferApprovalStatusPending, TransferApprovalStatusApproved, TransferApprovalStatusRejected, TransferApprovalStatusExpired:
+	default:
+		writeError(w, r, invalidParameter("status", "is not a transfer approval status"))
+		return
+	}
+	limit := defaultTransferApprovalLimit
+	if value := query.Get("limit"); value != "" {
+		var err error
+		limit, err = strconv.Atoi(value)
+		if err != nil || limit < 1 || limit > maxTransferApprovalLimit {
+			writeError(w, r, invalidParameter("limit", fmt.Sprintf("must be an integer between 1 and %d", maxTransferApprovalLimit)))
+			return
+		}
+	}
+
+	var approvals []TransferApproval
+	err := store.QueryTransferApprovals(status, limit, &approvals)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(approvals)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getTransferApproval(w http.ResponseWriter, r *http.Request) {
+	transferApprovalID, err := strconv.Atoi(mux.Vars(r)["transfer_approval_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("transfer_approval_id", "must be an integer"))
+		return
+	}
+
+	approval := TransferApproval{}
+	err = store.QueryTransferApprovalById(transferApprovalID, &approval)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(approval)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func approveTransfer(w http.ResponseWriter, r *http.Request) {
+	transferApprovalID, decidedBy, decision, ok := parseApprovalDecision(w, r)
+	if !ok {
+		return
+	}
+
+	approval := TransferApproval{}
+	record := TransactionRecord{}
+	err := store.ApproveTransfer(transferApprovalID, decidedBy, &decision, &approval, &record)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", record.Location())
+	w.WriteHeader(http.StatusCreated)
+	err = json.NewEncoder(w).Encode(record)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func rejectTransfer(w http.ResponseWriter, r *http.Request) {
+	transferApprovalID, decidedBy, decision, ok := parseApprovalDecision(w, r)
+	if !ok {
+		return
+	}
+
+	approval := TransferApproval{}
+	err := store.RejectTransfer(transferApprovalID, decidedBy, &decision, &approval)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(approval)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// parseApprovalDecision reads the approval ID, the deciding principal and the optional body of an approve or reject
+func parseApprovalDecision(w http.ResponseWriter, r *http.Request) (int, string, ApprovalDecision, bool) {
+	var decision ApprovalDecision
+	transferApprovalID, err := strconv.Atoi(mux.Vars(r)["transfer_approval_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("transfer_approval_id", "must be an integer"))
+		return 0, "", decision, false
+	}
+	decidedBy, ok := principal(w, r)
+	if !ok {
+		return 0, "", decision, false
+	}
+	// An empty body decides without a reason
+	err = DecodeRequest(r.Body, &decision)
+	if err != nil && !errors.Is(err, io.EOF) {
+		writeError(w, r, err)
+		return 0, "", decision, false
+	}
+	return transferApprovalID, decidedBy, decision, true
+}
+
+// setApprovalPolicy creates or replaces the approval threshold of a currency
+func setApprovalPolicy(w http.ResponseWriter, r *http.Request) {
+	var policy ApprovalPolicy
+	err := DecodeRequest(r.Body, &policy)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = store.UpsertApprovalPolicy(&policy)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(policy)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getApprovalPolicies(w http.ResponseWriter, r *http.Request) {
+	var policies []ApprovalPolicy
+	err := store.QueryApprovalPolicies(&policies)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+
+	err = json.NewEncoder(w).Encode(policies)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+// expireTransferApprovals runs until ctx is done, expiring the transfers that were not approved or rejected in time
+func expireTransferApprovals(ctx context.Context, interval time.Duration) {
+	for range tick(ctx, interval) {
+		expired, err := store.ExpireTransferApprovals()
+		if err != nil {
+			log.Println("Failed to expire transfer approvals:", err)
+			continue
+		}
+		if expired > 0 {
+			log.Println("Expired transfer approvals:", expired)
+		}
+	}
+}
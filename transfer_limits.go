@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"github.com/gorilla/mux"
+	"log"
+	"net/http"
+	"strconv"
+	. "takeHomeAssignment/entities"
+)
+
+func setAccountTransferLimits(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(mux.Vars(r)["account_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("account_id", "must be an integer"))
+		return
+	}
+	setTransferLimits(w, r, TransferLimitPolicy{AccountID: &accountID})
+}
+
+func setAccountTypeTransferLimits(w http.ResponseWriter, r *http.Request) {
+	accountType := mux.Vars(r)["account_type"]
+	if len(accountType) > 32 {
+		writeError(w, r, invalidParameter("account_type", "can be at most 32 characters"))
+		return
+	}
+	currency, err := ParseCurrency(mux.Vars(r)["currency"])
+	if err != nil {
+		writeError(w, r, invalidParameter("currency", err.Error()))
+		return
+	}
+	setTransferLimits(w, r, TransferLimitPolicy{AccountType: &accountType, Currency: currency})
+}
+
+// setTransferLimits replaces the limits of the account or account type the policy is attached to. A currency in the
+// body has to match the one of the URL for an account type.
+func setTransferLimits(w http.ResponseWriter, r *http.Request, policy TransferLimitPolicy) {
+	urlCurrency := policy.Currency
+	err := DecodeRequest(r.Body, &policy)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	if urlCurrency != "" && policy.Currency != urlCurrency {
+		writeError(w, r, &ValidationError{Errors: []FieldError{{Pointer: "/currency", Code: FieldInvalid, Message: "must be the currency of the URL"}}})
+		return
+	}
+
+	err = store.UpsertTransferLimitPolicy(&policy)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	err = json.NewEncoder(w).Encode(policy)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
+
+func getAccountTransferLimits(w http.ResponseWriter, r *http.Request) {
+	accountID, err := strconv.Atoi(mux.Vars(r)["account_id"])
+	if err != nil {
+		writeError(w, r, invalidParameter("account_id", "must be an integer"))
+		return
+	}
+	getTransferLimits(w, r, TransferLimitPolicy{AccountID: &accountID})
+}
+
+func getAccountTypeTransferLimits(w http.ResponseWriter, r *http.Request) {
+	accountType := mux.Vars(r)["account_type"]
+	currency, err := ParseCurrency(mux.Vars(r)["currency"])
+	if err != nil {
+		writeError(w, r, invalidParameter("currency", err.Error()))
+		return
+	}
+	getTransferLimits(w, r, TransferLimitPolicy{AccountType: &accountType, Currency: currency})
+}
+
+func getTransferLimits(w http.ResponseWriter, r *http.Request, policy TransferLimitPolicy) {
+	err := store.QueryTransferLimitPolicy(&policy)
+	if err != nil {
+		writeError(w, r, err)
+		return
+	}
+	err = json.NewEncoder(w).Encode(policy)
+	if err != nil {
+		log.Println("Failed to write response:", err)
+	}
+}
@@ -0,0 +1,40 @@
+package main
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// startWorker runs worker in the background until ctx is done. workers is done once it has returned.
+func startWorker(ctx context.Context, workers *sync.WaitGroup, worker func(context.Context, time.Duration), interval time.Duration) {
+	workers.Add(1)
+	go func() {
+		defer workers.Done()
+		worker(ctx, interval)
+	}()
+}
+
+// tick sends the time every interval like a time.Ticker, and closes the channel once ctx is done, so that a worker
+// ranging over it finishes the run in progress and returns. Ticks are dropped while the worker is busy.
+func tick(ctx context.Context, interval time.Duration) <-chan time.Time {
+	ticks := make(chan time.Time)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		defer close(ticks)
+		for {
+			select {
+			case <-ctx.Done():
+				return
+			case t := <-ticker.C:
+				select {
+				case ticks <- t:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+	return ticks
+}